@@ -69,6 +69,10 @@ class API {
   async setLBOverrides(data) {
     return axios.put("/api/load-balancer/route-overrides", data);
   }
+  async listLBPolicies() {
+    const result = await axios.get("/api/load-balancer/policies");
+    return result.data;
+  }
 }
 
 const api = new API();
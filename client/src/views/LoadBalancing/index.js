@@ -19,17 +19,84 @@ import {
   TextField,
   Typography,
 } from "@mui/material";
-import React, { useState } from "react";
+import React, { useEffect, useState } from "react";
 import api from "../../api";
 import Page from "../../components/Page";
 import ResourceDialog from "../../components/ResourceDialog";
 
+// Selection policies come from the server's catalog, along with the parameters
+// they take. Only text parameters can be edited here.
+function PolicyFields({ policy, setPolicy, params, setParams }) {
+  const [policies, setPolicies] = useState([]);
+
+  useEffect(() => {
+    api
+      .listLBPolicies()
+      .then((data) => setPolicies(data))
+      .catch((err) => console.log(err));
+  }, []);
+
+  const parameters = policies.find((p) => p.name === policy)?.parameters ?? [];
+
+  return (
+    <>
+      <FormControl fullWidth variant="standard">
+        <InputLabel id="lb_policy-select-label">Load Balancing Selection Policy</InputLabel>
+        <Select
+          labelId="lb_policy-select-label"
+          id="lb_policy-select"
+          label="Load Balancing Selection Policy"
+          fullWidth
+          value={policies.length > 0 ? policy : ""}
+          onChange={(e) => {
+            setPolicy(e.target.value);
+            setParams({});
+          }}
+        >
+          {policies.map((p) => (
+            <MenuItem value={p.name} key={p.name}>
+              {p.name}
+            </MenuItem>
+          ))}
+        </Select>
+      </FormControl>
+      {parameters
+        .filter((p) => p.type === "string")
+        .map((p) => (
+          <TextField
+            size="small"
+            label={p.name}
+            helperText={p.description}
+            required={p.required}
+            fullWidth
+            margin="normal"
+            variant="standard"
+            value={params?.[p.name] ?? ""}
+            onChange={(e) => setParams({ ...params, [p.name]: e.target.value })}
+            key={p.name}
+          />
+        ))}
+    </>
+  );
+}
+
+function trimParams(params) {
+  const trimmed = {};
+  Object.entries(params ?? {}).forEach(([name, value]) => {
+    if (typeof value !== "string") trimmed[name] = value;
+    else if (value.trim() !== "") trimmed[name] = value.trim();
+  });
+  return trimmed;
+}
+
 function EditDefaultsDialog({ open, onClose, settings, setResources }) {
   const [headerName, setHeaderName] = useState(settings?.match_header ?? "");
   const [policy, setPolicy] = useState(settings?.policy ?? "");
+  const [params, setParams] = useState(settings?.policy_params ?? {});
 
   function onOk() {
     settings.policy = policy.trim();
+    settings.policy_params = trimParams(params);
     settings.match_header = headerName.trim();
 
     api
@@ -41,30 +108,14 @@ function EditDefaultsDialog({ open, onClose, settings, setResources }) {
     setTimeout(() => window.location.reload(), 1000);
     setHeaderName("");
     setPolicy("");
+    setParams({});
 
     onClose();
   }
 
   return (
     <ResourceDialog title="Edit default settings." open={open} onClose={onClose} onOk={onOk}>
-      <FormControl fullWidth variant="standard">
-        <InputLabel id="add-default_lb_policy-select-label">Load Balancing Selection Policy</InputLabel>
-        <Select
-          labelId="add-default_lb_policy-select-label"
-          id="add-default_lb_policy-select"
-          label="Load Balancing Selection Policy"
-          fullWidth
-          value={policy}
-          onChange={(e) => setPolicy(e.target.value)}
-        >
-          <MenuItem value="round_robin">round_robin</MenuItem>
-          <MenuItem value="random">random</MenuItem>
-          <MenuItem value="first">first</MenuItem>
-          <MenuItem value="least_conn">least_conn</MenuItem>
-          <MenuItem value="ip_hash">ip_hash</MenuItem>
-          <MenuItem value="uri_hash">uri_hash</MenuItem>
-        </Select>
-      </FormControl>
+      <PolicyFields policy={policy} setPolicy={setPolicy} params={params} setParams={setParams} />
       <TextField
         size="small"
         label="Match Header Name"
@@ -79,18 +130,20 @@ function EditDefaultsDialog({ open, onClose, settings, setResources }) {
 }
 
 function OverrideRouteDialog({ open, onClose, data, setResources }) {
-  let { bucketName, policy, upstreams, overrides } = data;
+  let { bucketName, policy, policyParams, upstreams, overrides } = data;
   if (!overrides) overrides = {};
 
   const [overridden, setOverridden] = useState(!!overrides[bucketName]);
 
   const [urls, setUrls] = useState(upstreams?.join(", ") ?? "");
   const [newPolicy, setPolicy] = useState(policy ?? "");
+  const [params, setParams] = useState(policyParams ?? {});
 
   function onOk() {
     if (overridden) {
       overrides[bucketName] = {
         policy: newPolicy,
+        policy_params: trimParams(params),
         upstreams: urls.split(",").map((url) => url.trim()),
       };
     } else {
@@ -106,6 +159,7 @@ function OverrideRouteDialog({ open, onClose, data, setResources }) {
     setOverridden(false);
     setUrls("");
     setPolicy("");
+    setParams({});
 
     onClose();
   }
@@ -130,24 +184,7 @@ function OverrideRouteDialog({ open, onClose, data, setResources }) {
           value={urls}
           onChange={(e) => setUrls(e.target.value)}
         />
-        <FormControl fullWidth variant="standard">
-          <InputLabel id="add-default_lb_policy-select-label">Load Balancing Selection Policy</InputLabel>
-          <Select
-            labelId="add-default_lb_policy-select-label"
-            id="add-default_lb_policy-select"
-            label="Load Balancing Selection Policy"
-            fullWidth
-            value={newPolicy}
-            onChange={(e) => setPolicy(e.target.value)}
-          >
-            <MenuItem value="round_robin">round_robin</MenuItem>
-            <MenuItem value="random">random</MenuItem>
-            <MenuItem value="first">first</MenuItem>
-            <MenuItem value="least_conn">least_conn</MenuItem>
-            <MenuItem value="ip_hash">ip_hash</MenuItem>
-            <MenuItem value="uri_hash">uri_hash</MenuItem>
-          </Select>
-        </FormControl>
+        <PolicyFields policy={newPolicy} setPolicy={setPolicy} params={params} setParams={setParams} />
       </Collapse>
     </ResourceDialog>
   );
@@ -211,7 +248,15 @@ function RouteRow({ route, overrides, settings, onConfigure }) {
               color="secondary"
               startIcon={<EditOutlined />}
               className="resource-row-details-buttons-btn"
-              onClick={() => onConfigure({ bucketName, policy, upstreams: route?.upstreams ?? [], overrides })}
+              onClick={() =>
+                onConfigure({
+                  bucketName,
+                  policy,
+                  policyParams: route?.policy_params,
+                  upstreams: route?.upstreams ?? [],
+                  overrides,
+                })
+              }
             >
               Configure
             </Button>
@@ -43,7 +43,89 @@ CREATE TABLE storage_deployments (
   secret_key             text         NOT NULL,
   use_ssl                boolean      NOT NULL,
   sqs_arn                text         NOT NULL,
-  management_url         text         NOT NULL DEFAULT ''
+  management_url         text         NOT NULL DEFAULT '',
+  kind                   text         NOT NULL DEFAULT 'minio'
+);
+
+CREATE TABLE storage_deployments_policies (
+  storage_id             int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  policy_id              int          NOT NULL REFERENCES policies
+                                      ON DELETE CASCADE,
+  value                  jsonb        NOT NULL,
+
+  UNIQUE (storage_id, policy_id)
+);
+
+CREATE TABLE storage_health_states (
+  storage_id             int          PRIMARY KEY REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  status                 text         NOT NULL DEFAULT 'unknown',
+  consecutive_successes  int          NOT NULL DEFAULT 0,
+  consecutive_failures   int          NOT NULL DEFAULT 0,
+  last_checked_at        timestamptz,
+  last_latency_ms        double precision,
+  last_error             text         NOT NULL DEFAULT '',
+  updated_at             timestamptz  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE faas_deployments_policies (
+  faas_id                int          NOT NULL REFERENCES faas_deployments
+                                      ON DELETE CASCADE,
+  policy_id              int          NOT NULL REFERENCES policies
+                                      ON DELETE CASCADE,
+  value                  jsonb        NOT NULL,
+
+  UNIQUE (faas_id, policy_id)
+);
+
+CREATE TABLE faas_health_states (
+  faas_id                int          PRIMARY KEY REFERENCES faas_deployments
+                                      ON DELETE CASCADE,
+  status                 text         NOT NULL DEFAULT 'unknown',
+  consecutive_successes  int          NOT NULL DEFAULT 0,
+  consecutive_failures   int          NOT NULL DEFAULT 0,
+  last_checked_at        timestamptz,
+  last_latency_ms        double precision,
+  last_error             text         NOT NULL DEFAULT '',
+  updated_at             timestamptz  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE faas_health_checks (
+  check_id               serial       PRIMARY KEY,
+  faas_id                int          NOT NULL REFERENCES faas_deployments
+                                      ON DELETE CASCADE,
+  checked_at             timestamptz  NOT NULL DEFAULT now(),
+  healthy                boolean      NOT NULL,
+  status_code            int          NOT NULL DEFAULT 0,
+  latency_ms             double precision NOT NULL,
+  error                  text         NOT NULL DEFAULT ''
+);
+
+CREATE INDEX faas_health_checks_history_idx ON faas_health_checks (faas_id, checked_at);
+
+-- Invocations the gateway forwarded to each FaaS deployment, aggregated per
+-- flush.
+CREATE TABLE faas_invocation_stats (
+  faas_id                int          NOT NULL REFERENCES faas_deployments
+                                      ON DELETE CASCADE,
+  sampled_at             timestamptz  NOT NULL DEFAULT now(),
+  requests               int          NOT NULL,
+  errors                 int          NOT NULL,
+  latency_ms_total       double precision NOT NULL
+);
+
+CREATE INDEX faas_invocation_stats_window_idx ON faas_invocation_stats (sampled_at);
+
+CREATE TABLE faas_latency_weights (
+  faas_id                int          PRIMARY KEY REFERENCES faas_deployments
+                                      ON DELETE CASCADE,
+  source                 text         NOT NULL,
+  samples                int          NOT NULL DEFAULT 0,
+  latency_ms             double precision,
+  error_rate             double precision,
+  weight                 int          NOT NULL,
+  updated_at             timestamptz  NOT NULL DEFAULT now()
 );
 
 CREATE TABLE buckets (
@@ -72,11 +154,108 @@ CREATE TABLE replica_bucket_locations (
   UNIQUE (bucket_id, storage_id)
 );
 
+-- Buckets whose master was moved off an unhealthy storage deployment, to be
+-- moved back once the original is healthy and in sync again.
+CREATE TABLE bucket_failovers (
+  bucket_id              int          PRIMARY KEY REFERENCES buckets
+                                      ON DELETE CASCADE,
+  original_storage_id    int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  promoted_storage_id    int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  status                 text         NOT NULL DEFAULT 'failed-over',
+  failed_over_at         timestamptz  NOT NULL DEFAULT now(),
+  updated_at             timestamptz  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE replica_rule_locations (
+  bucket_id              int          NOT NULL REFERENCES buckets
+                                      ON DELETE CASCADE,
+  rule_key               text         NOT NULL,
+  storage_id             int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+
+  PRIMARY KEY (bucket_id, rule_key, storage_id)
+);
+
+-- Replicas removed from their bucket whose data is kept until delete_after.
+-- Outlives the bucket, hence no reference to it.
+CREATE TABLE pending_replica_deletions (
+  deletion_id            serial       PRIMARY KEY,
+  bucket_id              int          NOT NULL,
+  bucket_name            text         NOT NULL,
+  storage_id             int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  requested_at           timestamptz  NOT NULL DEFAULT now(),
+  delete_after           timestamptz  NOT NULL,
+
+  UNIQUE (bucket_name, storage_id)
+);
+
+CREATE TABLE bucket_placement_statuses (
+  bucket_id              int          NOT NULL REFERENCES buckets
+                                      ON DELETE CASCADE,
+  rule_key               text         NOT NULL,
+  status                 text         NOT NULL,
+  reasons                text[]       NOT NULL DEFAULT '{}',
+  updated_at             timestamptz  NOT NULL DEFAULT now(),
+
+  PRIMARY KEY (bucket_id, rule_key)
+);
+
 CREATE TABLE objects (
   object_id              serial       PRIMARY KEY,
   bucket_id              int          NOT NULL REFERENCES buckets
                                       ON DELETE CASCADE,
   name                   text         NOT NULL,
+  etag                   text         NOT NULL DEFAULT '',
+  size                   bigint       NOT NULL DEFAULT 0,
 
   UNIQUE (bucket_id, name)
 );
+
+CREATE TABLE object_locations (
+  object_id              int          NOT NULL REFERENCES objects
+                                      ON DELETE CASCADE,
+  storage_id             int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  etag                   text         NOT NULL,
+  updated_at             timestamptz  NOT NULL DEFAULT now(),
+
+  PRIMARY KEY (object_id, storage_id)
+);
+
+CREATE TABLE replication_jobs (
+  job_id                 serial       PRIMARY KEY,
+  bucket_id              int          NOT NULL REFERENCES buckets
+                                      ON DELETE CASCADE,
+  dst_storage_id         int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  object_name            text         NOT NULL DEFAULT '',
+  status                 text         NOT NULL DEFAULT 'pending',
+  attempts               int          NOT NULL DEFAULT 0,
+  max_attempts           int          NOT NULL DEFAULT 8,
+  last_error             text         NOT NULL DEFAULT '',
+  next_attempt_at        timestamptz  NOT NULL DEFAULT now(),
+  created_at             timestamptz  NOT NULL DEFAULT now(),
+  updated_at             timestamptz  NOT NULL DEFAULT now(),
+  lease_expires_at       timestamptz
+);
+
+CREATE INDEX replication_jobs_claim_idx ON replication_jobs (status, next_attempt_at);
+
+CREATE TABLE replica_sync_states (
+  bucket_id              int          NOT NULL REFERENCES buckets
+                                      ON DELETE CASCADE,
+  storage_id             int          NOT NULL REFERENCES storage_deployments
+                                      ON DELETE CASCADE,
+  status                 text         NOT NULL DEFAULT 'stale',
+  last_sync_at           timestamptz,
+  out_of_sync_since      timestamptz  DEFAULT now(),
+  objects_behind         bigint       NOT NULL DEFAULT 0,
+  bytes_behind           bigint       NOT NULL DEFAULT 0,
+  last_error             text         NOT NULL DEFAULT '',
+  updated_at             timestamptz  NOT NULL DEFAULT now(),
+
+  UNIQUE (bucket_id, storage_id)
+);
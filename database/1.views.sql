@@ -15,6 +15,35 @@ CREATE VIEW buckets_faas_deployments AS
       LEFT JOIN faas_deployments fd ON fd.cluster_id = c.cluster_id
   ) AS x GROUP BY x.bucket_id, x.bucket_name;
 
+CREATE VIEW bucket_faas_locations AS
+  SELECT b.bucket_id, b.name AS bucket_name, loc.storage_id, loc.storage_id = b.storage_id AS is_master,
+    COALESCE(rss.status, '') AS sync_status, rss.out_of_sync_since, fd.faas_id, fd.url AS faas_url
+  FROM buckets b
+  INNER JOIN (
+    SELECT bucket_id, storage_id FROM replica_bucket_locations
+    UNION
+    SELECT bucket_id, storage_id FROM buckets
+  ) AS loc ON loc.bucket_id = b.bucket_id
+  INNER JOIN storage_deployments sd ON sd.storage_id = loc.storage_id
+  INNER JOIN faas_deployments fd ON fd.cluster_id = sd.cluster_id
+  LEFT JOIN replica_sync_states rss ON rss.bucket_id = loc.bucket_id AND rss.storage_id = loc.storage_id;
+
+CREATE VIEW object_faas_locations AS
+  SELECT o.object_id, o.bucket_id, b.name AS bucket_name, o.name AS object_name, loc.storage_id, fd.faas_id, fd.url AS faas_url
+  FROM objects o
+  INNER JOIN buckets b ON b.bucket_id = o.bucket_id
+  INNER JOIN (
+    SELECT o.object_id, b.storage_id
+      FROM objects o
+      INNER JOIN buckets b ON b.bucket_id = o.bucket_id
+    UNION
+    SELECT ol.object_id, ol.storage_id
+      FROM object_locations ol
+      INNER JOIN objects o ON o.object_id = ol.object_id AND o.etag = ol.etag
+  ) AS loc ON loc.object_id = o.object_id
+  INNER JOIN storage_deployments sd ON sd.storage_id = loc.storage_id
+  INNER JOIN faas_deployments fd ON fd.cluster_id = sd.cluster_id;
+
 CREATE VIEW existing_bucket_locations AS
   SELECT bucket_id, array_agg(storage_id) AS storage_ids
   FROM replica_bucket_locations
@@ -28,3 +57,15 @@ CREATE VIEW bucket_replications AS
   LEFT JOIN buckets b ON b.bucket_id = rbl.bucket_id
   LEFT JOIN storage_deployments src_sd ON src_sd.storage_id = b.storage_id
   LEFT JOIN storage_deployments dst_sd ON dst_sd.storage_id = rbl.storage_id;
+
+CREATE VIEW replication_job_summaries AS
+  SELECT j.bucket_id, b.name AS bucket_name, j.dst_storage_id, sd.alias AS dst_storage_alias,
+    count(*) FILTER (WHERE j.status = 'pending') AS pending,
+    count(*) FILTER (WHERE j.status = 'running') AS running,
+    count(*) FILTER (WHERE j.status = 'failed') AS failed,
+    count(*) FILTER (WHERE j.status = 'completed') AS completed,
+    max(j.updated_at) AS last_updated_at
+  FROM replication_jobs j
+  LEFT JOIN buckets b ON b.bucket_id = j.bucket_id
+  LEFT JOIN storage_deployments sd ON sd.storage_id = j.dst_storage_id
+  GROUP BY j.bucket_id, b.name, j.dst_storage_id, sd.alias;
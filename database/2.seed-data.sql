@@ -1,6 +1,7 @@
 INSERT INTO policies (name, default_value)
 VALUES
   ('lb_policy',             '"round_robin"'),
+  ('lb_policy_params',      '{}'),
   ('lb_match_header',       '"X-FaDO-Bucket"'),
   ('lb_upstreams',          '[]'),
   ('lb_routes',             '{}'),
@@ -8,4 +9,38 @@ VALUES
   ('caddy_config',          '""'),
   ('replica_locations', '[]'),
   ('target_replica_count',  '0'),
-  ('zones',                 '[]');
+  ('zones',                 '[]'),
+  ('replica_verify_interval', '900'),
+  ('replica_staleness_threshold', '60'),
+  ('storage_poll_interval', '30'),
+  ('lb_object_header',      '"X-FaDO-Object"'),
+  ('lb_object_query_param', '"fado_object"'),
+  ('lb_object_routes_max',  '1000'),
+  ('lb_object_routes',      '{}'),
+  ('replication_rules',     '[]'),
+  ('placement_weight',      '1'),
+  ('failure_domains',       '{}'),
+  ('spread_constraints',    '[]'),
+  ('denied_zones',          '[]'),
+  ('replication_denied_clusters', '[]'),
+  ('replica_deletion_grace_period', '86400'),
+  ('config_managed',        '{}'),
+  ('lb_health_check_path',  '""'),
+  ('lb_health_check_interval', '"30s"'),
+  ('lb_health_check_timeout', '"5s"'),
+  ('lb_passive_fail_duration', '"30s"'),
+  ('lb_passive_max_fails',  '1'),
+  ('lb_passive_unhealthy_status', '[502, 503, 504]'),
+  ('faas_health_path',      '"/"'),
+  ('faas_health_interval',  '15'),
+  ('faas_health_timeout',   '5'),
+  ('faas_health_failure_threshold', '3'),
+  ('faas_health_success_threshold', '2'),
+  ('faas_health_history_retention', '86400'),
+  ('storage_health_interval', '15'),
+  ('storage_health_failure_threshold', '3'),
+  ('storage_health_success_threshold', '2'),
+  ('master_failover',       'false'),
+  ('lb_latency_window',     '300'),
+  ('lb_latency_refresh_interval', '30'),
+  ('lb_latency_max_weight', '100');
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 )
 
 func PrintHelp() {
@@ -12,26 +13,62 @@ FaDO - Usage Information
 
 The function and data orchestrator for multi-serverless platforms.
 
+Usage:
+
+    fado [arguments]      Run the server.
+    fado export [arguments]
+                          Print the current topology as a configuration file and exit.
+
 Command line arguments:
 
-    --config, -c          Path to initial configuration JSON file. Falls back to value from environment.
+    --config, -c          Path to configuration JSON or YAML file, applied on startup and whenever it changes or FaDO receives SIGHUP. Falls back to value from environment.
+	--prune               Remove clusters, deployments and buckets once they are dropped from the configuration file. Buckets are deleted along with their data.
 	--database, -d        Database connection string. Falls back to value from environment.
 	--server-url          Server URL. Falls back to value from environment.
 	--caddy-admin-url     Caddy admin management endpoint. Falls back to value from environment.
 	--lb-endpoint         Load balancer endpoint. Falls back to value from environment.
+	--replication-concurrency
+	                      Maximum concurrent object transfers per destination storage deployment. Falls back to value from environment.
+	--replication-workers Number of replication job workers. Falls back to value from environment.
+	--allow-storage-restart
+	                      Allow restarting MinIO deployments that cannot apply FaDO's notification target dynamically.
+	--gateway             Serve function invocations at /invoke/<bucket>/<path>, without going through Caddy.
+	--format              Format of exported configurations, json or yaml. Falls back to "json".
+	--output, -o          File to write exported configurations to. Falls back to standard output.
     --help, -h            Display this information.
 
 Environment variables:
 
-    FADO_CONFIG           Path to initial configuration JSON file. Falls back to "./config.json".
+    FADO_CONFIG           Path to configuration JSON or YAML file. Falls back to "./config.json".
+	FADO_PRUNE            Set to "true" to remove what is dropped from the configuration file. Falls back to "false".
 	FADO_DATABASE         Database connection string.
 	FADO_SERVER_URL       Server URL.
 	FADO_CADDY_ADMIN_URL  Caddy admin managment endpoint.
-	FADO_LB_ENDPOINT      Load balander endpoint.`)
+	FADO_LB_ENDPOINT      Load balander endpoint.
+	FADO_REPLICATION_CONCURRENCY
+	                      Maximum concurrent object transfers per destination storage deployment. Falls back to 4.
+	FADO_REPLICATION_WORKERS
+	                      Number of replication job workers. Falls back to 4.
+	FADO_ALLOW_STORAGE_RESTART
+	                      Set to "true" to allow restarting MinIO deployments. Falls back to "false".
+	FADO_GATEWAY          Set to "true" to serve function invocations. Falls back to "false".`)
+}
+
+func parseInt(value, name string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("ERROR: Expected an integer for '%v', got '%v'.", name, value)
+		PrintHelp()
+		os.Exit(1)
+	}
+	return n
 }
 
 type CliInput struct {
+	Command, ExportFormat, ExportOutput string
 	ConfigFilePath, DatabaseConnectionString, ServerURL, CaddyAdminURL, LBDomain, LBPort string
+	ReplicationConcurrency, ReplicationWorkers int
+	AllowStorageRestart, Gateway, Prune bool
 }
 
 var Input CliInput
@@ -52,6 +89,22 @@ func ReadInput() (i CliInput) {
 			nextVal = "lb-domain"
 		} else if a == "--lb-port" {
 			nextVal = "lb-port"
+		} else if a == "--replication-concurrency" {
+			nextVal = "replication-concurrency"
+		} else if a == "--replication-workers" {
+			nextVal = "replication-workers"
+		} else if a == "--allow-storage-restart" {
+			i.AllowStorageRestart = true
+		} else if a == "--gateway" {
+			i.Gateway = true
+		} else if a == "--prune" {
+			i.Prune = true
+		} else if a == "--format" {
+			nextVal = "format"
+		} else if a == "--output" || a == "-o" {
+			nextVal = "output"
+		} else if a == "export" && nextVal == "" && i.Command == "" {
+			i.Command = a
 		} else if a == "--help" || a == "-h" {
 			PrintHelp()
 			os.Exit(0)
@@ -73,6 +126,18 @@ func ReadInput() (i CliInput) {
 		} else if nextVal == "lb-port" {
 			i.LBPort = a
 			nextVal = ""
+		} else if nextVal == "replication-concurrency" {
+			i.ReplicationConcurrency = parseInt(a, nextVal)
+			nextVal = ""
+		} else if nextVal == "replication-workers" {
+			i.ReplicationWorkers = parseInt(a, nextVal)
+			nextVal = ""
+		} else if nextVal == "format" {
+			i.ExportFormat = a
+			nextVal = ""
+		} else if nextVal == "output" {
+			i.ExportOutput = a
+			nextVal = ""
 		} else {
 			problemArgument := a
 			if nextVal != "" { problemArgument = nextVal }
@@ -107,6 +172,22 @@ func ReadInput() (i CliInput) {
 	if i.LBPort == "" { i.LBPort = os.Getenv("FADO_LB_PORT") }
 	if i.LBPort == "" { i.LBPort = "443" }
 
+	if i.ReplicationConcurrency == 0 && os.Getenv("FADO_REPLICATION_CONCURRENCY") != "" {
+		i.ReplicationConcurrency = parseInt(os.Getenv("FADO_REPLICATION_CONCURRENCY"), "FADO_REPLICATION_CONCURRENCY")
+	}
+	if i.ReplicationConcurrency < 1 { i.ReplicationConcurrency = 4 }
+
+	if i.ReplicationWorkers == 0 && os.Getenv("FADO_REPLICATION_WORKERS") != "" {
+		i.ReplicationWorkers = parseInt(os.Getenv("FADO_REPLICATION_WORKERS"), "FADO_REPLICATION_WORKERS")
+	}
+	if i.ReplicationWorkers < 1 { i.ReplicationWorkers = 4 }
+
+	if !i.AllowStorageRestart { i.AllowStorageRestart = os.Getenv("FADO_ALLOW_STORAGE_RESTART") == "true" }
+
+	if !i.Gateway { i.Gateway = os.Getenv("FADO_GATEWAY") == "true" }
+
+	if !i.Prune { i.Prune = os.Getenv("FADO_PRUNE") == "true" }
+
 	Input = i
 
 	return
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Load balancer settings carried by exported configurations, whether set or
+// not. Other global policies are only exported where set, and those FaDO
+// maintains itself never are.
+var exportedGlobalPolicies = append([]string{"lb_policy", "lb_policy_params", "lb_match_header", "lb_object_header", "lb_object_query_param", "lb_object_routes_max", "lb_latency_window", "lb_latency_refresh_interval", "lb_latency_max_weight"}, mutations.HealthCheckPolicies...)
+
+// Describes the current topology as a configuration that can be applied to
+// another FaDO to recreate it. Optional policies are only included where set.
+func Export(conn database.DBConn) (pc ServerConfiguration, err error) {
+	policies, err := database.QueryPolicies(conn, "SELECT * FROM policies")
+	if err != nil { return pc, util.ProcessErr(err) }
+	policyNames := make(map[int64]string)
+	for _, p := range policies { policyNames[p.PolicyID] = p.Name }
+
+	clusters, err := database.QueryClusters(conn, "SELECT * FROM clusters ORDER BY name")
+	if err != nil { return pc, util.ProcessErr(err) }
+	clusterNames := make(map[int64]string)
+	pc.Clusters = []ClusterConfiguration{}
+	for _, c := range clusters {
+		clusterNames[c.ClusterID] = c.Name
+		cc := ClusterConfiguration{Name: c.Name}
+		if _, err = database.GetClusterPolicy(conn, c, "zones", &cc.Zones); err != nil {
+			return pc, util.ProcessErr(err)
+		}
+		var domains map[string]string
+		if set, err := database.GetClusterPolicy(conn, c, "failure_domains", &domains); err != nil {
+			return pc, util.ProcessErr(err)
+		} else if set { cc.FailureDomains = domains }
+		if cc.Policies, err = exportClusterPolicies(conn, c, policyNames); err != nil {
+			return pc, util.ProcessErr(err)
+		}
+		pc.Clusters = append(pc.Clusters, cc)
+	}
+
+	faasDeployments, err := database.QueryFaaSDeployments(conn, "SELECT * FROM faas_deployments ORDER BY url")
+	if err != nil { return pc, util.ProcessErr(err) }
+	pc.FaaSDeployments = []FaaSDeploymentConfiguration{}
+	for _, fd := range faasDeployments {
+		fdc := FaaSDeploymentConfiguration{ClusterName: clusterNames[fd.ClusterID], URL: fd.URL}
+		if fdc.Policies, err = exportFaaSDeploymentPolicies(conn, fd, policyNames); err != nil {
+			return pc, util.ProcessErr(err)
+		}
+		pc.FaaSDeployments = append(pc.FaaSDeployments, fdc)
+	}
+
+	storageDeployments, err := database.QueryStorageDeployments(conn, "SELECT * FROM storage_deployments ORDER BY alias")
+	if err != nil { return pc, util.ProcessErr(err) }
+	storageAliases := make(map[int64]string)
+	pc.StorageDeployments = []StorageDeploymentConfiguration{}
+	for _, sd := range storageDeployments {
+		storageAliases[sd.StorageID] = sd.Alias
+		sdc := StorageDeploymentConfiguration{ClusterName: clusterNames[sd.ClusterID], Alias: sd.Alias, Endpoint: sd.Endpoint, AccessKey: sd.AccessKey, SecretKey: sd.SecretKey, UseSSL: sd.UseSSL, ManagementURL: sd.ManagementURL, Kind: sd.Kind}
+		var domains map[string]string
+		if set, err := database.GetStorageDeploymentPolicy(conn, sd, "failure_domains", &domains); err != nil {
+			return pc, util.ProcessErr(err)
+		} else if set { sdc.FailureDomains = domains }
+		pc.StorageDeployments = append(pc.StorageDeployments, sdc)
+	}
+
+	buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets ORDER BY name")
+	if err != nil { return pc, util.ProcessErr(err) }
+	pc.Buckets = []BucketConfiguration{}
+	for _, b := range buckets {
+		if bc, err := exportBucket(conn, b, storageAliases); err != nil {
+			return pc, util.ProcessErr(err)
+		} else {
+			pc.Buckets = append(pc.Buckets, bc)
+		}
+	}
+
+	var deniedClusters []string
+	if err = database.GetGlobalPolicy(conn, "replication_denied_clusters", &deniedClusters); err != nil {
+		return pc, util.ProcessErr(err)
+	}
+	if len(deniedClusters) > 0 { pc.ReplicationDeniedClusters = deniedClusters }
+
+	globalPolicies, err := database.QueryGlobalPolicies(conn, "SELECT * FROM global_policies")
+	if err != nil { return pc, util.ProcessErr(err) }
+	globalPolicyNames := append([]string{}, exportedGlobalPolicies...)
+	for _, gp := range globalPolicies {
+		if _, ok := reservedGlobalPolicies[policyNames[gp.PolicyID]]; !ok {
+			globalPolicyNames = util.AddString(globalPolicyNames, policyNames[gp.PolicyID])
+		}
+	}
+
+	pc.GlobalPolicies = make(map[string]interface{})
+	for _, name := range globalPolicyNames {
+		var value interface{}
+		if err = database.GetGlobalPolicy(conn, name, &value); err != nil {
+			return pc, util.ProcessErr(err)
+		}
+		pc.GlobalPolicies[name] = value
+	}
+
+	var routeOverrides map[string]database.LoadBalancerRouteSettings
+	if err = database.GetGlobalPolicy(conn, "lb_route_overrides", &routeOverrides); err != nil {
+		return pc, util.ProcessErr(err)
+	}
+	if len(routeOverrides) > 0 { pc.RouteOverrides = routeOverrides }
+
+	return
+}
+
+func exportBucket(conn database.DBConn, b database.BucketRecord, storageAliases map[int64]string) (bc BucketConfiguration, err error) {
+	bc = BucketConfiguration{Name: b.Name, StorageDeploymentAlias: storageAliases[b.StorageID]}
+
+	if _, err = database.GetBucketPolicy(conn, b, "zones", &bc.AllowedZones); err != nil {
+		return bc, util.ProcessErr(err)
+	}
+	if _, err = database.GetBucketPolicy(conn, b, "target_replica_count", &bc.TargetReplicaCount); err != nil {
+		return bc, util.ProcessErr(err)
+	}
+
+	var deniedZones []string
+	if set, err := database.GetBucketPolicy(conn, b, "denied_zones", &deniedZones); err != nil {
+		return bc, util.ProcessErr(err)
+	} else if set { bc.DeniedZones = deniedZones }
+
+	var rules []database.ReplicationRule
+	if set, err := database.GetBucketPolicy(conn, b, "replication_rules", &rules); err != nil {
+		return bc, util.ProcessErr(err)
+	} else if set { bc.ReplicationRules = rules }
+
+	var constraints []database.SpreadConstraint
+	if set, err := database.GetBucketPolicy(conn, b, "spread_constraints", &constraints); err != nil {
+		return bc, util.ProcessErr(err)
+	} else if set { bc.SpreadConstraints = constraints }
+
+	var replicaLocations []int64
+	if _, err = database.GetBucketPolicy(conn, b, "replica_locations", &replicaLocations); err != nil {
+		return bc, util.ProcessErr(err)
+	}
+	for _, id := range replicaLocations {
+		if alias, ok := storageAliases[id]; ok { bc.ReplicaLocations = append(bc.ReplicaLocations, alias) }
+	}
+
+	return
+}
+
+// Encodes the configuration as JSON or YAML, with the fields in the order
+// they are declared either way.
+func Marshal(pc ServerConfiguration, format string) (data []byte, err error) {
+	data, err = json.MarshalIndent(pc, "", "  ")
+	if err != nil { return data, util.ProcessErr(err) }
+
+	switch format {
+	case "json", "":
+		return append(data, '\n'), nil
+	case "yaml", "yml":
+		// JSON is YAML, parsing it keeps the order of the keys, only the
+		// styles need resetting to get block YAML out.
+		var node yaml.Node
+		if err = yaml.Unmarshal(data, &node); err != nil { return data, util.ProcessErr(err) }
+		resetStyle(&node)
+
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err = encoder.Encode(&node); err != nil { return data, util.ProcessErr(err) }
+		return buf.Bytes(), util.ProcessErr(encoder.Close())
+	default:
+		return nil, util.ProcessErr(fmt.Errorf("Unknown configuration format '%v', expected json or yaml.", format))
+	}
+}
+
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content { resetStyle(n) }
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ${NAME} is replaced with the environment variable, $$ escapes a dollar sign.
+var envReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Values of the form file:<path> are replaced with the file's content, so
+// secrets can be mounted rather than written into the configuration.
+const fileReferencePrefix = "file:"
+
+// Resolves the references in every string of the document. Relative file
+// references are taken from the configuration file's directory.
+func interpolate(value interface{}, path, baseDir string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			resolved, err := interpolate(item, joinPath(path, key), baseDir)
+			if err != nil { return nil, err }
+			v[key] = resolved
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			resolved, err := interpolate(item, joinPath(path, fmt.Sprint(key)), baseDir)
+			if err != nil { return nil, err }
+			m[fmt.Sprint(key)] = resolved
+		}
+		return m, nil
+	case []interface{}:
+		for i, item := range v {
+			resolved, err := interpolate(item, fmt.Sprintf("%v[%v]", path, i), baseDir)
+			if err != nil { return nil, err }
+			v[i] = resolved
+		}
+		return v, nil
+	case string:
+		return interpolateString(v, path, baseDir)
+	default:
+		return v, nil
+	}
+}
+
+func interpolateString(s, path, baseDir string) (string, error) {
+	var missing []string
+	s = envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" { return "$" }
+		name := ref[2:len(ref)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok { missing = append(missing, name) }
+		return value
+	})
+	if len(missing) > 0 {
+		return s, ValidationErrors{{Path: path, Message: fmt.Sprintf("environment variable %v is not set", strings.Join(missing, ", "))}}
+	}
+
+	if !strings.HasPrefix(s, fileReferencePrefix) { return s, nil }
+
+	filePath := strings.TrimPrefix(s, fileReferencePrefix)
+	if !filepath.IsAbs(filePath) { filePath = filepath.Join(baseDir, filePath) }
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return s, ValidationErrors{{Path: path, Message: fmt.Sprintf("could not read %v: %v", filePath, err)}}
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" { return key }
+	return path + "." + key
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolateString(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(baseDir, "secret_key"), []byte("s3cr3t\n"), 0600); err != nil { t.Fatal(err) }
+	absolute := filepath.Join(t.TempDir(), "access_key")
+	if err := os.WriteFile(absolute, []byte("minioadmin"), 0600); err != nil { t.Fatal(err) }
+	t.Setenv("FADO_TEST_HOST", "minio-eu")
+	t.Setenv("FADO_TEST_PORT", "9000")
+	t.Setenv("FADO_TEST_SECRET_FILE", "secret_key")
+
+	tests := []struct {
+		name string
+		value string
+		want string
+		wantErr bool
+	}{
+		{"plain", "minio-eu:9000", "minio-eu:9000", false},
+		{"environment variables", "${FADO_TEST_HOST}:${FADO_TEST_PORT}", "minio-eu:9000", false},
+		{"escaped dollar", "$${FADO_TEST_HOST} costs $$5", "${FADO_TEST_HOST} costs $5", false},
+		{"bare dollar left alone", "$FADO_TEST_HOST", "$FADO_TEST_HOST", false},
+		{"unset environment variable", "${FADO_TEST_UNSET}", "", true},
+		{"relative file", "file:secret_key", "s3cr3t", false},
+		{"absolute file", "file:" + absolute, "minioadmin", false},
+		{"file named by an environment variable", "file:${FADO_TEST_SECRET_FILE}", "s3cr3t", false},
+		{"missing file", "file:missing", "", true},
+		{"file prefix mid-string", "see file:secret_key", "see file:secret_key", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolateString(tt.value, "storage_deployments[0].secret_key", baseDir)
+			if tt.wantErr {
+				var ves ValidationErrors
+				if !errors.As(err, &ves) || len(ves) != 1 || ves[0].Path != "storage_deployments[0].secret_key" {
+					t.Errorf("interpolateString(%q) error = %v, want one at storage_deployments[0].secret_key", tt.value, err)
+				}
+				return
+			}
+			if err != nil { t.Fatalf("interpolateString(%q) = %v", tt.value, err) }
+			if got != tt.want { t.Errorf("interpolateString(%q) = %q, want %q", tt.value, got, tt.want) }
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("FADO_TEST_HOST", "minio-eu")
+
+	tests := []struct {
+		name string
+		document interface{}
+		want interface{}
+		wantPath string
+	}{
+		{
+			"nested",
+			map[string]interface{}{"storage_deployments": []interface{}{map[string]interface{}{"endpoint": "${FADO_TEST_HOST}:9000", "use_ssl": true}}},
+			map[string]interface{}{"storage_deployments": []interface{}{map[string]interface{}{"endpoint": "minio-eu:9000", "use_ssl": true}}},
+			"",
+		},
+		{
+			"YAML maps get string keys",
+			map[interface{}]interface{}{"clusters": []interface{}{map[interface{}]interface{}{"name": "${FADO_TEST_HOST}"}}},
+			map[string]interface{}{"clusters": []interface{}{map[string]interface{}{"name": "minio-eu"}}},
+			"",
+		},
+		{
+			"error path",
+			map[string]interface{}{"buckets": []interface{}{map[string]interface{}{"name": "meow"}, map[string]interface{}{"name": "${FADO_TEST_UNSET}"}}},
+			nil,
+			"buckets[1].name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolate(tt.document, "", t.TempDir())
+			if tt.wantPath != "" {
+				var ves ValidationErrors
+				if !errors.As(err, &ves) || len(ves) != 1 || ves[0].Path != tt.wantPath { t.Errorf("interpolate error = %v, want one at %v", err, tt.wantPath) }
+				return
+			}
+			if err != nil { t.Fatalf("interpolate = %v", err) }
+			if !reflect.DeepEqual(got, tt.want) { t.Errorf("interpolate = %v, want %v", got, tt.want) }
+		})
+	}
+}
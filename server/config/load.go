@@ -1,93 +1,87 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/smithyworks/FaDO/database"
-	"github.com/smithyworks/FaDO/mutations"
 	"github.com/smithyworks/FaDO/util"
+	"gopkg.in/yaml.v3"
 )
 
 var ctx = context.Background()
 
+// Reads a JSON or, judging by its extension, YAML configuration file.
+// References to environment variables and files are resolved before the
+// document is validated.
 func ReadConfigurationFile(filePath string) (pc ServerConfiguration, err error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil { return pc, util.ProcessErr(err) }
 
-	err = json.Unmarshal(data, &pc)
-
-	return
-}
-
-func LoadConfigFromFile(configFilePath string) (err error) {
-	tx, err := database.Begin()
-	if err != nil { return util.ProcessErr(err) }
-	defer tx.Rollback(ctx)
-
-	pc, err := ReadConfigurationFile(configFilePath)
-	if err != nil { return util.ProcessErr(err) }
-
-	if len(pc.Clusters) < 1 { return util.ProcessErr(fmt.Errorf("Configuration invalid, no clusters were defined.")) }
-
-	for _, c := range pc.Clusters {
-		if !c.IsValid() { return util.ProcessErr(fmt.Errorf("Cluster configuration is invalid. %+v", c)) }
-
-		if err = mutations.AddCluster(tx, database.ClusterRecord{Name: c.Name}, c.Zones); err != nil {
-			return util.ProcessErr(err)
+	var document interface{}
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yaml", ".yml":
+		if err = yaml.Unmarshal(data, &document); err != nil {
+			return pc, util.ProcessErr(fmt.Errorf("Could not parse %v: %w", filePath, err))
+		}
+	default:
+		if err = json.Unmarshal(data, &document); err != nil {
+			return pc, util.ProcessErr(fmt.Errorf("Could not parse %v: %w", filePath, err))
 		}
 	}
 
-	for _, f := range pc.FaaSDeployments {
-		if !f.IsValid() { return util.ProcessErr(fmt.Errorf("FaaS deployment configuration is invalid. %+v", f)) }
-
-		newFaaSRecord := database.FaaSDeploymentRecord{URL: f.URL}
-		if cluster, err := database.QueryClusterRow(tx, "SELECT * FROM clusters WHERE name = $1", f.ClusterName); err != nil {
-			return util.ProcessErr(err)
-		} else {
-			newFaaSRecord.ClusterID = cluster.ClusterID
-		}
+	if document, err = interpolate(document, "", filepath.Dir(filePath)); err != nil {
+		return pc, util.ProcessErr(err)
+	}
 
-		if err = mutations.AddFaaSDeployment(tx, newFaaSRecord); err != nil {
-			return util.ProcessErr(err)
-		}
+	// Decoded through JSON, so the json tags are the only field names.
+	data, err = json.Marshal(document)
+	if err != nil { return pc, util.ProcessErr(err) }
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&pc); err != nil {
+		return pc, util.ProcessErr(decodeError(err))
 	}
 
-	for _, s := range pc.StorageDeployments {
-		if !s.IsValid() { return util.ProcessErr(fmt.Errorf("Storage Deployment configuration is invalid. %+v", s)) }
+	if err = pc.Validate(); err != nil { return pc, util.ProcessErr(err) }
 
-		newStorageRecord := database.StorageDeploymentRecord{Alias: s.Alias, Endpoint: s.Endpoint, AccessKey: s.AccessKey, SecretKey: s.SecretKey, UseSSL: s.UseSSL, ManagementURL: s.ManagementURL}
-		if cluster, err := database.QueryClusterRow(tx, "SELECT * FROM clusters WHERE name = $1", s.ClusterName); err != nil {
-			return util.ProcessErr(err)
-		} else {
-			newStorageRecord.ClusterID = cluster.ClusterID
-		}
+	return
+}
 
-		if err = mutations.AddStorageDeployment(tx, newStorageRecord); err != nil {
-			return util.ProcessErr(err)
-		}
+// Points type mismatches at the offending field.
+func decodeError(err error) error {
+	var ute *json.UnmarshalTypeError
+	if errors.As(err, &ute) && ute.Field != "" {
+		path := regexp.MustCompile(`\.(\d+)`).ReplaceAllString(ute.Field, "[$1]")
+		return ValidationErrors{{Path: path, Message: fmt.Sprintf("expected %v, got %v", ute.Type, ute.Value)}}
 	}
+	return ValidationErrors{{Message: strings.TrimPrefix(err.Error(), "json: ")}}
+}
 
-	for _, b := range pc.Buckets {
-		if !b.IsValid() { return util.ProcessErr(fmt.Errorf("Bucket configuration is invalid. %+v", b)) }
+// Brings the database in line with the configuration file, in a single
+// transaction. Nothing is changed if any part of it fails.
+func ReconcileConfigFile(configFilePath string, prune bool) (summary ChangeSummary, err error) {
+	pc, err := ReadConfigurationFile(configFilePath)
+	if err != nil { return summary, util.ProcessErr(err) }
 
-		newBucketRecord := database.BucketRecord{Name: b.Name}
-		if storageDeployement, err := database.QueryStorageDeploymentRow(tx, "SELECT * FROM storage_deployments WHERE alias = $1", b.StorageDeploymentAlias); err != nil {
-			return util.ProcessErr(err)
-		} else {
-			newBucketRecord.StorageID = storageDeployement.StorageID
-		}
+	tx, err := database.Begin()
+	if err != nil { return summary, util.ProcessErr(err) }
+	defer tx.Rollback(ctx)
 
-		if err = mutations.AddMasterBucket(tx, newBucketRecord, b.TargetReplicaCount, b.AllowedZones, []int64{}); err != nil {
-			return util.ProcessErr(err)
-		}
+	if summary, err = Reconcile(tx, pc, prune); err != nil {
+		return summary, util.ProcessErr(err)
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return util.ProcessErr(err)
+		return summary, util.ProcessErr(err)
 	}
 
 	return
-}
\ No newline at end of file
+}
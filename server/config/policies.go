@@ -0,0 +1,200 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Global policies FaDO maintains itself, or that have a field of their own.
+var reservedGlobalPolicies = map[string]string{
+	"lb_upstreams": "is maintained by FaDO",
+	"lb_routes": "is maintained by FaDO",
+	"lb_object_routes": "is maintained by FaDO",
+	"lb_route_overrides": "is set with route_overrides",
+	"caddy_config": "is maintained by FaDO",
+	"config_managed": "is maintained by FaDO",
+	"replication_denied_clusters": "is set with replication_denied_clusters",
+}
+
+var reservedClusterPolicies = map[string]string{
+	"zones": "is set with zones",
+	"failure_domains": "is set with failure_domains",
+}
+
+func (v *validator) policies(path string, policies map[string]interface{}, reserved map[string]string) {
+	for name := range policies {
+		if reason, ok := reserved[name]; ok { v.errorf(fmt.Sprintf("%v.%v", path, name), "%v", reason) }
+	}
+}
+
+// The default selection policy is checked together with the parameters set
+// alongside it.
+func (v *validator) selectionPolicy(path string, policies map[string]interface{}) {
+	value, exists := policies["lb_policy"]
+	if !exists { return }
+
+	var policy string
+	var params *database.SelectionPolicyParams
+	valueBytes, err := json.Marshal(value)
+	if err == nil { err = json.Unmarshal(valueBytes, &policy) }
+	if err == nil && policies["lb_policy_params"] != nil {
+		if valueBytes, err = json.Marshal(policies["lb_policy_params"]); err == nil { err = json.Unmarshal(valueBytes, &params) }
+	}
+	if err != nil { v.errorf(path + ".lb_policy", "%v", err); return }
+
+	v.check(path + ".lb_policy", mutations.ValidateSelectionPolicy(policy, params))
+}
+
+// Policies can only be checked against those the database knows of.
+func validatePolicyNames(conn database.DBConn, pc ServerConfiguration) (err error) {
+	policies, err := database.QueryPolicies(conn, "SELECT * FROM policies")
+	if err != nil { return util.ProcessErr(err) }
+	known := make(map[string]bool)
+	for _, p := range policies { known[p.Name] = true }
+
+	v := &validator{}
+	for name := range pc.GlobalPolicies {
+		if !known[name] { v.errorf("global_policies." + name, "unknown policy") }
+	}
+	for i, c := range pc.Clusters {
+		for name := range c.Policies {
+			if !known[name] { v.errorf(fmt.Sprintf("clusters[%v].policies.%v", i, name), "unknown policy") }
+		}
+	}
+
+	if len(v.errs) > 0 { return util.ProcessErr(v.errs) }
+
+	return
+}
+
+// Sets the global policies that differ, returning whether any did.
+func reconcileGlobalPolicies(conn database.DBConn, policies map[string]interface{}, summary *ChangeSummary) (changed bool, err error) {
+	for _, name := range sortedPolicyNames(policies) {
+		var current interface{}
+		if err = database.GetGlobalPolicy(conn, name, &current); err != nil {
+			return changed, util.ProcessErr(err)
+		}
+		if reflect.DeepEqual(current, policies[name]) { continue }
+
+		if err = database.SetGlobalPolicy(conn, name, policies[name]); err != nil {
+			return changed, util.ProcessErr(err)
+		}
+		summary.Updated = append(summary.Updated, fmt.Sprintf("global policy %v", name))
+		changed = true
+	}
+
+	return
+}
+
+func reconcileClusterPolicies(conn database.DBConn, cluster database.ClusterRecord, policies map[string]interface{}) (changed bool, err error) {
+	for _, name := range sortedPolicyNames(policies) {
+		var current interface{}
+		if _, err = database.GetClusterPolicy(conn, cluster, name, &current); err != nil {
+			return changed, util.ProcessErr(err)
+		}
+		if reflect.DeepEqual(current, policies[name]) { continue }
+
+		if err = database.SetClusterPolicy(conn, cluster, name, policies[name]); err != nil {
+			return changed, util.ProcessErr(err)
+		}
+		changed = true
+	}
+
+	return
+}
+
+// Null values remove the override, falling back to the global policy.
+func reconcileFaaSDeploymentPolicies(conn database.DBConn, fd database.FaaSDeploymentRecord, policies map[string]interface{}) (changed bool, err error) {
+	for _, name := range sortedPolicyNames(policies) {
+		var current interface{}
+		set, err := database.GetFaaSDeploymentPolicy(conn, fd, name, &current)
+		if err != nil { return changed, util.ProcessErr(err) }
+
+		if policies[name] == nil {
+			if !set { continue }
+			err = database.DeleteFaaSDeploymentPolicy(conn, fd, name)
+		} else {
+			if set && reflect.DeepEqual(current, policies[name]) { continue }
+			err = database.SetFaaSDeploymentPolicy(conn, fd, name, policies[name])
+		}
+		if err != nil { return changed, util.ProcessErr(err) }
+		changed = true
+	}
+
+	return
+}
+
+// Exports the policies explicitly set on the FaaS deployment.
+func exportFaaSDeploymentPolicies(conn database.DBConn, fd database.FaaSDeploymentRecord, policyNames map[int64]string) (policies map[string]interface{}, err error) {
+	faasPolicies, err := database.QueryFaaSDeploymentsPolicies(conn, "SELECT * FROM faas_deployments_policies WHERE faas_id = $1", fd.FaaSID)
+	if err != nil { return policies, util.ProcessErr(err) }
+
+	for _, fp := range faasPolicies {
+		name := policyNames[fp.PolicyID]
+		if name == "" { continue }
+
+		var value interface{}
+		if _, err = database.GetFaaSDeploymentPolicy(conn, fd, name, &value); err != nil {
+			return policies, util.ProcessErr(err)
+		}
+		if policies == nil { policies = make(map[string]interface{}) }
+		policies[name] = value
+	}
+
+	return
+}
+
+// Overrides are keyed by bucket name, which the settings repeat.
+func reconcileRouteOverrides(conn database.DBConn, routeOverrides map[string]database.LoadBalancerRouteSettings, summary *ChangeSummary) (changed bool, err error) {
+	desired := make(map[string]database.LoadBalancerRouteSettings)
+	for bucketName, settings := range routeOverrides {
+		settings.BucketName = bucketName
+		desired[bucketName] = settings
+	}
+
+	var current map[string]database.LoadBalancerRouteSettings
+	if err = database.GetGlobalPolicy(conn, "lb_route_overrides", &current); err != nil {
+		return changed, util.ProcessErr(err)
+	}
+	if reflect.DeepEqual(current, desired) { return }
+
+	if err = database.SetGlobalPolicy(conn, "lb_route_overrides", desired); err != nil {
+		return changed, util.ProcessErr(err)
+	}
+	summary.Updated = append(summary.Updated, "route overrides")
+
+	return true, nil
+}
+
+// Exports the policies explicitly set on the cluster, other than those with a
+// field of their own.
+func exportClusterPolicies(conn database.DBConn, cluster database.ClusterRecord, policyNames map[int64]string) (policies map[string]interface{}, err error) {
+	clusterPolicies, err := database.QueryClustersPolicies(conn, "SELECT * FROM clusters_policies WHERE cluster_id = $1", cluster.ClusterID)
+	if err != nil { return policies, util.ProcessErr(err) }
+
+	for _, cp := range clusterPolicies {
+		name := policyNames[cp.PolicyID]
+		if _, ok := reservedClusterPolicies[name]; ok || name == "" { continue }
+
+		var value interface{}
+		if _, err = database.GetClusterPolicy(conn, cluster, name, &value); err != nil {
+			return policies, util.ProcessErr(err)
+		}
+		if policies == nil { policies = make(map[string]interface{}) }
+		policies[name] = value
+	}
+
+	return
+}
+
+func sortedPolicyNames(policies map[string]interface{}) (names []string) {
+	for name := range policies { names = append(names, name) }
+	sort.Strings(names)
+	return
+}
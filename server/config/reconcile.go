@@ -0,0 +1,447 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// What reconciling the configuration changed, one entry per resource.
+type ChangeSummary struct {
+	Added []string `json:"added"`
+	Updated []string `json:"updated"`
+	Removed []string `json:"removed"`
+}
+
+func (cs *ChangeSummary) IsEmpty() bool {
+	return len(cs.Added) == 0 && len(cs.Updated) == 0 && len(cs.Removed) == 0
+}
+
+func (cs *ChangeSummary) Log() {
+	if cs.IsEmpty() {
+		log.Printf("INFO: Configuration is up to date, nothing changed.")
+		return
+	}
+
+	for _, r := range cs.Added { log.Printf("INFO: Configuration added %v.", r) }
+	for _, r := range cs.Updated { log.Printf("INFO: Configuration updated %v.", r) }
+	for _, r := range cs.Removed { log.Printf("INFO: Configuration removed %v.", r) }
+	log.Printf("INFO: Configuration applied, %v added, %v updated, %v removed.", len(cs.Added), len(cs.Updated), len(cs.Removed))
+}
+
+// The resources declared by the configuration, kept in the config_managed
+// global policy. Only those are ever pruned, so resources added through the
+// API or found on storage deployments are left alone.
+type managedResources struct {
+	Clusters []string `json:"clusters"`
+	FaaSDeployments []string `json:"faas_deployments"`
+	StorageDeployments []string `json:"storage_deployments"`
+	Buckets []string `json:"buckets"`
+}
+
+func (pc *ServerConfiguration) managedResources() (mr managedResources) {
+	mr = managedResources{Clusters: []string{}, FaaSDeployments: []string{}, StorageDeployments: []string{}, Buckets: []string{}}
+	for _, c := range pc.Clusters { mr.Clusters = util.AddString(mr.Clusters, c.Name) }
+	for _, f := range pc.FaaSDeployments { mr.FaaSDeployments = util.AddString(mr.FaaSDeployments, f.URL) }
+	for _, s := range pc.StorageDeployments { mr.StorageDeployments = util.AddString(mr.StorageDeployments, s.Alias) }
+	for _, b := range pc.Buckets { mr.Buckets = util.AddString(mr.Buckets, b.Name) }
+	return
+}
+
+// The resources managed either way.
+func (mr managedResources) union(other managedResources) managedResources {
+	for _, name := range other.Clusters { mr.Clusters = util.AddString(mr.Clusters, name) }
+	for _, url := range other.FaaSDeployments { mr.FaaSDeployments = util.AddString(mr.FaaSDeployments, url) }
+	for _, alias := range other.StorageDeployments { mr.StorageDeployments = util.AddString(mr.StorageDeployments, alias) }
+	for _, name := range other.Buckets { mr.Buckets = util.AddString(mr.Buckets, name) }
+	return mr
+}
+
+// The resources managed here but no longer in current, those to prune.
+func (mr managedResources) without(current managedResources) (dropped managedResources) {
+	for _, name := range mr.Clusters {
+		if !util.HasString(current.Clusters, name) { dropped.Clusters = append(dropped.Clusters, name) }
+	}
+	for _, url := range mr.FaaSDeployments {
+		if !util.HasString(current.FaaSDeployments, url) { dropped.FaaSDeployments = append(dropped.FaaSDeployments, url) }
+	}
+	for _, alias := range mr.StorageDeployments {
+		if !util.HasString(current.StorageDeployments, alias) { dropped.StorageDeployments = append(dropped.StorageDeployments, alias) }
+	}
+	for _, name := range mr.Buckets {
+		if !util.HasString(current.Buckets, name) { dropped.Buckets = append(dropped.Buckets, name) }
+	}
+	return
+}
+
+// Treats the configuration as the desired state: declared resources missing
+// from the database are added, those that differ are updated and, if prune is
+// set, resources dropped from the configuration since it was last applied are
+// removed. Storage deployments and clusters are removed without deleting their
+// data, buckets are deleted along with it.
+func Reconcile(conn database.DBConn, pc ServerConfiguration, prune bool) (summary ChangeSummary, err error) {
+	if err = pc.Validate(); err != nil { return summary, util.ProcessErr(err) }
+	if err = validatePolicyNames(conn, pc); err != nil { return summary, util.ProcessErr(err) }
+
+	var previous managedResources
+	if err = database.GetGlobalPolicy(conn, "config_managed", &previous); err != nil {
+		return summary, util.ProcessErr(err)
+	}
+	current := pc.managedResources()
+
+	if prune {
+		if err = pruneResources(conn, previous, current, &summary); err != nil {
+			return summary, util.ProcessErr(err)
+		}
+	} else {
+		// Remembered so that they are pruned once pruning is turned on.
+		current = current.union(previous)
+	}
+
+	// Policies are set first, so that everything added after is placed
+	// accordingly, and the replicas of existing buckets are resolved again at
+	// the end.
+	policiesChanged, routesChanged := false, false
+	if pc.GlobalPolicies != nil {
+		if policiesChanged, err = reconcileGlobalPolicies(conn, pc.GlobalPolicies, &summary); err != nil {
+			return summary, util.ProcessErr(err)
+		}
+	}
+
+	for _, c := range pc.Clusters {
+		if changed, err := reconcileCluster(conn, c, &summary); err != nil {
+			return summary, util.ProcessErr(err)
+		} else if changed { policiesChanged = true }
+	}
+
+	if pc.ReplicationDeniedClusters != nil {
+		var deniedClusters []string
+		if err = database.GetGlobalPolicy(conn, "replication_denied_clusters", &deniedClusters); err != nil {
+			return summary, util.ProcessErr(err)
+		}
+		if !reflect.DeepEqual(deniedClusters, pc.ReplicationDeniedClusters) {
+			if err = mutations.SetReplicationDeniedClusters(conn, pc.ReplicationDeniedClusters); err != nil {
+				return summary, util.ProcessErr(err)
+			}
+			summary.Updated = append(summary.Updated, "replication denied clusters")
+		}
+	}
+
+	for _, f := range pc.FaaSDeployments {
+		if changed, err := reconcileFaaSDeployment(conn, f, &summary); err != nil {
+			return summary, util.ProcessErr(err)
+		} else if changed { routesChanged = true }
+	}
+	for _, s := range pc.StorageDeployments {
+		if err = reconcileStorageDeployment(conn, s, &summary); err != nil { return summary, util.ProcessErr(err) }
+	}
+	for _, b := range pc.Buckets {
+		if err = reconcileBucket(conn, b, &summary); err != nil { return summary, util.ProcessErr(err) }
+	}
+
+	if pc.RouteOverrides != nil {
+		if routesChanged, err = reconcileRouteOverrides(conn, pc.RouteOverrides, &summary); err != nil {
+			return summary, util.ProcessErr(err)
+		}
+	}
+
+	if policiesChanged {
+		if err = mutations.ResolveAllBucketReplicas(conn); err != nil { return summary, util.ProcessErr(err) }
+	}
+	if policiesChanged || routesChanged {
+		if err := mutations.ConfigureLoadBalancer(conn); err != nil { util.PrintWarning(err) }
+	}
+
+	if err = database.SetGlobalPolicy(conn, "config_managed", current); err != nil {
+		return summary, util.ProcessErr(err)
+	}
+
+	return
+}
+
+// Removes what was declared last time but no longer is, dependents first.
+func pruneResources(conn database.DBConn, previous, current managedResources, summary *ChangeSummary) (err error) {
+	dropped := previous.without(current)
+
+	for _, name := range dropped.Buckets {
+		buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets WHERE name = $1", name)
+		if err != nil { return util.ProcessErr(err) }
+		for _, b := range buckets {
+			if err = mutations.DeleteMasterBucket(conn, b); err != nil { return util.ProcessErr(err) }
+			summary.Removed = append(summary.Removed, fmt.Sprintf("bucket %v", name))
+		}
+	}
+
+	for _, url := range dropped.FaaSDeployments {
+		faasDeployments, err := database.QueryFaaSDeployments(conn, "SELECT * FROM faas_deployments WHERE url = $1", url)
+		if err != nil { return util.ProcessErr(err) }
+		for _, fd := range faasDeployments {
+			if err = mutations.DeleteFaaSDeployment(conn, fd); err != nil { return util.ProcessErr(err) }
+			summary.Removed = append(summary.Removed, fmt.Sprintf("FaaS deployment %v", url))
+		}
+	}
+
+	for _, alias := range dropped.StorageDeployments {
+		storageDeployments, err := database.QueryStorageDeployments(conn, "SELECT * FROM storage_deployments WHERE alias = $1", alias)
+		if err != nil { return util.ProcessErr(err) }
+		for _, sd := range storageDeployments {
+			if err = mutations.DeleteStorageDeployment(conn, sd, false); err != nil { return util.ProcessErr(err) }
+			summary.Removed = append(summary.Removed, fmt.Sprintf("storage deployment %v", alias))
+		}
+	}
+
+	for _, name := range dropped.Clusters {
+		clusters, err := database.QueryClusters(conn, "SELECT * FROM clusters WHERE name = $1", name)
+		if err != nil { return util.ProcessErr(err) }
+		for _, c := range clusters {
+			if err = mutations.DeleteCluster(conn, c, false); err != nil { return util.ProcessErr(err) }
+			summary.Removed = append(summary.Removed, fmt.Sprintf("cluster %v", name))
+		}
+	}
+
+	return
+}
+
+// Reports whether the cluster's policies changed, other than its zones and
+// failure domains whose changes are applied straight away.
+func reconcileCluster(conn database.DBConn, c ClusterConfiguration, summary *ChangeSummary) (policiesChanged bool, err error) {
+	clusters, err := database.QueryClusters(conn, "SELECT * FROM clusters WHERE name = $1", c.Name)
+	if err != nil { return policiesChanged, util.ProcessErr(err) }
+
+	if len(clusters) == 0 {
+		if err = mutations.AddCluster(conn, database.ClusterRecord{Name: c.Name}, c.Zones); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		var cluster database.ClusterRecord
+		if cluster, err = database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE name = $1", c.Name); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		if c.FailureDomains != nil {
+			if err = mutations.SetClusterFailureDomains(conn, cluster, c.FailureDomains); err != nil {
+				return policiesChanged, util.ProcessErr(err)
+			}
+		}
+		if policiesChanged, err = reconcileClusterPolicies(conn, cluster, c.Policies); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		summary.Added = append(summary.Added, fmt.Sprintf("cluster %v", c.Name))
+		return
+	}
+
+	cluster := clusters[0]
+	updated := false
+
+	var zones []string
+	if _, err = database.GetClusterPolicy(conn, cluster, "zones", &zones); err != nil {
+		return policiesChanged, util.ProcessErr(err)
+	}
+	if !reflect.DeepEqual(zones, c.Zones) {
+		if err = mutations.EditCluster(conn, cluster, c.Zones); err != nil { return policiesChanged, util.ProcessErr(err) }
+		updated = true
+	}
+
+	if c.FailureDomains != nil {
+		var domains map[string]string
+		if _, err = database.GetClusterPolicy(conn, cluster, "failure_domains", &domains); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		if !reflect.DeepEqual(domains, c.FailureDomains) {
+			if err = mutations.SetClusterFailureDomains(conn, cluster, c.FailureDomains); err != nil { return policiesChanged, util.ProcessErr(err) }
+			updated = true
+		}
+	}
+
+	if policiesChanged, err = reconcileClusterPolicies(conn, cluster, c.Policies); err != nil {
+		return policiesChanged, util.ProcessErr(err)
+	}
+
+	if updated || policiesChanged { summary.Updated = append(summary.Updated, fmt.Sprintf("cluster %v", c.Name)) }
+
+	return
+}
+
+func reconcileFaaSDeployment(conn database.DBConn, f FaaSDeploymentConfiguration, summary *ChangeSummary) (policiesChanged bool, err error) {
+	cluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE name = $1", f.ClusterName)
+	if err != nil { return policiesChanged, util.ProcessErr(err) }
+
+	faasDeployments, err := database.QueryFaaSDeployments(conn, "SELECT * FROM faas_deployments WHERE url = $1", f.URL)
+	if err != nil { return policiesChanged, util.ProcessErr(err) }
+
+	updated := false
+	if len(faasDeployments) == 0 {
+		if err = mutations.AddFaaSDeployment(conn, database.FaaSDeploymentRecord{ClusterID: cluster.ClusterID, URL: f.URL}); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		summary.Added = append(summary.Added, fmt.Sprintf("FaaS deployment %v", f.URL))
+	} else if faasDeployments[0].ClusterID != cluster.ClusterID {
+		// FaaS deployments are known by their URL alone, moving one to another
+		// cluster replaces it.
+		if err = mutations.DeleteFaaSDeployment(conn, faasDeployments[0]); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		if err = mutations.AddFaaSDeployment(conn, database.FaaSDeploymentRecord{ClusterID: cluster.ClusterID, URL: f.URL}); err != nil {
+			return policiesChanged, util.ProcessErr(err)
+		}
+		updated = true
+	}
+
+	fd, err := database.QueryFaaSDeploymentRow(conn, "SELECT * FROM faas_deployments WHERE url = $1", f.URL)
+	if err != nil { return policiesChanged, util.ProcessErr(err) }
+	if policiesChanged, err = reconcileFaaSDeploymentPolicies(conn, fd, f.Policies); err != nil {
+		return policiesChanged, util.ProcessErr(err)
+	}
+
+	if (updated || policiesChanged) && len(faasDeployments) > 0 {
+		summary.Updated = append(summary.Updated, fmt.Sprintf("FaaS deployment %v", f.URL))
+	}
+
+	return
+}
+
+func reconcileStorageDeployment(conn database.DBConn, s StorageDeploymentConfiguration, summary *ChangeSummary) (err error) {
+	cluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE name = $1", s.ClusterName)
+	if err != nil { return util.ProcessErr(err) }
+
+	storageDeployments, err := database.QueryStorageDeployments(conn, "SELECT * FROM storage_deployments WHERE alias = $1", s.Alias)
+	if err != nil { return util.ProcessErr(err) }
+
+	updated := false
+	if len(storageDeployments) == 0 {
+		newStorageRecord := database.StorageDeploymentRecord{ClusterID: cluster.ClusterID, Alias: s.Alias, Endpoint: s.Endpoint, AccessKey: s.AccessKey, SecretKey: s.SecretKey, UseSSL: s.UseSSL, ManagementURL: s.ManagementURL, Kind: s.Kind}
+		if err = mutations.AddStorageDeployment(conn, newStorageRecord); err != nil {
+			return util.ProcessErr(err)
+		}
+		summary.Added = append(summary.Added, fmt.Sprintf("storage deployment %v", s.Alias))
+	} else {
+		sd := storageDeployments[0]
+		desired := sd
+		desired.ClusterID, desired.Endpoint, desired.AccessKey, desired.SecretKey = cluster.ClusterID, s.Endpoint, s.AccessKey, s.SecretKey
+		desired.UseSSL, desired.ManagementURL, desired.Kind = s.UseSSL, s.ManagementURL, s.Kind
+		if desired != sd {
+			if err = mutations.EditStorageDeployment(conn, desired); err != nil { return util.ProcessErr(err) }
+			updated = true
+		}
+	}
+
+	if s.FailureDomains != nil {
+		sd, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE alias = $1", s.Alias)
+		if err != nil { return util.ProcessErr(err) }
+
+		var domains map[string]string
+		if _, err = database.GetStorageDeploymentPolicy(conn, sd, "failure_domains", &domains); err != nil {
+			return util.ProcessErr(err)
+		}
+		if !reflect.DeepEqual(domains, s.FailureDomains) {
+			if err = mutations.SetStorageDeploymentFailureDomains(conn, sd, s.FailureDomains); err != nil { return util.ProcessErr(err) }
+			updated = updated || len(storageDeployments) > 0
+		}
+	}
+
+	if updated { summary.Updated = append(summary.Updated, fmt.Sprintf("storage deployment %v", s.Alias)) }
+
+	return
+}
+
+func reconcileBucket(conn database.DBConn, b BucketConfiguration, summary *ChangeSummary) (err error) {
+	sd, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE alias = $1", b.StorageDeploymentAlias)
+	if err != nil { return util.ProcessErr(err) }
+
+	buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets WHERE name = $1", b.Name)
+	if err != nil { return util.ProcessErr(err) }
+
+	var replicaLocations []int64
+	for _, alias := range b.ReplicaLocations {
+		if replica, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE alias = $1", alias); err != nil {
+			return util.ProcessErr(err)
+		} else {
+			replicaLocations = append(replicaLocations, replica.StorageID)
+		}
+	}
+
+	added := len(buckets) == 0
+	if added {
+		if replicaLocations == nil { replicaLocations = []int64{} }
+		if err = mutations.AddMasterBucket(conn, database.BucketRecord{Name: b.Name, StorageID: sd.StorageID}, b.TargetReplicaCount, b.AllowedZones, replicaLocations); err != nil {
+			return util.ProcessErr(err)
+		}
+		summary.Added = append(summary.Added, fmt.Sprintf("bucket %v", b.Name))
+	}
+
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE name = $1", b.Name)
+	if err != nil { return util.ProcessErr(err) }
+
+	updated := false
+	if bucket.StorageID != sd.StorageID {
+		util.PrintWarning(fmt.Errorf("Bucket %v is configured on storage deployment %v but its master is elsewhere, masters are not moved.", b.Name, b.StorageDeploymentAlias))
+	}
+
+	if !added {
+		var zones []string
+		var targetReplicaCount int
+		var currentReplicaLocations []int64
+		if _, err = database.GetBucketPolicy(conn, bucket, "zones", &zones); err != nil {
+			return util.ProcessErr(err)
+		}
+		if _, err = database.GetBucketPolicy(conn, bucket, "target_replica_count", &targetReplicaCount); err != nil {
+			return util.ProcessErr(err)
+		}
+		if _, err = database.GetBucketPolicy(conn, bucket, "replica_locations", &currentReplicaLocations); err != nil {
+			return util.ProcessErr(err)
+		}
+		// Left pinned as they are when omitted.
+		if b.ReplicaLocations == nil { replicaLocations = currentReplicaLocations }
+		if !reflect.DeepEqual(zones, b.AllowedZones) || targetReplicaCount != b.TargetReplicaCount || !sameStorageIDs(currentReplicaLocations, replicaLocations) {
+			if err = mutations.EditMasterBucket(conn, bucket, b.TargetReplicaCount, b.AllowedZones, replicaLocations); err != nil {
+				return util.ProcessErr(err)
+			}
+			updated = true
+		}
+	}
+
+	if b.DeniedZones != nil {
+		var deniedZones []string
+		if _, err = database.GetBucketPolicy(conn, bucket, "denied_zones", &deniedZones); err != nil {
+			return util.ProcessErr(err)
+		}
+		if !reflect.DeepEqual(deniedZones, b.DeniedZones) {
+			if err = mutations.SetBucketDeniedZones(conn, bucket, b.DeniedZones); err != nil { return util.ProcessErr(err) }
+			updated = true
+		}
+	}
+	if b.ReplicationRules != nil {
+		var rules []database.ReplicationRule
+		if _, err = database.GetBucketPolicy(conn, bucket, "replication_rules", &rules); err != nil {
+			return util.ProcessErr(err)
+		}
+		if !reflect.DeepEqual(rules, b.ReplicationRules) {
+			if err = mutations.SetBucketReplicationRules(conn, bucket, b.ReplicationRules); err != nil { return util.ProcessErr(err) }
+			updated = true
+		}
+	}
+	if b.SpreadConstraints != nil {
+		var constraints []database.SpreadConstraint
+		if _, err = database.GetBucketPolicy(conn, bucket, "spread_constraints", &constraints); err != nil {
+			return util.ProcessErr(err)
+		}
+		if !reflect.DeepEqual(constraints, b.SpreadConstraints) {
+			if err = mutations.SetBucketSpreadConstraints(conn, bucket, b.SpreadConstraints); err != nil { return util.ProcessErr(err) }
+			updated = true
+		}
+	}
+
+	if updated && !added { summary.Updated = append(summary.Updated, fmt.Sprintf("bucket %v", b.Name)) }
+
+	return
+}
+
+func sameStorageIDs(a, b []int64) bool {
+	if len(a) != len(b) { return false }
+	for _, id := range a {
+		if !util.HasInt(b, id) { return false }
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManagedResources(t *testing.T) {
+	pc := validConfiguration()
+	want := managedResources{
+		Clusters: []string{"eu", "us"},
+		FaaSDeployments: []string{"faas-eu:8080"},
+		StorageDeployments: []string{"minio-eu", "disk-us"},
+		Buckets: []string{"meow"},
+	}
+	if got := pc.managedResources(); !reflect.DeepEqual(got, want) { t.Errorf("managedResources() = %+v, want %+v", got, want) }
+
+	empty := ServerConfiguration{}
+	want = managedResources{Clusters: []string{}, FaaSDeployments: []string{}, StorageDeployments: []string{}, Buckets: []string{}}
+	if got := empty.managedResources(); !reflect.DeepEqual(got, want) { t.Errorf("managedResources() = %+v, want %+v", got, want) }
+}
+
+func TestPrunedResources(t *testing.T) {
+	// What config_managed held when the configuration was last applied.
+	previous := managedResources{
+		Clusters: []string{"eu", "us"},
+		FaaSDeployments: []string{"faas-eu:8080", "faas-us:8080"},
+		StorageDeployments: []string{"minio-eu", "minio-us"},
+		Buckets: []string{"meow", "woof"},
+	}
+
+	tests := []struct {
+		name string
+		previous managedResources
+		current managedResources
+		want managedResources
+	}{
+		{"nothing dropped", previous, previous, managedResources{}},
+		{
+			"managed resources dropped from the file",
+			previous,
+			managedResources{Clusters: []string{"eu"}, FaaSDeployments: []string{"faas-eu:8080"}, StorageDeployments: []string{"minio-eu"}, Buckets: []string{"meow"}},
+			managedResources{Clusters: []string{"us"}, FaaSDeployments: []string{"faas-us:8080"}, StorageDeployments: []string{"minio-us"}, Buckets: []string{"woof"}},
+		},
+		{
+			"everything dropped",
+			previous,
+			managedResources{Clusters: []string{}, FaaSDeployments: []string{}, StorageDeployments: []string{}, Buckets: []string{}},
+			previous,
+		},
+		{
+			// Resources added through the API or found on storage deployments
+			// never were in config_managed, so they are never pruned.
+			"unmanaged resources left alone",
+			managedResources{Buckets: []string{"meow"}},
+			managedResources{Buckets: []string{"meow"}},
+			managedResources{},
+		},
+		{"first run prunes nothing", managedResources{}, managedResources{Clusters: []string{"eu"}, Buckets: []string{"meow"}}, managedResources{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.previous.without(tt.current); !reflect.DeepEqual(got, tt.want) { t.Errorf("without() = %+v, want %+v", got, tt.want) }
+		})
+	}
+}
+
+func TestManagedResourcesRememberedWithoutPrune(t *testing.T) {
+	previous := managedResources{Clusters: []string{"eu", "us"}, Buckets: []string{"meow", "woof"}}
+	current := managedResources{Clusters: []string{"eu"}, FaaSDeployments: []string{"faas-eu:8080"}, StorageDeployments: []string{}, Buckets: []string{"purr"}}
+
+	want := managedResources{Clusters: []string{"eu", "us"}, FaaSDeployments: []string{"faas-eu:8080"}, StorageDeployments: []string{}, Buckets: []string{"purr", "meow", "woof"}}
+	if got := current.union(previous); !reflect.DeepEqual(got, want) { t.Errorf("union() = %+v, want %+v", got, want) }
+
+	// Pruning later on still removes what was dropped meanwhile.
+	dropped := want.without(managedResources{Clusters: []string{"eu"}, Buckets: []string{"purr"}})
+	wantDropped := managedResources{Clusters: []string{"us"}, FaaSDeployments: []string{"faas-eu:8080"}, Buckets: []string{"meow", "woof"}}
+	if !reflect.DeepEqual(dropped, wantDropped) { t.Errorf("without() = %+v, want %+v", dropped, wantDropped) }
+}
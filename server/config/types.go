@@ -1,13 +1,24 @@
 package config
 
+import (
+	"fmt"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/storage"
+)
+
 type ClusterConfiguration struct {
 	Name string `json:"name"`
 	Zones []string `json:"zones"`
+	FailureDomains map[string]string `json:"failure_domains,omitempty"`
+	Policies map[string]interface{} `json:"policies,omitempty"`
 }
 
-func (cc *ClusterConfiguration) IsValid() bool {
+func (cc *ClusterConfiguration) validate(v *validator, path string) {
 	if cc.Zones == nil { cc.Zones = make([]string, 0) }
-	return cc.Name != ""
+	v.required(path + ".name", cc.Name)
+	v.policies(path + ".policies", cc.Policies, reservedClusterPolicies)
 }
 
 type StorageDeploymentConfiguration struct {
@@ -18,31 +29,61 @@ type StorageDeploymentConfiguration struct {
 	SecretKey string `json:"secret_key"`
 	UseSSL bool `json:"use_ssl"`
 	ManagementURL string `json:"management_url"`
+	Kind string `json:"kind"`
+	FailureDomains map[string]string `json:"failure_domains,omitempty"`
 }
 
-func (sdc *StorageDeploymentConfiguration) IsValid() bool {
-	return sdc.ClusterName != "" && sdc.Alias != "" && sdc.Endpoint != "" && sdc.AccessKey != "" && sdc.SecretKey != ""
+// Filesystem deployments take a directory as endpoint and need no credentials.
+func (sdc *StorageDeploymentConfiguration) validate(v *validator, path string) {
+	if sdc.Kind == "" { sdc.Kind = storage.KindMinio }
+	v.required(path + ".cluster_name", sdc.ClusterName)
+	v.required(path + ".alias", sdc.Alias)
+	v.required(path + ".endpoint", sdc.Endpoint)
+
+	switch sdc.Kind {
+	case storage.KindFilesystem:
+	case storage.KindMinio, storage.KindS3:
+		v.required(path + ".access_key", sdc.AccessKey)
+		v.required(path + ".secret_key", sdc.SecretKey)
+	default:
+		v.errorf(path + ".kind", "unknown storage deployment kind '%v'", sdc.Kind)
+	}
 }
 
 type FaaSDeploymentConfiguration struct {
 	ClusterName string `json:"cluster_name"`
 	URL string `json:"url"`
+	// Health check policies overriding the global ones.
+	Policies map[string]interface{} `json:"policies,omitempty"`
 }
 
-func (fdc *FaaSDeploymentConfiguration) IsValid() bool {
-	return fdc.ClusterName != "" && fdc.URL != ""
+func (fdc *FaaSDeploymentConfiguration) validate(v *validator, path string) {
+	v.required(path + ".cluster_name", fdc.ClusterName)
+	v.required(path + ".url", fdc.URL)
+	for _, name := range sortedPolicyNames(fdc.Policies) {
+		v.check(fmt.Sprintf("%v.policies.%v", path, name), mutations.ValidateHealthCheckPolicy(name, fdc.Policies[name]))
+	}
 }
 
 type BucketConfiguration struct {
 	Name string `json:"name"`
 	StorageDeploymentAlias string `json:"storage_deployment_alias"`
 	AllowedZones []string `json:"allowed_zones"`
+	DeniedZones []string `json:"denied_zones,omitempty"`
 	TargetReplicaCount int `json:"target_replica_count"`
+	ReplicationRules []database.ReplicationRule `json:"replication_rules,omitempty"`
+	SpreadConstraints []database.SpreadConstraint `json:"spread_constraints,omitempty"`
+	// Aliases of the storage deployments the bucket is pinned to.
+	ReplicaLocations []string `json:"replica_locations,omitempty"`
 }
 
-func (bc *BucketConfiguration) IsValid() bool {
+func (bc *BucketConfiguration) validate(v *validator, path string) {
 	if bc.AllowedZones == nil { bc.AllowedZones = make([]string, 0) }
-	return bc.Name != "" && bc.StorageDeploymentAlias != ""
+	v.required(path + ".name", bc.Name)
+	v.required(path + ".storage_deployment_alias", bc.StorageDeploymentAlias)
+	if bc.TargetReplicaCount < 0 { v.errorf(path + ".target_replica_count", "must not be negative") }
+	v.check(path + ".replication_rules", database.ValidateReplicationRules(bc.ReplicationRules))
+	v.check(path + ".spread_constraints", database.ValidateSpreadConstraints(bc.SpreadConstraints))
 }
 
 type ServerConfiguration struct {
@@ -50,4 +91,9 @@ type ServerConfiguration struct {
 	StorageDeployments []StorageDeploymentConfiguration `json:"storage_deployments"`
 	FaaSDeployments []FaaSDeploymentConfiguration `json:"faas_deployments"`
 	Buckets []BucketConfiguration `json:"buckets"`
+	// Clusters no bucket may be replicated into.
+	ReplicationDeniedClusters []string `json:"replication_denied_clusters,omitempty"`
+	GlobalPolicies map[string]interface{} `json:"global_policies,omitempty"`
+	// Keyed by bucket name.
+	RouteOverrides map[string]database.LoadBalancerRouteSettings `json:"route_overrides,omitempty"`
 }
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// A problem with the configuration, at the path of the offending value, e.g.
+// storage_deployments[2].cluster_name.
+type ValidationError struct {
+	Path string
+	Message string
+}
+
+func (ve ValidationError) Error() string {
+	if ve.Path == "" { return ve.Message }
+	return fmt.Sprintf("%v: %v", ve.Path, ve.Message)
+}
+
+// Every problem found with the configuration, so they can all be fixed at once.
+type ValidationErrors []ValidationError
+
+func (ves ValidationErrors) Error() string {
+	lines := make([]string, len(ves))
+	for i, ve := range ves { lines[i] = ve.Error() }
+	return fmt.Sprintf("Configuration invalid:\n  %v", strings.Join(lines, "\n  "))
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path, value string) {
+	if value == "" { v.errorf(path, "is required") }
+}
+
+// Records an error returned by one of the database validators, without the
+// location it was processed at.
+func (v *validator) check(path string, err error) {
+	if err == nil { return }
+
+	var se *util.ServerError
+	if errors.As(err, &se) && se.Cause != nil { err = se.Cause }
+	v.errorf(path, "%v", err)
+}
+
+// Checks that names are unique and returns them, indexed for looking up
+// references.
+func (v *validator) unique(path, field string, values []string) map[string]bool {
+	seen := make(map[string]bool)
+	for i, value := range values {
+		if value == "" { continue }
+		if seen[value] { v.errorf(fmt.Sprintf("%v[%v].%v", path, i, field), "duplicate %v '%v'", field, value) }
+		seen[value] = true
+	}
+	return seen
+}
+
+func (v *validator) reference(path, kind, value string, known map[string]bool) {
+	if value != "" && !known[value] { v.errorf(path, "unknown %v '%v'", kind, value) }
+}
+
+// Validates the whole document, filling in defaults on the way. References
+// between resources must resolve within the document.
+func (pc *ServerConfiguration) Validate() (err error) {
+	v := &validator{}
+
+	if len(pc.Clusters) < 1 { v.errorf("clusters", "no clusters were defined") }
+
+	var clusterNames, faasURLs, storageAliases, storageEndpoints, bucketNames []string
+	for i := range pc.Clusters {
+		pc.Clusters[i].validate(v, fmt.Sprintf("clusters[%v]", i))
+		clusterNames = append(clusterNames, pc.Clusters[i].Name)
+	}
+	for i := range pc.FaaSDeployments {
+		pc.FaaSDeployments[i].validate(v, fmt.Sprintf("faas_deployments[%v]", i))
+		faasURLs = append(faasURLs, pc.FaaSDeployments[i].URL)
+	}
+	for i := range pc.StorageDeployments {
+		pc.StorageDeployments[i].validate(v, fmt.Sprintf("storage_deployments[%v]", i))
+		storageAliases = append(storageAliases, pc.StorageDeployments[i].Alias)
+		storageEndpoints = append(storageEndpoints, pc.StorageDeployments[i].Endpoint)
+	}
+	for i := range pc.Buckets {
+		pc.Buckets[i].validate(v, fmt.Sprintf("buckets[%v]", i))
+		bucketNames = append(bucketNames, pc.Buckets[i].Name)
+	}
+
+	clusters := v.unique("clusters", "name", clusterNames)
+	v.unique("faas_deployments", "url", faasURLs)
+	storageDeployments := v.unique("storage_deployments", "alias", storageAliases)
+	v.unique("storage_deployments", "endpoint", storageEndpoints)
+	v.unique("buckets", "name", bucketNames)
+
+	for i, f := range pc.FaaSDeployments {
+		v.reference(fmt.Sprintf("faas_deployments[%v].cluster_name", i), "cluster", f.ClusterName, clusters)
+	}
+	for i, s := range pc.StorageDeployments {
+		v.reference(fmt.Sprintf("storage_deployments[%v].cluster_name", i), "cluster", s.ClusterName, clusters)
+	}
+	for i, b := range pc.Buckets {
+		v.reference(fmt.Sprintf("buckets[%v].storage_deployment_alias", i), "storage deployment", b.StorageDeploymentAlias, storageDeployments)
+		for j, alias := range b.ReplicaLocations {
+			v.reference(fmt.Sprintf("buckets[%v].replica_locations[%v]", i, j), "storage deployment", alias, storageDeployments)
+			if alias == b.StorageDeploymentAlias { v.errorf(fmt.Sprintf("buckets[%v].replica_locations[%v]", i, j), "the bucket's master is on %v", alias) }
+		}
+	}
+	v.policies("global_policies", pc.GlobalPolicies, reservedGlobalPolicies)
+	v.selectionPolicy("global_policies", pc.GlobalPolicies)
+	for bucketName, settings := range pc.RouteOverrides {
+		if settings.BucketName != "" && settings.BucketName != bucketName {
+			v.errorf(fmt.Sprintf("route_overrides.%v.bucket_name", bucketName), "does not match the bucket it overrides")
+		}
+		v.check(fmt.Sprintf("route_overrides.%v.policy", bucketName), mutations.ValidateRouteOverride(settings))
+	}
+	for i, name := range pc.ReplicationDeniedClusters {
+		v.reference(fmt.Sprintf("replication_denied_clusters[%v]", i), "cluster", name, clusters)
+	}
+
+	if len(v.errs) > 0 { return util.ProcessErr(v.errs) }
+
+	return
+}
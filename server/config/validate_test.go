@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/storage"
+)
+
+func validConfiguration() ServerConfiguration {
+	return ServerConfiguration{
+		Clusters: []ClusterConfiguration{
+			{Name: "eu", Zones: []string{"europe"}},
+			{Name: "us", Zones: []string{"america"}},
+		},
+		StorageDeployments: []StorageDeploymentConfiguration{
+			{ClusterName: "eu", Alias: "minio-eu", Endpoint: "minio-eu:9000", AccessKey: "minioadmin", SecretKey: "minioadmin"},
+			{ClusterName: "us", Alias: "disk-us", Endpoint: "/var/lib/fado", Kind: storage.KindFilesystem},
+		},
+		FaaSDeployments: []FaaSDeploymentConfiguration{
+			{ClusterName: "eu", URL: "faas-eu:8080"},
+		},
+		Buckets: []BucketConfiguration{
+			{Name: "meow", StorageDeploymentAlias: "minio-eu", TargetReplicaCount: 1},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		modify func(pc *ServerConfiguration)
+		wantPaths []string
+	}{
+		{"valid", func(pc *ServerConfiguration) {}, nil},
+		{
+			"no clusters",
+			func(pc *ServerConfiguration) { pc.Clusters = nil; pc.StorageDeployments = nil; pc.FaaSDeployments = nil; pc.Buckets = nil },
+			[]string{"clusters"},
+		},
+		{
+			"missing names",
+			func(pc *ServerConfiguration) { pc.Clusters[1].Name = ""; pc.Buckets[0].Name = "" },
+			[]string{"buckets[0].name", "clusters[1].name", "storage_deployments[1].cluster_name"},
+		},
+		{
+			"duplicate names",
+			func(pc *ServerConfiguration) {
+				pc.Clusters[1].Name = "eu"
+				pc.StorageDeployments[1].ClusterName = "eu"
+				pc.StorageDeployments[1].Alias = "minio-eu"
+			},
+			[]string{"clusters[1].name", "storage_deployments[1].alias"},
+		},
+		{
+			"missing credentials",
+			func(pc *ServerConfiguration) { pc.StorageDeployments[0].SecretKey = "" },
+			[]string{"storage_deployments[0].secret_key"},
+		},
+		{
+			"unknown kind",
+			func(pc *ServerConfiguration) { pc.StorageDeployments[1].Kind = "tape" },
+			[]string{"storage_deployments[1].kind"},
+		},
+		{
+			"unknown references",
+			func(pc *ServerConfiguration) {
+				pc.FaaSDeployments[0].ClusterName = "asia"
+				pc.Buckets[0].StorageDeploymentAlias = "minio-asia"
+				pc.ReplicationDeniedClusters = []string{"asia"}
+			},
+			[]string{"buckets[0].storage_deployment_alias", "faas_deployments[0].cluster_name", "replication_denied_clusters[0]"},
+		},
+		{
+			"replica on the master",
+			func(pc *ServerConfiguration) { pc.Buckets[0].ReplicaLocations = []string{"disk-us", "minio-eu"} },
+			[]string{"buckets[0].replica_locations[1]"},
+		},
+		{
+			"negative replica count",
+			func(pc *ServerConfiguration) { pc.Buckets[0].TargetReplicaCount = -1 },
+			[]string{"buckets[0].target_replica_count"},
+		},
+		{
+			"reserved policies",
+			func(pc *ServerConfiguration) {
+				pc.Clusters[0].Policies = map[string]interface{}{"zones": []string{"asia"}}
+				pc.GlobalPolicies = map[string]interface{}{"lb_routes": map[string]interface{}{}}
+			},
+			[]string{"clusters[0].policies.zones", "global_policies.lb_routes"},
+		},
+		{
+			"invalid health check policy",
+			func(pc *ServerConfiguration) { pc.FaaSDeployments[0].Policies = map[string]interface{}{"faas_health_path": "healthz"} },
+			[]string{"faas_deployments[0].policies.faas_health_path"},
+		},
+		{
+			"invalid selection policy",
+			func(pc *ServerConfiguration) { pc.GlobalPolicies = map[string]interface{}{"lb_policy": "header"} },
+			[]string{"global_policies.lb_policy"},
+		},
+		{
+			"selection policy with its parameters",
+			func(pc *ServerConfiguration) {
+				pc.GlobalPolicies = map[string]interface{}{"lb_policy": "header", "lb_policy_params": map[string]interface{}{"field": "X-User"}}
+			},
+			nil,
+		},
+		{
+			"route overrides",
+			func(pc *ServerConfiguration) {
+				pc.RouteOverrides = map[string]database.LoadBalancerRouteSettings{
+					"meow": {Upstreams: []string{"faas-eu:8080"}},
+					"purr": {BucketName: "hiss", Policy: "fastest"},
+				}
+			},
+			[]string{"route_overrides.purr.bucket_name", "route_overrides.purr.policy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := validConfiguration()
+			tt.modify(&pc)
+
+			err := pc.Validate()
+			var ves ValidationErrors
+			if err != nil && !errors.As(err, &ves) { t.Fatalf("Validate = %v, want validation errors", err) }
+
+			var paths []string
+			for _, ve := range ves { paths = append(paths, ve.Path) }
+			sort.Strings(paths)
+			if len(paths) != len(tt.wantPaths) { t.Fatalf("Validate errors at %v, want %v", paths, tt.wantPaths) }
+			for i := range paths {
+				if paths[i] != tt.wantPaths[i] { t.Fatalf("Validate errors at %v, want %v", paths, tt.wantPaths) }
+			}
+		})
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	pc := validConfiguration()
+	pc.Clusters[0].Zones = nil
+	if err := pc.Validate(); err != nil { t.Fatalf("Validate = %v", err) }
+
+	if pc.Clusters[0].Zones == nil { t.Errorf("cluster zones left nil") }
+	if pc.StorageDeployments[0].Kind != storage.KindMinio { t.Errorf("storage deployment kind = %q, want %q", pc.StorageDeployments[0].Kind, storage.KindMinio) }
+	if pc.Buckets[0].AllowedZones == nil { t.Errorf("bucket allowed zones left nil") }
+}
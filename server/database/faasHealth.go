@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Health statuses of FaaS and storage deployments. FaaS deployments are routed
+// to unless they are unhealthy, storage deployments have their master buckets
+// failed over once they are.
+
+const (
+	HealthUnknown = "unknown"
+	HealthHealthy = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// type facilities
+
+type FaaSHealthStateRecord struct {
+	FaaSID int64 `json:"faas_id"`
+	Status string `json:"status"`
+	ConsecutiveSuccesses int `json:"consecutive_successes"`
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	LastLatencyMs *float64 `json:"last_latency_ms"`
+	LastError string `json:"last_error"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ScanFaaSHealthStateRows(rows pgx.Rows) (faasHealthStates []FaaSHealthStateRecord, err error) {
+	for rows.Next() {
+		var fhs FaaSHealthStateRecord
+
+		err = rows.Scan(
+			&fhs.FaaSID,
+			&fhs.Status,
+			&fhs.ConsecutiveSuccesses,
+			&fhs.ConsecutiveFailures,
+			&fhs.LastCheckedAt,
+			&fhs.LastLatencyMs,
+			&fhs.LastError,
+			&fhs.UpdatedAt,
+		)
+		if err != nil { return faasHealthStates, util.ProcessErr(err) }
+
+		faasHealthStates = append(faasHealthStates, fhs)
+	}
+
+	return
+}
+
+type FaaSHealthCheckRecord struct {
+	CheckID int64 `json:"check_id"`
+	FaaSID int64 `json:"faas_id"`
+	CheckedAt time.Time `json:"checked_at"`
+	Healthy bool `json:"healthy"`
+	StatusCode int `json:"status_code"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error string `json:"error"`
+}
+
+func ScanFaaSHealthCheckRows(rows pgx.Rows) (faasHealthChecks []FaaSHealthCheckRecord, err error) {
+	for rows.Next() {
+		var fhc FaaSHealthCheckRecord
+
+		err = rows.Scan(
+			&fhc.CheckID,
+			&fhc.FaaSID,
+			&fhc.CheckedAt,
+			&fhc.Healthy,
+			&fhc.StatusCode,
+			&fhc.LatencyMs,
+			&fhc.Error,
+		)
+		if err != nil { return faasHealthChecks, util.ProcessErr(err) }
+
+		faasHealthChecks = append(faasHealthChecks, fhc)
+	}
+
+	return
+}
+
+// general query
+
+func QueryFaaSHealthStates(conn DBConn, sql string, args ...interface{}) (faasHealthStates []FaaSHealthStateRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return faasHealthStates, util.ProcessErr(err) }
+	defer rows.Close()
+
+	faasHealthStates, err = ScanFaaSHealthStateRows(rows)
+	if err != nil { return faasHealthStates, util.ProcessErr(err) }
+
+	return
+}
+
+func QueryFaaSHealthStateRow(conn DBConn, sql string, args ...interface{}) (faasHealthState FaaSHealthStateRecord, err error) {
+	records, err := QueryFaaSHealthStates(conn, sql, args...)
+	if err != nil { return faasHealthState, util.ProcessErr(err) }
+	if len(records) != 1 { return faasHealthState, util.ProcessErr(fmt.Errorf("Expected 1 record back, go %v.", len(records))) }
+	return records[0], nil
+}
+
+func QueryFaaSHealthChecks(conn DBConn, sql string, args ...interface{}) (faasHealthChecks []FaaSHealthCheckRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return faasHealthChecks, util.ProcessErr(err) }
+	defer rows.Close()
+
+	faasHealthChecks, err = ScanFaaSHealthCheckRows(rows)
+	if err != nil { return faasHealthChecks, util.ProcessErr(err) }
+
+	return
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Selection policies weighing the upstreams of a route, configured on Caddy as
+// weighted round robin. Weights are set by hand under the weighted policy, and
+// by FaDO from the measured latency and error rates under the fado_latency one.
+const (
+	WeightedPolicy = "weighted"
+	LatencyPolicy = "fado_latency"
+)
+
+// Where the measurements behind a latency weight come from. Deployments
+// without any are weighted like the average measured one.
+const (
+	LatencySourceInvocations = "invocations"
+	LatencySourceProbes = "probes"
+	LatencySourceNone = "none"
+)
+
+// type facilities
+
+type FaaSLatencyWeightRecord struct {
+	FaaSID int64 `json:"faas_id"`
+	Source string `json:"source"`
+	Samples int `json:"samples"`
+	LatencyMs *float64 `json:"latency_ms"`
+	ErrorRate *float64 `json:"error_rate"`
+	Weight int `json:"weight"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ScanFaaSLatencyWeightRows(rows pgx.Rows) (faasLatencyWeights []FaaSLatencyWeightRecord, err error) {
+	for rows.Next() {
+		var flw FaaSLatencyWeightRecord
+
+		err = rows.Scan(
+			&flw.FaaSID,
+			&flw.Source,
+			&flw.Samples,
+			&flw.LatencyMs,
+			&flw.ErrorRate,
+			&flw.Weight,
+			&flw.UpdatedAt,
+		)
+		if err != nil { return faasLatencyWeights, util.ProcessErr(err) }
+
+		faasLatencyWeights = append(faasLatencyWeights, flw)
+	}
+
+	return
+}
+
+// Requests, errors and total latency of a FaaS deployment over a window, out of
+// either its invocation stats or its health checks.
+type FaaSLatencySampleRecord struct {
+	FaaSID int64 `json:"faas_id"`
+	Requests int `json:"requests"`
+	Errors int `json:"errors"`
+	LatencyMsTotal float64 `json:"latency_ms_total"`
+}
+
+func ScanFaaSLatencySampleRows(rows pgx.Rows) (faasLatencySamples []FaaSLatencySampleRecord, err error) {
+	for rows.Next() {
+		var fls FaaSLatencySampleRecord
+
+		err = rows.Scan(
+			&fls.FaaSID,
+			&fls.Requests,
+			&fls.Errors,
+			&fls.LatencyMsTotal,
+		)
+		if err != nil { return faasLatencySamples, util.ProcessErr(err) }
+
+		faasLatencySamples = append(faasLatencySamples, fls)
+	}
+
+	return
+}
+
+// general query
+
+func QueryFaaSLatencyWeights(conn DBConn, sql string, args ...interface{}) (faasLatencyWeights []FaaSLatencyWeightRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return faasLatencyWeights, util.ProcessErr(err) }
+	defer rows.Close()
+
+	faasLatencyWeights, err = ScanFaaSLatencyWeightRows(rows)
+	if err != nil { return faasLatencyWeights, util.ProcessErr(err) }
+
+	return
+}
+
+func QueryFaaSLatencySamples(conn DBConn, sql string, args ...interface{}) (faasLatencySamples []FaaSLatencySampleRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return faasLatencySamples, util.ProcessErr(err) }
+	defer rows.Close()
+
+	faasLatencySamples, err = ScanFaaSLatencySampleRows(rows)
+	if err != nil { return faasLatencySamples, util.ProcessErr(err) }
+
+	return
+}
@@ -16,6 +16,10 @@ type LoadBalancerServerConfig struct {
 
 type SelectionPolicyConfig struct {
 	Policy string `json:"policy,omitempty"`
+	Field string `json:"field,omitempty"`
+	Name string `json:"name,omitempty"`
+	Secret string `json:"secret,omitempty"`
+	Weights []int `json:"weights,omitempty"`
 }
 
 type LoadBalancingConfig struct {
@@ -26,9 +30,27 @@ type UpstreamConfig struct {
 	Dial string `json:"dial,omitempty"`
 }
 
+type ActiveHealthChecksConfig struct {
+	URI string `json:"uri,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type PassiveHealthChecksConfig struct {
+	FailDuration string `json:"fail_duration,omitempty"`
+	MaxFails int `json:"max_fails,omitempty"`
+	UnhealthyStatus []int `json:"unhealthy_status,omitempty"`
+}
+
+type HealthChecksConfig struct {
+	Active *ActiveHealthChecksConfig `json:"active,omitempty"`
+	Passive *PassiveHealthChecksConfig `json:"passive,omitempty"`
+}
+
 type HandleConfig struct {
 	Handler string `json:"handler,omitempty"`
 	LoadBalancing *LoadBalancingConfig `json:"load_balancing,omitempty"`
+	HealthChecks *HealthChecksConfig `json:"health_checks,omitempty"`
 	Upstreams []UpstreamConfig `json:"upstreams,omitempty"`
 	Routes []LoadBalancerRouteConfig `json:"routes,omitempty"`
 }
@@ -36,6 +58,7 @@ type HandleConfig struct {
 type MatchConfig struct {
 	Header map[string][]string `json:"header,omitempty"`
 	Host []string `json:"host,omitempty"`
+	Query map[string][]string `json:"query,omitempty"`
 }
 
 type LoadBalancerRouteConfig struct {
@@ -44,10 +67,36 @@ type LoadBalancerRouteConfig struct {
 	Terminal *bool `json:"terminal,omitempty"`
 }
 
+// Health of an upstream as Caddy last saw it. Fails counts the failures
+// still within the passive fail duration.
+type LoadBalancerUpstreamStatus struct {
+	Address string `json:"address"`
+	NumRequests int `json:"num_requests"`
+	Fails int `json:"fails"`
+}
+
 // Override types
 
+// Parameters of the selection policies taking some: the header hashed by the
+// header policy, the cookie of the cookie policy and the weight of each
+// upstream URL under the weighted policy.
+type SelectionPolicyParams struct {
+	Field string `json:"field,omitempty"`
+	Name string `json:"name,omitempty"`
+	Secret string `json:"secret,omitempty"`
+	Weights map[string]int `json:"weights,omitempty"`
+}
+
 type LoadBalancerRouteSettings struct {
 	BucketName string `json:"bucket_name"`
 	Policy string `json:"policy,omitempty"`
+	PolicyParams *SelectionPolicyParams `json:"policy_params,omitempty"`
 	Upstreams []string `json:"upstreams,omitempty"`
+	// Weight of each upstream, keyed by URL, under the weighted and
+	// fado_latency policies.
+	Weights map[string]int `json:"weights,omitempty"`
 }
+
+// Upstreams of the objects routed apart from their bucket, keyed by bucket
+// name then object key.
+type ObjectRoutesMap map[string]map[string][]string
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// type facilities
+
+type ObjectLocationRecord struct {
+	ObjectID int64 `json:"object_id"`
+	StorageID int64 `json:"storage_id"`
+	ETag string `json:"etag"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ScanObjectLocationRows(rows pgx.Rows) (objectLocations []ObjectLocationRecord, err error) {
+	for rows.Next() {
+		var olr ObjectLocationRecord
+
+		err = rows.Scan(
+			&olr.ObjectID,
+			&olr.StorageID,
+			&olr.ETag,
+			&olr.UpdatedAt,
+		)
+		if err != nil { return objectLocations, util.ProcessErr(err) }
+
+		objectLocations = append(objectLocations, olr)
+	}
+
+	return
+}
+
+// general query
+
+func QueryObjectLocations(conn DBConn, sql string, args ...interface{}) (objectLocations []ObjectLocationRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return objectLocations, util.ProcessErr(err) }
+	defer rows.Close()
+
+	objectLocations, err = ScanObjectLocationRows(rows)
+	if err != nil { return objectLocations, util.ProcessErr(err) }
+
+	return
+}
+
+// view
+
+type ObjectFaaSLocationRecord struct {
+	ObjectID int64 `json:"object_id"`
+	BucketID int64 `json:"bucket_id"`
+	BucketName string `json:"bucket_name"`
+	ObjectName string `json:"object_name"`
+	StorageID int64 `json:"storage_id"`
+	FaaSID int64 `json:"faas_id"`
+	FaaSURL string `json:"faas_url"`
+}
+
+func ScanObjectFaaSLocationRows(rows pgx.Rows) (objectFaaSLocations []ObjectFaaSLocationRecord, err error) {
+	for rows.Next() {
+		var oflr ObjectFaaSLocationRecord
+
+		err = rows.Scan(
+			&oflr.ObjectID,
+			&oflr.BucketID,
+			&oflr.BucketName,
+			&oflr.ObjectName,
+			&oflr.StorageID,
+			&oflr.FaaSID,
+			&oflr.FaaSURL,
+		)
+		if err != nil { return objectFaaSLocations, util.ProcessErr(err) }
+
+		objectFaaSLocations = append(objectFaaSLocations, oflr)
+	}
+
+	return
+}
+
+func QueryObjectFaaSLocations(conn DBConn, sql string, args ...interface{}) (objectFaaSLocations []ObjectFaaSLocationRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return objectFaaSLocations, util.ProcessErr(err) }
+	defer rows.Close()
+
+	objectFaaSLocations, err = ScanObjectFaaSLocationRows(rows)
+	if err != nil { return objectFaaSLocations, util.ProcessErr(err) }
+
+	return
+}
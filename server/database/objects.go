@@ -13,6 +13,8 @@ type ObjectRecord struct {
 	ObjectID int64 `json:"object_id"`
 	BucketID int64 `json:"bucket_id"`
 	Name string `json:"name"`
+	ETag string `json:"etag"`
+	Size int64 `json:"size"`
 }
 
 func ScanObjectRows(rows pgx.Rows) (objects []ObjectRecord, err error) {
@@ -23,6 +25,8 @@ func ScanObjectRows(rows pgx.Rows) (objects []ObjectRecord, err error) {
 			&or.ObjectID,
 			&or.BucketID,
 			&or.Name,
+			&or.ETag,
+			&or.Size,
 		)
 		if err != nil { return objects, util.ProcessErr(err) }
 
@@ -55,7 +59,20 @@ func QueryObjectRow(conn DBConn, sql string, args ...interface{}) (object Object
 // insert
 
 func InsertObject(conn DBConn, obj ObjectRecord) (r ObjectRecord, err error) {
-	records, err := QueryObjects(conn, "INSERT INTO objects (bucket_id, name) VALUES ($1, $2) RETURNING *", obj.BucketID, obj.Name)
+	records, err := QueryObjects(conn, "INSERT INTO objects (bucket_id, name, etag, size) VALUES ($1, $2, $3, $4) RETURNING *", obj.BucketID, obj.Name, obj.ETag, obj.Size)
+	if err != nil {
+		return r, util.ProcessErr(err)
+	} else if len(records) != 1 {
+		return r, util.ProcessErr(fmt.Errorf("Expected 1 record back, got %v.", len(records)))
+	}
+	return records[0], err
+}
+
+
+// upsert
+
+func UpsertObject(conn DBConn, obj ObjectRecord) (r ObjectRecord, err error) {
+	records, err := QueryObjects(conn, "INSERT INTO objects (bucket_id, name, etag, size) VALUES ($1, $2, $3, $4) ON CONFLICT (bucket_id, name) DO UPDATE SET etag = $3, size = $4 RETURNING *", obj.BucketID, obj.Name, obj.ETag, obj.Size)
 	if err != nil {
 		return r, util.ProcessErr(err)
 	} else if len(records) != 1 {
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Policy types
+
+// Constrains how a bucket's replicas spread over a failure domain, e.g. the
+// region or provider labels of clusters and storage deployments. Replicas
+// should span at least MinDistinct values of the domain and no more than
+// MaxPerValue replicas should share a value. Zero disables either check.
+type SpreadConstraint struct {
+	Domain string `json:"domain"`
+	MinDistinct int `json:"min_distinct"`
+	MaxPerValue int `json:"max_per_value"`
+}
+
+func ValidateSpreadConstraints(constraints []SpreadConstraint) (err error) {
+	for _, sc := range constraints {
+		if sc.Domain == "" {
+			return util.ProcessErr(fmt.Errorf("Spread constraints need a failure domain."))
+		} else if sc.MinDistinct < 0 || sc.MaxPerValue < 0 {
+			return util.ProcessErr(fmt.Errorf("Spread constraint on '%v' has a negative limit.", sc.Domain))
+		} else if sc.MinDistinct == 0 && sc.MaxPerValue == 0 {
+			return util.ProcessErr(fmt.Errorf("Spread constraint on '%v' sets no limit.", sc.Domain))
+		}
+	}
+
+	return
+}
+
+// Placement statuses
+
+const (
+	PlacementSatisfied = "satisfied"
+	PlacementUnsatisfiable = "unsatisfiable"
+)
+
+// type facilities
+
+type BucketPlacementStatusRecord struct {
+	BucketID int64 `json:"bucket_id"`
+	RuleKey string `json:"rule_key"`
+	Status string `json:"status"`
+	Reasons []string `json:"reasons"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ScanBucketPlacementStatusRows(rows pgx.Rows) (statuses []BucketPlacementStatusRecord, err error) {
+	for rows.Next() {
+		var bpsr BucketPlacementStatusRecord
+
+		err = rows.Scan(
+			&bpsr.BucketID,
+			&bpsr.RuleKey,
+			&bpsr.Status,
+			&bpsr.Reasons,
+			&bpsr.UpdatedAt,
+		)
+		if err != nil { return statuses, util.ProcessErr(err) }
+
+		statuses = append(statuses, bpsr)
+	}
+
+	return
+}
+
+// general query
+
+func QueryBucketPlacementStatuses(conn DBConn, sql string, args ...interface{}) (statuses []BucketPlacementStatusRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return statuses, util.ProcessErr(err) }
+	defer rows.Close()
+
+	statuses, err = ScanBucketPlacementStatusRows(rows)
+	if err != nil { return statuses, util.ProcessErr(err) }
+
+	return
+}
@@ -153,6 +153,72 @@ func UpsertClusterPolicy(conn DBConn, cp ClusterPolicyRecord) (r ClusterPolicyRe
 	return records[0], err
 }
 
+// Storage deployment policies
+
+type StorageDeploymentPolicyRecord struct {
+	StorageID int64 `json:"storage_id"`
+	PolicyID int64 `json:"policy_id"`
+	Value string `json:"value"`
+}
+
+func QueryStorageDeploymentsPolicies(conn DBConn, sql string, args ...interface{}) (storageDeploymentPolicies []StorageDeploymentPolicyRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return storageDeploymentPolicies, util.ProcessErr(err) }
+
+	defer rows.Close()
+	for rows.Next() {
+		var sdpr StorageDeploymentPolicyRecord
+		err = rows.Scan(&sdpr.StorageID, &sdpr.PolicyID, &sdpr.Value)
+		if err != nil { return storageDeploymentPolicies, util.ProcessErr(err) }
+		storageDeploymentPolicies = append(storageDeploymentPolicies, sdpr)
+	}
+
+	return
+}
+
+func UpsertStorageDeploymentPolicy(conn DBConn, sdp StorageDeploymentPolicyRecord) (r StorageDeploymentPolicyRecord, err error) {
+	records, err := QueryStorageDeploymentsPolicies(conn, "INSERT INTO storage_deployments_policies (storage_id, policy_id, value) VALUES ($1, $2, $3) ON CONFLICT (storage_id, policy_id) DO UPDATE SET value = $3 RETURNING *", sdp.StorageID, sdp.PolicyID, sdp.Value)
+	if err != nil {
+		return r, util.ProcessErr(err)
+	} else if len(records) != 1 {
+		return r, util.ProcessErr(fmt.Errorf("Expected 1 record back, got %v.", len(records)))
+	}
+	return records[0], err
+}
+
+// FaaS deployment policies
+
+type FaaSDeploymentPolicyRecord struct {
+	FaaSID int64 `json:"faas_id"`
+	PolicyID int64 `json:"policy_id"`
+	Value string `json:"value"`
+}
+
+func QueryFaaSDeploymentsPolicies(conn DBConn, sql string, args ...interface{}) (faasDeploymentPolicies []FaaSDeploymentPolicyRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return faasDeploymentPolicies, util.ProcessErr(err) }
+
+	defer rows.Close()
+	for rows.Next() {
+		var fdpr FaaSDeploymentPolicyRecord
+		err = rows.Scan(&fdpr.FaaSID, &fdpr.PolicyID, &fdpr.Value)
+		if err != nil { return faasDeploymentPolicies, util.ProcessErr(err) }
+		faasDeploymentPolicies = append(faasDeploymentPolicies, fdpr)
+	}
+
+	return
+}
+
+func UpsertFaaSDeploymentPolicy(conn DBConn, fdp FaaSDeploymentPolicyRecord) (r FaaSDeploymentPolicyRecord, err error) {
+	records, err := QueryFaaSDeploymentsPolicies(conn, "INSERT INTO faas_deployments_policies (faas_id, policy_id, value) VALUES ($1, $2, $3) ON CONFLICT (faas_id, policy_id) DO UPDATE SET value = $3 RETURNING *", fdp.FaaSID, fdp.PolicyID, fdp.Value)
+	if err != nil {
+		return r, util.ProcessErr(err)
+	} else if len(records) != 1 {
+		return r, util.ProcessErr(fmt.Errorf("Expected 1 record back, got %v.", len(records)))
+	}
+	return records[0], err
+}
+
 // Abstractions
 
 func GetBucketPolicy(conn DBConn, bucket BucketRecord, policyName string, value interface{}) ( set bool, err error) {
@@ -239,6 +305,90 @@ func DeleteClusterPolicy(conn DBConn, cluster ClusterRecord, policyName string)
 	return
 }
 
+func GetStorageDeploymentPolicy(conn DBConn, sd StorageDeploymentRecord, policyName string, value interface{}) (set bool, err error) {
+	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
+	if err != nil { return set, util.ProcessErr(err) }
+
+	err = json.Unmarshal([]byte(policy.DefaultValue), value)
+	if err != nil { return set, util.ProcessErr(err) }
+
+	storageDeploymentPolicies, err := QueryStorageDeploymentsPolicies(conn, "SELECT * FROM storage_deployments_policies WHERE storage_id = $1 AND policy_id = $2", sd.StorageID, policy.PolicyID)
+	if err != nil { return set, util.ProcessErr(err) }
+
+	if len(storageDeploymentPolicies) != 1 { return }
+
+	err = json.Unmarshal([]byte(storageDeploymentPolicies[0].Value), value)
+	if err != nil { return set, nil }
+	set = true
+
+	return
+}
+
+func SetStorageDeploymentPolicy(conn DBConn, sd StorageDeploymentRecord, policyName string, input interface{}) (err error) {
+	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
+	if err != nil { return util.ProcessErr(err) }
+
+	valueBytes, err := json.Marshal(input)
+	if err != nil { return util.ProcessErr(err) }
+
+	_, err = UpsertStorageDeploymentPolicy(conn, StorageDeploymentPolicyRecord{sd.StorageID, policy.PolicyID, string(valueBytes)})
+	if err != nil { return util.ProcessErr(err) }
+
+	return
+}
+
+func DeleteStorageDeploymentPolicy(conn DBConn, sd StorageDeploymentRecord, policyName string) (err error) {
+	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
+	if err != nil { return util.ProcessErr(err) }
+
+	_, err = Exec(conn, "DELETE FROM storage_deployments_policies WHERE storage_id = $1 AND policy_id = $2", sd.StorageID, policy.PolicyID)
+	if err != nil { return util.ProcessErr(err) }
+
+	return
+}
+
+func GetFaaSDeploymentPolicy(conn DBConn, fd FaaSDeploymentRecord, policyName string, value interface{}) (set bool, err error) {
+	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
+	if err != nil { return set, util.ProcessErr(err) }
+
+	err = json.Unmarshal([]byte(policy.DefaultValue), value)
+	if err != nil { return set, util.ProcessErr(err) }
+
+	faasDeploymentPolicies, err := QueryFaaSDeploymentsPolicies(conn, "SELECT * FROM faas_deployments_policies WHERE faas_id = $1 AND policy_id = $2", fd.FaaSID, policy.PolicyID)
+	if err != nil { return set, util.ProcessErr(err) }
+
+	if len(faasDeploymentPolicies) != 1 { return }
+
+	err = json.Unmarshal([]byte(faasDeploymentPolicies[0].Value), value)
+	if err != nil { return set, nil }
+	set = true
+
+	return
+}
+
+func SetFaaSDeploymentPolicy(conn DBConn, fd FaaSDeploymentRecord, policyName string, input interface{}) (err error) {
+	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
+	if err != nil { return util.ProcessErr(err) }
+
+	valueBytes, err := json.Marshal(input)
+	if err != nil { return util.ProcessErr(err) }
+
+	_, err = UpsertFaaSDeploymentPolicy(conn, FaaSDeploymentPolicyRecord{fd.FaaSID, policy.PolicyID, string(valueBytes)})
+	if err != nil { return util.ProcessErr(err) }
+
+	return
+}
+
+func DeleteFaaSDeploymentPolicy(conn DBConn, fd FaaSDeploymentRecord, policyName string) (err error) {
+	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
+	if err != nil { return util.ProcessErr(err) }
+
+	_, err = Exec(conn, "DELETE FROM faas_deployments_policies WHERE faas_id = $1 AND policy_id = $2", fd.FaaSID, policy.PolicyID)
+	if err != nil { return util.ProcessErr(err) }
+
+	return
+}
+
 func GetGlobalPolicy(conn DBConn, policyName string, value interface{}) (err error) {
 	policy, err := QueryPolicyRow(conn, "SELECT * FROM policies WHERE name = $1", policyName)
 	if err != nil { return util.ProcessErr(err) }
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// type facilities
+
+type PendingReplicaDeletionRecord struct {
+	DeletionID int64 `json:"deletion_id"`
+	BucketID int64 `json:"bucket_id"`
+	BucketName string `json:"bucket_name"`
+	StorageID int64 `json:"storage_id"`
+	RequestedAt time.Time `json:"requested_at"`
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+func ScanPendingReplicaDeletionRows(rows pgx.Rows) (pendingReplicaDeletions []PendingReplicaDeletionRecord, err error) {
+	for rows.Next() {
+		var prd PendingReplicaDeletionRecord
+
+		err = rows.Scan(
+			&prd.DeletionID,
+			&prd.BucketID,
+			&prd.BucketName,
+			&prd.StorageID,
+			&prd.RequestedAt,
+			&prd.DeleteAfter,
+		)
+		if err != nil { return pendingReplicaDeletions, util.ProcessErr(err) }
+
+		pendingReplicaDeletions = append(pendingReplicaDeletions, prd)
+	}
+
+	return
+}
+
+// general query
+
+func QueryPendingReplicaDeletions(conn DBConn, sql string, args ...interface{}) (pendingReplicaDeletions []PendingReplicaDeletionRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return pendingReplicaDeletions, util.ProcessErr(err) }
+	defer rows.Close()
+
+	pendingReplicaDeletions, err = ScanPendingReplicaDeletionRows(rows)
+	if err != nil { return pendingReplicaDeletions, util.ProcessErr(err) }
+
+	return
+}
+
+func QueryPendingReplicaDeletionRow(conn DBConn, sql string, args ...interface{}) (pendingReplicaDeletion PendingReplicaDeletionRecord, err error) {
+	records, err := QueryPendingReplicaDeletions(conn, sql, args...)
+	if err != nil { return pendingReplicaDeletion, util.ProcessErr(err) }
+	if len(records) != 1 { return pendingReplicaDeletion, util.ProcessErr(fmt.Errorf("Expected 1 record back, go %v.", len(records))) }
+	return records[0], nil
+}
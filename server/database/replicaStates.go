@@ -0,0 +1,83 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Replica sync statuses
+
+const (
+	ReplicaInSync = "in-sync"
+	ReplicaSyncing = "syncing"
+	ReplicaStale = "stale"
+	ReplicaFailed = "failed"
+)
+
+// type facilities
+
+type ReplicaSyncStateRecord struct {
+	BucketID int64 `json:"bucket_id"`
+	StorageID int64 `json:"storage_id"`
+	Status string `json:"status"`
+	LastSyncAt *time.Time `json:"last_sync_at"`
+	OutOfSyncSince *time.Time `json:"out_of_sync_since"`
+	ObjectsBehind int64 `json:"objects_behind"`
+	BytesBehind int64 `json:"bytes_behind"`
+	LastError string `json:"last_error"`
+	UpdatedAt time.Time `json:"updated_at"`
+	LagSeconds float64 `json:"lag_seconds"`
+}
+
+// How long the replica has not been known to be in sync.
+func (r *ReplicaSyncStateRecord) Lag() time.Duration {
+	if r.OutOfSyncSince == nil { return 0 }
+	return time.Since(*r.OutOfSyncSince)
+}
+
+func ScanReplicaSyncStateRows(rows pgx.Rows) (replicaSyncStates []ReplicaSyncStateRecord, err error) {
+	for rows.Next() {
+		var rss ReplicaSyncStateRecord
+
+		err = rows.Scan(
+			&rss.BucketID,
+			&rss.StorageID,
+			&rss.Status,
+			&rss.LastSyncAt,
+			&rss.OutOfSyncSince,
+			&rss.ObjectsBehind,
+			&rss.BytesBehind,
+			&rss.LastError,
+			&rss.UpdatedAt,
+		)
+		if err != nil { return replicaSyncStates, util.ProcessErr(err) }
+		rss.LagSeconds = rss.Lag().Seconds()
+
+		replicaSyncStates = append(replicaSyncStates, rss)
+	}
+
+	return
+}
+
+// general query
+
+func QueryReplicaSyncStates(conn DBConn, sql string, args ...interface{}) (replicaSyncStates []ReplicaSyncStateRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return replicaSyncStates, util.ProcessErr(err) }
+	defer rows.Close()
+
+	replicaSyncStates, err = ScanReplicaSyncStateRows(rows)
+	if err != nil { return replicaSyncStates, util.ProcessErr(err) }
+
+	return
+}
+
+func QueryReplicaSyncStateRow(conn DBConn, sql string, args ...interface{}) (replicaSyncState ReplicaSyncStateRecord, err error) {
+	records, err := QueryReplicaSyncStates(conn, sql, args...)
+	if err != nil { return replicaSyncState, util.ProcessErr(err) }
+	if len(records) != 1 { return replicaSyncState, util.ProcessErr(fmt.Errorf("Expected 1 record back, go %v.", len(records))) }
+	return records[0], nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Replication job statuses
+
+const (
+	ReplicationJobPending = "pending"
+	ReplicationJobRunning = "running"
+	ReplicationJobFailed = "failed"
+	ReplicationJobCompleted = "completed"
+)
+
+// type facilities
+
+type ReplicationJobRecord struct {
+	JobID int64 `json:"job_id"`
+	BucketID int64 `json:"bucket_id"`
+	DstStorageID int64 `json:"dst_storage_id"`
+	ObjectName string `json:"object_name"`
+	Status string `json:"status"`
+	Attempts int `json:"attempts"`
+	MaxAttempts int `json:"max_attempts"`
+	LastError string `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Until when the worker running the job holds it, null unless running.
+	LeaseExpiresAt *time.Time `json:"lease_expires_at"`
+}
+
+func ScanReplicationJobRows(rows pgx.Rows) (replicationJobs []ReplicationJobRecord, err error) {
+	for rows.Next() {
+		var rj ReplicationJobRecord
+
+		err = rows.Scan(
+			&rj.JobID,
+			&rj.BucketID,
+			&rj.DstStorageID,
+			&rj.ObjectName,
+			&rj.Status,
+			&rj.Attempts,
+			&rj.MaxAttempts,
+			&rj.LastError,
+			&rj.NextAttemptAt,
+			&rj.CreatedAt,
+			&rj.UpdatedAt,
+			&rj.LeaseExpiresAt,
+		)
+		if err != nil { return replicationJobs, util.ProcessErr(err) }
+
+		replicationJobs = append(replicationJobs, rj)
+	}
+
+	return
+}
+
+// general query
+
+func QueryReplicationJobs(conn DBConn, sql string, args ...interface{}) (replicationJobs []ReplicationJobRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return replicationJobs, util.ProcessErr(err) }
+	defer rows.Close()
+
+	replicationJobs, err = ScanReplicationJobRows(rows)
+	if err != nil { return replicationJobs, util.ProcessErr(err) }
+
+	return
+}
+
+func QueryReplicationJobRow(conn DBConn, sql string, args ...interface{}) (replicationJob ReplicationJobRecord, err error) {
+	records, err := QueryReplicationJobs(conn, sql, args...)
+	if err != nil { return replicationJob, util.ProcessErr(err) }
+	if len(records) != 1 { return replicationJob, util.ProcessErr(fmt.Errorf("Expected 1 record back, go %v.", len(records))) }
+	return records[0], nil
+}
+
+// Summaries
+
+type ReplicationJobSummaryRecord struct {
+	BucketID int64 `json:"bucket_id"`
+	BucketName string `json:"bucket_name"`
+	DstStorageID int64 `json:"dst_storage_id"`
+	DstStorageAlias string `json:"dst_storage_alias"`
+	Pending int64 `json:"pending"`
+	Running int64 `json:"running"`
+	Failed int64 `json:"failed"`
+	Completed int64 `json:"completed"`
+	LastUpdatedAt time.Time `json:"last_updated_at"`
+}
+
+func QueryReplicationJobSummaries(conn DBConn, sql string, args ...interface{}) (summaries []ReplicationJobSummaryRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return summaries, util.ProcessErr(err) }
+
+	defer rows.Close()
+	for rows.Next() {
+		var rjs ReplicationJobSummaryRecord
+		err = rows.Scan(&rjs.BucketID, &rjs.BucketName, &rjs.DstStorageID, &rjs.DstStorageAlias, &rjs.Pending, &rjs.Running, &rjs.Failed, &rjs.Completed, &rjs.LastUpdatedAt)
+		if err != nil { return summaries, util.ProcessErr(err) }
+		summaries = append(summaries, rjs)
+	}
+
+	return
+}
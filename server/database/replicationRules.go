@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Policy types
+
+// Scopes replication within a bucket to the objects whose keys match the
+// pattern, a glob if it contains any of *?[ and a key prefix otherwise.
+type ReplicationRule struct {
+	Pattern string `json:"pattern"`
+	Zones []string `json:"zones"`
+	TargetReplicaCount int `json:"target_replica_count"`
+}
+
+func (rr *ReplicationRule) IsGlob() bool {
+	return strings.ContainsAny(rr.Pattern, "*?[")
+}
+
+func (rr *ReplicationRule) Matches(key string) bool {
+	if rr.IsGlob() {
+		matched, _ := path.Match(rr.Pattern, key)
+		return matched
+	}
+	return strings.HasPrefix(key, rr.Pattern)
+}
+
+func ValidateReplicationRules(rules []ReplicationRule) (err error) {
+	patterns := make(map[string]bool)
+	for _, rr := range rules {
+		if rr.Pattern == "" {
+			return util.ProcessErr(fmt.Errorf("Replication rules need a pattern."))
+		} else if patterns[rr.Pattern] {
+			return util.ProcessErr(fmt.Errorf("Duplicate replication rule pattern '%v'.", rr.Pattern))
+		} else if rr.TargetReplicaCount < 0 {
+			return util.ProcessErr(fmt.Errorf("Replication rule '%v' has a negative replica count.", rr.Pattern))
+		}
+		if rr.IsGlob() {
+			if _, err = path.Match(rr.Pattern, ""); err != nil {
+				return util.ProcessErr(fmt.Errorf("Replication rule pattern '%v' is invalid: %v", rr.Pattern, err))
+			}
+		}
+		patterns[rr.Pattern] = true
+	}
+
+	return
+}
+
+// Returns the key of the first rule matching the object, or "" for objects
+// falling under the bucket-wide policies.
+func MatchReplicationRule(rules []ReplicationRule, key string) string {
+	for _, rr := range rules {
+		if rr.Matches(key) { return rr.Pattern }
+	}
+	return ""
+}
+
+// type facilities
+
+type ReplicaRuleLocationRecord struct {
+	BucketID int64 `json:"bucket_id"`
+	RuleKey string `json:"rule_key"`
+	StorageID int64 `json:"storage_id"`
+}
+
+func ScanReplicaRuleLocationRows(rows pgx.Rows) (replicaRuleLocations []ReplicaRuleLocationRecord, err error) {
+	for rows.Next() {
+		var rrlr ReplicaRuleLocationRecord
+
+		err = rows.Scan(
+			&rrlr.BucketID,
+			&rrlr.RuleKey,
+			&rrlr.StorageID,
+		)
+		if err != nil { return replicaRuleLocations, util.ProcessErr(err) }
+
+		replicaRuleLocations = append(replicaRuleLocations, rrlr)
+	}
+
+	return
+}
+
+// general query
+
+func QueryReplicaRuleLocations(conn DBConn, sql string, args ...interface{}) (replicaRuleLocations []ReplicaRuleLocationRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return replicaRuleLocations, util.ProcessErr(err) }
+	defer rows.Close()
+
+	replicaRuleLocations, err = ScanReplicaRuleLocationRows(rows)
+	if err != nil { return replicaRuleLocations, util.ProcessErr(err) }
+
+	return
+}
@@ -17,15 +17,27 @@ type ResourceCollection struct {
 	ClustersPolicies []ClusterPolicyRecord `json:"clusters_policies"`
 	FaaSDeployments []FaaSDeploymentRecord `json:"faas_deployments"`
 	StorageDeployments []StorageDeploymentRecord `json:"storage_deployments"`
+	StorageDeploymentsPolicies []StorageDeploymentPolicyRecord `json:"storage_deployments_policies"`
+	StorageHealthStates []StorageHealthStateRecord `json:"storage_health_states"`
+	FaaSDeploymentsPolicies []FaaSDeploymentPolicyRecord `json:"faas_deployments_policies"`
+	FaaSHealthStates []FaaSHealthStateRecord `json:"faas_health_states"`
+	FaaSLatencyWeights []FaaSLatencyWeightRecord `json:"faas_latency_weights"`
 	Buckets []BucketRecord `json:"buckets"`
 	BucketsPolicies []BucketPolicyRecord `json:"buckets_policies"`
 	ReplicaBucketsLocations []ReplicaBucketLocationRecord `json:"replica_bucket_locations"`
+	ReplicaSyncStates []ReplicaSyncStateRecord `json:"replica_sync_states"`
+	ReplicaRuleLocations []ReplicaRuleLocationRecord `json:"replica_rule_locations"`
+	BucketPlacementStatuses []BucketPlacementStatusRecord `json:"bucket_placement_statuses"`
+	PendingReplicaDeletions []PendingReplicaDeletionRecord `json:"pending_replica_deletions"`
+	BucketFailovers []BucketFailoverRecord `json:"bucket_failovers"`
 	Objects []ObjectRecord `json:"objects"`
 	LoadBalancerConfig map[string]LoadBalancerServerConfig `json:"load_balancer_config"`
+	LoadBalancerUpstreams []LoadBalancerUpstreamStatus `json:"load_balancer_upstreams"`
 	LoadBalancerHost string `json:"load_balancer_host"`
 	LoadBalancerPort string `json:"load_balancer_port"`
 	LoadBalancerMatchHeader string `json:"load_balancer_match_header"`
 	LoadBalancerPolicy string `json:"load_balancer_policy"`
+	LoadBalancerPolicyParams SelectionPolicyParams `json:"load_balancer_policy_params"`
 	LoadBalancerRoutes map[string]LoadBalancerRouteSettings `json:"load_balancer_routes"`
 	LoadBalancerRouteOverrides map[string]LoadBalancerRouteSettings `json:"load_balancer_route_overrides"`
 }
@@ -47,12 +59,32 @@ func QueryResources() (resources ResourceCollection, err error) {
 			return resources, util.ProcessErr(err)
 		} else if resources.StorageDeployments, err = QueryStorageDeployments(conn, "SELECT * FROM storage_deployments ORDER BY cluster_id ASC, alias"); err != nil {
 			return resources, util.ProcessErr(err)
+		} else if resources.StorageDeploymentsPolicies, err = QueryStorageDeploymentsPolicies(conn, "SELECT * FROM storage_deployments_policies"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.StorageHealthStates, err = QueryStorageHealthStates(conn, "SELECT * FROM storage_health_states ORDER BY storage_id"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.FaaSDeploymentsPolicies, err = QueryFaaSDeploymentsPolicies(conn, "SELECT * FROM faas_deployments_policies"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.FaaSHealthStates, err = QueryFaaSHealthStates(conn, "SELECT * FROM faas_health_states ORDER BY faas_id"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.FaaSLatencyWeights, err = QueryFaaSLatencyWeights(conn, "SELECT * FROM faas_latency_weights ORDER BY faas_id"); err != nil {
+			return resources, util.ProcessErr(err)
 		} else if resources.Buckets, err = QueryBuckets(conn, "SELECT * FROM buckets ORDER BY storage_id ASC, name"); err != nil {
 			return resources, util.ProcessErr(err)
 		} else if resources.BucketsPolicies, err = QueryBucketsPolicies(conn, "SELECT * FROM buckets_policies"); err != nil {
 			return resources, util.ProcessErr(err)
 		} else if resources.ReplicaBucketsLocations, err = QueryReplicaBucketLocations(conn, "SELECT * FROM replica_bucket_locations"); err != nil {
 			return resources, util.ProcessErr(err)
+		} else if resources.ReplicaSyncStates, err = QueryReplicaSyncStates(conn, "SELECT * FROM replica_sync_states ORDER BY bucket_id, storage_id"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.ReplicaRuleLocations, err = QueryReplicaRuleLocations(conn, "SELECT * FROM replica_rule_locations ORDER BY bucket_id, rule_key, storage_id"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.BucketPlacementStatuses, err = QueryBucketPlacementStatuses(conn, "SELECT * FROM bucket_placement_statuses ORDER BY bucket_id, rule_key"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.PendingReplicaDeletions, err = QueryPendingReplicaDeletions(conn, "SELECT * FROM pending_replica_deletions ORDER BY delete_after, deletion_id"); err != nil {
+			return resources, util.ProcessErr(err)
+		} else if resources.BucketFailovers, err = QueryBucketFailovers(conn, "SELECT * FROM bucket_failovers ORDER BY bucket_id"); err != nil {
+			return resources, util.ProcessErr(err)
 		} else if resources.Objects, err = QueryObjects(conn, "SELECT * FROM objects ORDER BY bucket_id ASC, name"); err != nil {
 			return resources, util.ProcessErr(err)
 		}
@@ -69,6 +101,9 @@ func QueryResources() (resources ResourceCollection, err error) {
 		if err != nil {
 			return resources, util.ProcessErr(err)
 		} else { resources.LoadBalancerPolicy = str }
+		if err = GetGlobalPolicy(conn, "lb_policy_params", &resources.LoadBalancerPolicyParams); err != nil {
+			return resources, util.ProcessErr(err)
+		}
 		
 		var r map[string]LoadBalancerRouteSettings
 		err = GetGlobalPolicy(conn, "lb_routes", &r)
@@ -87,6 +122,19 @@ func QueryResources() (resources ResourceCollection, err error) {
 			err = json.NewDecoder(resp.Body).Decode(&resources.LoadBalancerConfig)
 			if err != nil { return resources, util.ProcessErr(err) }
 		}
+
+		// Upstream health is informative only, older Caddy versions lack the
+		// endpoint.
+		if resp, err := http.Get(fmt.Sprintf("%v/reverse_proxy/upstreams", cli.Input.CaddyAdminURL)); err != nil {
+			util.PrintWarning(err)
+		} else {
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				util.PrintWarning(fmt.Errorf("Could not get the upstreams from Caddy, got status %v.", resp.Status))
+			} else if err = json.NewDecoder(resp.Body).Decode(&resources.LoadBalancerUpstreams); err != nil {
+				util.PrintWarning(err)
+			}
+		}
 	}
 
 	return
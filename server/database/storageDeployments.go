@@ -20,6 +20,7 @@ type StorageDeploymentRecord struct {
 	UseSSL bool `json:"use_ssl"`
 	SqsArn string `json:"sqs_arn"`
 	ManagementURL string `json:"management_url"`
+	Kind string `json:"kind"`
 }
 
 func ScanStorageDeploymentRows(rows pgx.Rows) (storageDeployments []StorageDeploymentRecord, err error) {
@@ -37,6 +38,7 @@ func ScanStorageDeploymentRows(rows pgx.Rows) (storageDeployments []StorageDeplo
 			&sd.UseSSL,
 			&sd.SqsArn,
 			&sd.ManagementURL,
+			&sd.Kind,
 		)
 		if err != nil { return storageDeployments, util.ProcessErr(err) }
 
@@ -69,8 +71,8 @@ func QueryStorageDeploymentRow(conn DBConn, sql string, args ...interface{}) (st
 // insert
 
 func InsertStorageDeployment(conn DBConn, sd StorageDeploymentRecord) (r StorageDeploymentRecord, err error) {
-	records, err := QueryStorageDeployments(conn, "INSERT INTO storage_deployments (cluster_id, minio_deployment_id, alias, endpoint, access_key, secret_key, use_ssl, sqs_arn, management_url) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *",
-		sd.ClusterID, sd.MinioDeploymentID, sd.Alias, sd.Endpoint, sd.AccessKey, sd.SecretKey, sd.UseSSL, sd.SqsArn, sd.ManagementURL)
+	records, err := QueryStorageDeployments(conn, "INSERT INTO storage_deployments (cluster_id, minio_deployment_id, alias, endpoint, access_key, secret_key, use_ssl, sqs_arn, management_url, kind) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *",
+		sd.ClusterID, sd.MinioDeploymentID, sd.Alias, sd.Endpoint, sd.AccessKey, sd.SecretKey, sd.UseSSL, sd.SqsArn, sd.ManagementURL, sd.Kind)
 	if err != nil {
 		return r, util.ProcessErr(err)
 	} else if len(records) != 1 {
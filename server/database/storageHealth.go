@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Bucket failover statuses. Failed over buckets fail back once their original
+// master is healthy, and as soon as it is in sync again.
+
+const (
+	FailoverActive = "failed-over"
+	FailoverFailingBack = "failing-back"
+)
+
+// type facilities
+
+type StorageHealthStateRecord struct {
+	StorageID int64 `json:"storage_id"`
+	Status string `json:"status"`
+	ConsecutiveSuccesses int `json:"consecutive_successes"`
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	LastLatencyMs *float64 `json:"last_latency_ms"`
+	LastError string `json:"last_error"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ScanStorageHealthStateRows(rows pgx.Rows) (storageHealthStates []StorageHealthStateRecord, err error) {
+	for rows.Next() {
+		var shs StorageHealthStateRecord
+
+		err = rows.Scan(
+			&shs.StorageID,
+			&shs.Status,
+			&shs.ConsecutiveSuccesses,
+			&shs.ConsecutiveFailures,
+			&shs.LastCheckedAt,
+			&shs.LastLatencyMs,
+			&shs.LastError,
+			&shs.UpdatedAt,
+		)
+		if err != nil { return storageHealthStates, util.ProcessErr(err) }
+
+		storageHealthStates = append(storageHealthStates, shs)
+	}
+
+	return
+}
+
+type BucketFailoverRecord struct {
+	BucketID int64 `json:"bucket_id"`
+	OriginalStorageID int64 `json:"original_storage_id"`
+	PromotedStorageID int64 `json:"promoted_storage_id"`
+	Status string `json:"status"`
+	FailedOverAt time.Time `json:"failed_over_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func ScanBucketFailoverRows(rows pgx.Rows) (bucketFailovers []BucketFailoverRecord, err error) {
+	for rows.Next() {
+		var bf BucketFailoverRecord
+
+		err = rows.Scan(
+			&bf.BucketID,
+			&bf.OriginalStorageID,
+			&bf.PromotedStorageID,
+			&bf.Status,
+			&bf.FailedOverAt,
+			&bf.UpdatedAt,
+		)
+		if err != nil { return bucketFailovers, util.ProcessErr(err) }
+
+		bucketFailovers = append(bucketFailovers, bf)
+	}
+
+	return
+}
+
+// general query
+
+func QueryStorageHealthStates(conn DBConn, sql string, args ...interface{}) (storageHealthStates []StorageHealthStateRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return storageHealthStates, util.ProcessErr(err) }
+	defer rows.Close()
+
+	storageHealthStates, err = ScanStorageHealthStateRows(rows)
+	if err != nil { return storageHealthStates, util.ProcessErr(err) }
+
+	return
+}
+
+func QueryStorageHealthStateRow(conn DBConn, sql string, args ...interface{}) (storageHealthState StorageHealthStateRecord, err error) {
+	records, err := QueryStorageHealthStates(conn, sql, args...)
+	if err != nil { return storageHealthState, util.ProcessErr(err) }
+	if len(records) != 1 { return storageHealthState, util.ProcessErr(fmt.Errorf("Expected 1 record back, go %v.", len(records))) }
+	return records[0], nil
+}
+
+func QueryBucketFailovers(conn DBConn, sql string, args ...interface{}) (bucketFailovers []BucketFailoverRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return bucketFailovers, util.ProcessErr(err) }
+	defer rows.Close()
+
+	bucketFailovers, err = ScanBucketFailoverRows(rows)
+	if err != nil { return bucketFailovers, util.ProcessErr(err) }
+
+	return
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -46,3 +47,32 @@ func Exec(conn DBConn, sql string, args ...interface{}) (ct pgconn.CommandTag, e
 	ct, err = conn.Exec(ctx, sql, args...)
 	return ct, util.ProcessErr(err)
 }
+
+// Forwards notifications on a PostgreSQL channel to wake, without blocking
+// when wake is full. Keeps a dedicated connection and re-listens after errors.
+func Listen(channel string, wake chan<- struct{}) {
+	for {
+		if conn, err := Acquire(); err != nil {
+			util.PrintErr(err)
+		} else {
+			if _, err = conn.Exec(ctx, "LISTEN " + pgx.Identifier{channel}.Sanitize()); err != nil {
+				util.PrintErr(err)
+			} else {
+				for err == nil {
+					if _, err = conn.Conn().WaitForNotification(ctx); err != nil {
+						util.PrintErr(err)
+					} else {
+						for i := 0; i < cap(wake); i++ {
+							select {
+							case wake <- struct{}{}:
+							default:
+							}
+						}
+					}
+				}
+			}
+			conn.Release()
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
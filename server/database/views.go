@@ -1,6 +1,8 @@
 package database
 
 import (
+	"time"
+
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
 	"github.com/smithyworks/FaDO/util"
@@ -78,3 +80,56 @@ func ScanBucketFaaSDeploymentRows(rows pgx.Rows) (bucketsFaaSDeployments []Bucke
 
 	return
 }
+
+type BucketFaaSLocationRecord struct {
+	BucketID int64 `json:"bucket_id"`
+	BucketName string `json:"bucket_name"`
+	StorageID int64 `json:"storage_id"`
+	IsMaster bool `json:"is_master"`
+	SyncStatus string `json:"sync_status"`
+	OutOfSyncSince *time.Time `json:"out_of_sync_since"`
+	FaaSID int64 `json:"faas_id"`
+	FaaSURL string `json:"faas_url"`
+}
+
+// Whether functions may read from this location: the master always, replicas
+// when in sync or out of sync for no longer than the threshold. Replicas whose
+// sync failed or was never tracked are not trusted.
+func (l *BucketFaaSLocationRecord) IsFresh(threshold time.Duration) bool {
+	if l.IsMaster || l.SyncStatus == ReplicaInSync { return true }
+	if l.SyncStatus == "" || l.SyncStatus == ReplicaFailed || l.OutOfSyncSince == nil { return false }
+	return time.Since(*l.OutOfSyncSince) <= threshold
+}
+
+func ScanBucketFaaSLocationRows(rows pgx.Rows) (bucketFaaSLocations []BucketFaaSLocationRecord, err error) {
+	for rows.Next() {
+		var bflr BucketFaaSLocationRecord
+
+		err = rows.Scan(
+			&bflr.BucketID,
+			&bflr.BucketName,
+			&bflr.StorageID,
+			&bflr.IsMaster,
+			&bflr.SyncStatus,
+			&bflr.OutOfSyncSince,
+			&bflr.FaaSID,
+			&bflr.FaaSURL,
+		)
+		if err != nil { return bucketFaaSLocations, util.ProcessErr(err) }
+
+		bucketFaaSLocations = append(bucketFaaSLocations, bflr)
+	}
+
+	return
+}
+
+func QueryBucketFaaSLocations(conn DBConn, sql string, args ...interface{}) (bucketFaaSLocations []BucketFaaSLocationRecord, err error) {
+	rows, err := Query(conn, sql, args...)
+	if err != nil { return bucketFaaSLocations, util.ProcessErr(err) }
+	defer rows.Close()
+
+	bucketFaaSLocations, err = ScanBucketFaaSLocationRows(rows)
+	if err != nil { return bucketFaaSLocations, util.ProcessErr(err) }
+
+	return
+}
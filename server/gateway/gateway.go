@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Routes are shared by all invocations and refreshed at this interval, in line
+// with how often the load balancer routes are reconciled.
+const routesTTL = 5 * time.Second
+
+var routes map[string]database.LoadBalancerRouteSettings
+var routesFetchedAt time.Time
+var routesMutex sync.Mutex
+
+// Looks up the route of a bucket, holding the same upstreams and selection
+// policy the load balancer would be configured with.
+func Route(bucketName string) (rs database.LoadBalancerRouteSettings, exists bool, err error) {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+
+	if routes == nil || time.Since(routesFetchedAt) > routesTTL {
+		conn, err := database.Acquire()
+		if err != nil { return rs, false, util.ProcessErr(err) }
+		defer conn.Release()
+
+		if routes, err = mutations.ResolveRoutes(conn); err != nil {
+			return rs, false, util.ProcessErr(err)
+		}
+		routesFetchedAt = time.Now()
+	}
+
+	rs, exists = routes[bucketName]
+	return
+}
+
+// Upstreams co-located with the storage deployments holding the current
+// version of an object, leaving out those the health monitor found unhealthy
+// like the load balancer's object routes do. None if the object is unknown or
+// has no healthy upstream.
+func ObjectUpstreams(conn database.DBConn, bucketName, objectName string) (upstreams []string, err error) {
+	objectFaaSLocations, err := database.QueryObjectFaaSLocations(conn, `SELECT * FROM object_faas_locations
+		WHERE bucket_name = $1 AND object_name = $2 AND faas_url NOT IN (SELECT fd.url FROM faas_deployments fd
+			INNER JOIN faas_health_states fhs ON fhs.faas_id = fd.faas_id WHERE fhs.status = $3)`, bucketName, objectName, database.HealthUnhealthy)
+	if err != nil { return upstreams, util.ProcessErr(err) }
+
+	for _, ofl := range objectFaaSLocations { upstreams = util.AddString(upstreams, ofl.FaaSURL) }
+
+	return
+}
+
+// FaaS URLs may be stored as bare host:port dial addresses.
+func UpstreamURL(upstream string) (*url.URL, error) {
+	if !strings.Contains(upstream, "://") { upstream = "http://" + upstream }
+
+	u, err := url.Parse(upstream)
+	if err != nil { return nil, util.ProcessErr(err) }
+	if u.Host == "" { return nil, util.ProcessErr(fmt.Errorf("Invalid upstream '%v'.", upstream)) }
+
+	return u, nil
+}
+
+// Picks an upstream for the request according to the route's selection policy,
+// which may set cookies on the response. The returned function must be called
+// once the request is done.
+func SelectUpstream(rs database.LoadBalancerRouteSettings, w http.ResponseWriter, r *http.Request) (upstream string, done func(), err error) {
+	var upstreams []string
+	for _, u := range rs.Upstreams {
+		if u != "" { upstreams = append(upstreams, u) }
+	}
+	if len(upstreams) == 0 {
+		return "", nil, util.ProcessErr(fmt.Errorf("No upstreams available for bucket %v.", rs.BucketName))
+	}
+
+	selectUpstream, exists := selectors[rs.Policy]
+	if !exists {
+		return "", nil, util.ProcessErr(fmt.Errorf("Selection policy '%v' of bucket %v is not supported by the gateway.", rs.Policy, rs.BucketName))
+	}
+
+	upstream = selectUpstream(rs, upstreams, w, r)
+	return upstream, trackConnection(upstream), nil
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type invocationStats struct {
+	requests int
+	errors int
+	latency time.Duration
+}
+
+// Invocations forwarded since the last flush, keyed by upstream.
+var invocations = make(map[string]*invocationStats)
+var invocationsMutex sync.Mutex
+
+// Counts an invocation towards the latency weight of its upstream. Server
+// errors and upstreams that could not be reached count as errors.
+func RecordInvocation(upstream string, latency time.Duration, failed bool) {
+	invocationsMutex.Lock()
+	defer invocationsMutex.Unlock()
+
+	stats, exists := invocations[upstream]
+	if !exists {
+		stats = &invocationStats{}
+		invocations[upstream] = stats
+	}
+	stats.requests++
+	stats.latency += latency
+	if failed { stats.errors++ }
+}
+
+// Stores the invocations counted since the last flush, for the latency weights
+// to be refreshed from.
+func FlushInvocationStats() (err error) {
+	invocationsMutex.Lock()
+	flushed := invocations
+	invocations = make(map[string]*invocationStats)
+	invocationsMutex.Unlock()
+	if len(flushed) == 0 { return }
+
+	conn, err := database.Acquire()
+	if err != nil { return util.ProcessErr(err) }
+	defer conn.Release()
+
+	for upstream, stats := range flushed {
+		latencyMs := float64(stats.latency) / float64(time.Millisecond)
+		if err = mutations.RecordFaaSInvocations(conn, upstream, stats.requests, stats.errors, latencyMs); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
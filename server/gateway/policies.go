@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+)
+
+// Chooses one of the non-empty upstreams of a bucket's route. Selectors may
+// set cookies on the response to the invocation.
+type selector func(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string
+
+// Go counterparts of the Caddy selection policies FaDO configures, one for each
+// policy of the catalog.
+var selectors = map[string]selector{
+	"random": selectRandom,
+	"round_robin": selectRoundRobin,
+	"least_conn": selectLeastConn,
+	"first": selectFirst,
+	"ip_hash": selectIPHash,
+	"uri_hash": selectURIHash,
+	"header": selectHeader,
+	"cookie": selectCookie,
+	database.WeightedPolicy: selectByWeight,
+	database.LatencyPolicy: selectByWeight,
+}
+
+func selectRandom(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	return upstreams[rand.Intn(len(upstreams))]
+}
+
+func selectFirst(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	return upstreams[0]
+}
+
+var roundRobinCounters = make(map[string]int)
+var roundRobinMutex sync.Mutex
+
+func selectRoundRobin(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	roundRobinMutex.Lock()
+	defer roundRobinMutex.Unlock()
+
+	i := roundRobinCounters[rs.BucketName] % len(upstreams)
+	roundRobinCounters[rs.BucketName] = i + 1
+	return upstreams[i]
+}
+
+var activeConnections = make(map[string]int)
+var activeConnectionsMutex sync.Mutex
+
+func trackConnection(upstream string) (done func()) {
+	activeConnectionsMutex.Lock()
+	activeConnections[upstream]++
+	activeConnectionsMutex.Unlock()
+
+	return func() {
+		activeConnectionsMutex.Lock()
+		activeConnections[upstream]--
+		activeConnectionsMutex.Unlock()
+	}
+}
+
+// Ties are broken at random, like Caddy does.
+func selectLeastConn(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	activeConnectionsMutex.Lock()
+	defer activeConnectionsMutex.Unlock()
+
+	var candidates []string
+	least := -1
+	for _, u := range upstreams {
+		if n := activeConnections[u]; least == -1 || n < least {
+			least = n
+			candidates = []string{u}
+		} else if n == least {
+			candidates = append(candidates, u)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+func selectByWeight(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	return selectWeighted(upstreams, rs.Weights)
+}
+
+// Picks upstreams in proportion to their weights, weighing those the weights
+// leave out like the load balancer does.
+func selectWeighted(upstreams []string, weights map[string]int) string {
+	total := 0
+	upstreamWeights := make([]int, len(upstreams))
+	for i, u := range upstreams {
+		upstreamWeights[i] = mutations.UpstreamWeight(weights, u)
+		total += upstreamWeights[i]
+	}
+	if total <= 0 { return upstreams[rand.Intn(len(upstreams))] }
+
+	n := rand.Intn(total)
+	for i, w := range upstreamWeights {
+		if n < w { return upstreams[i] }
+		n -= w
+	}
+	return upstreams[len(upstreams) - 1]
+}
+
+func hashIndex(s string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return int(h.Sum32() % uint32(n))
+}
+
+func selectIPHash(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil { ip = r.RemoteAddr }
+	return upstreams[hashIndex(ip, len(upstreams))]
+}
+
+func selectURIHash(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	return upstreams[hashIndex(r.RequestURI, len(upstreams))]
+}
+
+// Requests lacking the header go to an upstream at random, like Caddy does.
+func selectHeader(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	var field string
+	if rs.PolicyParams != nil { field = rs.PolicyParams.Field }
+
+	value := r.Header.Get(field)
+	if field == "" || value == "" { return selectRandom(rs, upstreams, w, r) }
+	return upstreams[hashIndex(value, len(upstreams))]
+}
+
+const defaultCookieName = "lb"
+
+// Sticks to the upstream remembered in the cookie while it is still one of the
+// route's, and otherwise picks one at random and remembers it. The cookie holds
+// the upstream signed with the secret, as Caddy does, so clients cannot pick
+// their own.
+func selectCookie(rs database.LoadBalancerRouteSettings, upstreams []string, w http.ResponseWriter, r *http.Request) string {
+	name, secret := defaultCookieName, ""
+	if rs.PolicyParams != nil {
+		if rs.PolicyParams.Name != "" { name = rs.PolicyParams.Name }
+		secret = rs.PolicyParams.Secret
+	}
+
+	if cookie, err := r.Cookie(name); err == nil {
+		for _, u := range upstreams {
+			if hmac.Equal([]byte(cookie.Value), []byte(hashCookie(secret, u))) { return u }
+		}
+	}
+
+	upstream := selectRandom(rs, upstreams, w, r)
+	http.SetCookie(w, &http.Cookie{Name: name, Value: hashCookie(secret, upstream), Path: "/", Secure: r.TLS != nil})
+	return upstream
+}
+
+func hashCookie(secret, upstream string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(upstream))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+)
+
+func TestSelectorsCoverCatalog(t *testing.T) {
+	for _, sp := range mutations.SelectionPolicies {
+		if _, exists := selectors[sp.Name]; !exists { t.Errorf("no selector for selection policy %v", sp.Name) }
+	}
+}
+
+func TestSelectHeader(t *testing.T) {
+	upstreams := []string{"faas-1:8080", "faas-2:8080", "faas-3:8080"}
+	rs := database.LoadBalancerRouteSettings{BucketName: "meow", Policy: "header", PolicyParams: &database.SelectionPolicyParams{Field: "X-User"}}
+
+	tests := []struct {
+		name string
+		value string
+	}{
+		{"alice", "alice"},
+		{"bob", "bob"},
+		{"carol", "carol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-User", tt.value)
+			want := upstreams[hashIndex(tt.value, len(upstreams))]
+			for i := 0; i < 5; i++ {
+				if got := selectHeader(rs, upstreams, httptest.NewRecorder(), r); got != want { t.Fatalf("selectHeader = %v, want %v", got, want) }
+			}
+		})
+	}
+}
+
+func TestSelectCookie(t *testing.T) {
+	upstreams := []string{"faas-1:8080", "faas-2:8080", "faas-3:8080"}
+
+	tests := []struct {
+		name string
+		params *database.SelectionPolicyParams
+		cookieName string
+	}{
+		{"default name", nil, "lb"},
+		{"named", &database.SelectionPolicyParams{Name: "sticky"}, "sticky"},
+		{"signed", &database.SelectionPolicyParams{Name: "sticky", Secret: "s3cr3t"}, "sticky"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := database.LoadBalancerRouteSettings{BucketName: "meow", Policy: "cookie", PolicyParams: tt.params}
+
+			w := httptest.NewRecorder()
+			first := selectCookie(rs, upstreams, w, httptest.NewRequest("GET", "/", nil))
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != tt.cookieName { t.Fatalf("cookies = %v, want one named %v", cookies, tt.cookieName) }
+			if cookies[0].Value == first { t.Errorf("cookie holds the upstream in the clear") }
+
+			for i := 0; i < 5; i++ {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.AddCookie(cookies[0])
+				w := httptest.NewRecorder()
+				if got := selectCookie(rs, upstreams, w, r); got != first { t.Fatalf("selectCookie = %v, want %v", got, first) }
+				if len(w.Result().Cookies()) != 0 { t.Errorf("cookie set again for a known upstream") }
+			}
+
+			// A cookie for an upstream no longer in the route is replaced.
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: tt.cookieName, Value: hashCookie("", "gone:8080")})
+			w = httptest.NewRecorder()
+			selectCookie(rs, upstreams, w, r)
+			if len(w.Result().Cookies()) != 1 { t.Errorf("cookie for a removed upstream not replaced") }
+		})
+	}
+}
+
+func TestSelectWeighted(t *testing.T) {
+	tests := []struct {
+		name string
+		upstreams []string
+		weights map[string]int
+		want map[string]float64
+	}{
+		{"proportional", []string{"a", "b"}, map[string]int{"a": 3, "b": 1}, map[string]float64{"a": 0.75, "b": 0.25}},
+		{"zero weight never picked", []string{"a", "b"}, map[string]int{"a": 1, "b": 0}, map[string]float64{"a": 1}},
+		{"missing upstream weighs 1", []string{"a", "b", "c"}, map[string]int{"a": 2, "b": 4}, map[string]float64{"a": 2.0 / 7, "b": 4.0 / 7, "c": 1.0 / 7}},
+		{"no weights", []string{"a", "b"}, nil, map[string]float64{"a": 0.5, "b": 0.5}},
+		{"all zero picks at random", []string{"a", "b"}, map[string]int{"a": 0, "b": 0}, map[string]float64{"a": 0.5, "b": 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const n = 20000
+			counts := make(map[string]int)
+			for i := 0; i < n; i++ { counts[selectWeighted(tt.upstreams, tt.weights)]++ }
+
+			for _, u := range tt.upstreams {
+				share := float64(counts[u]) / n
+				if math.Abs(share - tt.want[u]) > 0.03 { t.Errorf("%v picked %.3f of the time, want %.3f", u, share, tt.want[u]) }
+			}
+		})
+	}
+}
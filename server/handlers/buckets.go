@@ -17,14 +17,49 @@ type BucketsInput struct {
 	Bucket database.BucketRecord `json:"bucket"`
 	TargetReplicaCount int `json:"target_replica_count"`
 	Zones []string `json:"zones"`
+	// Left unchanged when omitted.
+	DeniedZones []string `json:"denied_zones"`
 	ReplicaStorageIDs []int64 `json:"replica_storage_ids"`
+	// Left unchanged when omitted.
+	ReplicationRules []database.ReplicationRule `json:"replication_rules"`
+	// Left unchanged when omitted.
+	SpreadConstraints []database.SpreadConstraint `json:"spread_constraints"`
 }
 
 func (bi *BucketsInput) IsValid() bool {
 	if bi.Zones == nil { bi.Zones = make([]string, 0) }
+	if err := database.ValidateReplicationRules(bi.ReplicationRules); err != nil { util.PrintErr(err); return false }
+	if err := database.ValidateSpreadConstraints(bi.SpreadConstraints); err != nil { util.PrintErr(err); return false }
 	return bi.Bucket.Name != "" && bi.Bucket.StorageID != 0
 }
 
+func setBucketDeniedZones(conn database.DBConn, input BucketsInput) (err error) {
+	if input.DeniedZones == nil { return }
+
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE name = $1", input.Bucket.Name)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(mutations.SetBucketDeniedZones(conn, bucket, input.DeniedZones))
+}
+
+func setBucketReplicationRules(conn database.DBConn, input BucketsInput) (err error) {
+	if input.ReplicationRules == nil { return }
+
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE name = $1", input.Bucket.Name)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(mutations.SetBucketReplicationRules(conn, bucket, input.ReplicationRules))
+}
+
+func setBucketSpreadConstraints(conn database.DBConn, input BucketsInput) (err error) {
+	if input.SpreadConstraints == nil { return }
+
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE name = $1", input.Bucket.Name)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(mutations.SetBucketSpreadConstraints(conn, bucket, input.SpreadConstraints))
+}
+
 func Buckets(w http.ResponseWriter, r *http.Request) {
     if r.Method == "GET" {
         SendResources(w)
@@ -47,10 +82,22 @@ func Buckets(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if err = mutations.AddMasterBucket(tx, input.Bucket, input.TargetReplicaCount, input.Zones, input.ReplicaStorageIDs); err != nil {
-				util.PrintErr(err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if err = mutations.AddMasterBucket(conn, input.Bucket, input.TargetReplicaCount, input.Zones, input.ReplicaStorageIDs); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setBucketDeniedZones(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setBucketReplicationRules(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setBucketSpreadConstraints(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
 				return
 			} else {
 				tx.Commit(ctx)
@@ -77,9 +124,21 @@ func Buckets(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
-			if err = mutations.EditMasterBucket(tx, input.Bucket, input.TargetReplicaCount, input.Zones, input.ReplicaStorageIDs); err != nil {
-				util.PrintErr(err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			conn, plan := planConn(r, tx)
+			if err = mutations.EditMasterBucket(conn, input.Bucket, input.TargetReplicaCount, input.Zones, input.ReplicaStorageIDs); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setBucketDeniedZones(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setBucketReplicationRules(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setBucketSpreadConstraints(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
 				return
 			} else {
 				tx.Commit(ctx)
@@ -110,16 +169,20 @@ func Bucket(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if bucket, err := database.QueryBucketRow(tx, "SELECT * FROM buckets WHERE bucket_id = $1", bucket_id); err != nil {
+			if bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bucket_id); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			} else {
-				if err = mutations.DeleteMasterBucket(tx, bucket); err != nil {
+				if err = mutations.DeleteMasterBucket(conn, bucket); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
+				} else if plan != nil {
+					sendPlan(w, conn, plan)
+					return
 				} else {
 					tx.Commit(ctx)
 				}
@@ -16,6 +16,8 @@ import (
 type ClustersInput struct {
 	Cluster database.ClusterRecord `json:"cluster"`
 	Zones []string `json:"zones"`
+	// Left unchanged when omitted.
+	FailureDomains map[string]string `json:"failure_domains"`
 }
 
 func (ci *ClustersInput) IsValid() bool {
@@ -23,6 +25,15 @@ func (ci *ClustersInput) IsValid() bool {
 	return ci.Cluster.Name != ""
 }
 
+func setClusterFailureDomains(conn database.DBConn, input ClustersInput) (err error) {
+	if input.FailureDomains == nil { return }
+
+	cluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE name = $1", input.Cluster.Name)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(mutations.SetClusterFailureDomains(conn, cluster, input.FailureDomains))
+}
+
 func Clusters(w http.ResponseWriter, r *http.Request) {
     if r.Method  == "GET" {
         SendResources(w)
@@ -45,10 +56,16 @@ func Clusters(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if err = mutations.AddCluster(tx, input.Cluster, input.Zones); err != nil {
-				util.PrintErr(err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if err = mutations.AddCluster(conn, input.Cluster, input.Zones); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setClusterFailureDomains(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
 				return
 			} else {
 				tx.Commit(ctx)
@@ -75,10 +92,16 @@ func Clusters(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if err = mutations.EditCluster(tx, input.Cluster, input.Zones); err != nil {
-				util.PrintErr(err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if err = mutations.EditCluster(conn, input.Cluster, input.Zones); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setClusterFailureDomains(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
 				return
 			} else {
 				tx.Commit(ctx)
@@ -111,16 +134,20 @@ func Cluster(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if cluster, err := database.QueryClusterRow(tx, "SELECT * FROM clusters WHERE cluster_id = $1", cluster_id); err != nil {
+			if cluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE cluster_id = $1", cluster_id); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			} else {
-				if err = mutations.DeleteCluster(tx, cluster, permanent); err != nil {
+				if err = mutations.DeleteCluster(conn, cluster, permanent); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
+				} else if plan != nil {
+					sendPlan(w, conn, plan)
+					return
 				} else {
 					tx.Commit(ctx)
 				}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/smithyworks/FaDO/config"
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Returns the current topology as a configuration file, in JSON unless
+// format=yaml is given. Storage deployment credentials are included.
+func ConfigExport(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/config/export", "GET", nil) { return }
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "yaml" {
+		util.PrintErr(fmt.Errorf("Expected json or yaml for format, got %v.", format))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	pc, err := config.Export(conn)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := config.Marshal(pc, format)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Write(data)
+}
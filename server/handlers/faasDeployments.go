@@ -15,12 +15,27 @@ import (
 
 type FaaSInput struct {
 	FaaSDeployment database.FaaSDeploymentRecord `json:"faas_deployment"`
+	// Health check policies overriding the global ones, null values remove
+	// the override. Left unchanged when omitted.
+	Policies map[string]interface{} `json:"policies"`
 }
 
 func (fi *FaaSInput) IsValid() bool {
+	for name, value := range fi.Policies {
+		if mutations.ValidateHealthCheckPolicy(name, value) != nil { return false }
+	}
 	return fi.FaaSDeployment.URL != "" && fi.FaaSDeployment.ClusterID != 0
 }
 
+func setFaaSDeploymentPolicies(conn database.DBConn, input FaaSInput) (err error) {
+	if input.Policies == nil { return }
+
+	fd, err := database.QueryFaaSDeploymentRow(conn, "SELECT * FROM faas_deployments WHERE url = $1", input.FaaSDeployment.URL)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(mutations.SetFaaSDeploymentPolicies(conn, fd, input.Policies))
+}
+
 type FaaSDeleteInput struct {
 	FaaSID int64 `json:"faas_id"`
 }
@@ -47,11 +62,19 @@ func FaaSDeployments(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if err = mutations.AddFaaSDeployment(tx, input.FaaSDeployment); err != nil {
+			if err = mutations.AddFaaSDeployment(conn, input.FaaSDeployment); err != nil {
+				util.PrintErr(err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			} else if err = setFaaSDeploymentPolicies(conn, input); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
+				return
 			} else {
 				tx.Commit(ctx)
 			}
@@ -77,11 +100,19 @@ func FaaSDeployments(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if err = mutations.EditFaaSDeployment(tx, input.FaaSDeployment); err != nil {
+			if err = mutations.EditFaaSDeployment(conn, input.FaaSDeployment); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
+			} else if err = setFaaSDeploymentPolicies(conn, input); err != nil {
+				util.PrintErr(err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
+				return
 			} else {
 				tx.Commit(ctx)
 			}
@@ -111,16 +142,20 @@ func FaaSDeployment(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if faas, err := database.QueryFaaSDeploymentRow(tx, "SELECT * FROM faas_deployments WHERE faas_id = $1", faas_id); err != nil {
+			if faas, err := database.QueryFaaSDeploymentRow(conn, "SELECT * FROM faas_deployments WHERE faas_id = $1", faas_id); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			} else {
-				if err = mutations.DeleteFaaSDeployment(tx, faas); err != nil {
+				if err = mutations.DeleteFaaSDeployment(conn, faas); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
+				} else if plan != nil {
+					sendPlan(w, conn, plan)
+					return
 				} else {
 					tx.Commit(ctx)
 				}
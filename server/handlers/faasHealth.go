@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+const defaultFaaSHealthHistoryLimit = 100
+
+// Lists the health of the FaaS deployments probed so far, optionally filtered
+// by status.
+func FaaSHealth(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/faas-health", "GET", nil) { return }
+
+	sql := "SELECT * FROM faas_health_states"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		args = append(args, status)
+		sql += " WHERE status = $1"
+	}
+	sql += " ORDER BY faas_id"
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	states, err := database.QueryFaaSHealthStates(conn, sql, args...)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if states == nil { states = []database.FaaSHealthStateRecord{} }
+
+	statesJSON, err := json.Marshal(states)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statesJSON)
+}
+
+// Lists the latest health checks of a FaaS deployment, newest first, up to
+// limit of them.
+func FaaSHealthHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		util.PrintErr(fmt.Errorf("Method not supported. Got %v.", r.Method))
+		http.Error(w, "Method Not Supported", http.StatusNotFound)
+		return
+	}
+
+	faas_id, err := strconv.Atoi(mux.Vars(r)["faas_id"])
+	if err != nil {
+		util.PrintErr(fmt.Errorf("Path not found. Expected %v, got %v.", "/api/faas-health/<int>", r.URL.RequestURI()))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	limit := defaultFaaSHealthHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			util.PrintErr(fmt.Errorf("Expected a positive integer for limit, got %v.", value))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	checks, err := database.QueryFaaSHealthChecks(conn, "SELECT * FROM faas_health_checks WHERE faas_id = $1 ORDER BY checked_at DESC, check_id DESC LIMIT $2", faas_id, limit)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if checks == nil { checks = []database.FaaSHealthCheckRecord{} }
+
+	checksJSON, err := json.Marshal(checks)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(checksJSON)
+}
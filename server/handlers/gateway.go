@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/gateway"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Forwards /invoke/<bucket>/<path> to <path> on one of the bucket's eligible
+// FaaS deployments, chosen with the route's selection policy. Requests naming
+// an object, in the object header or query parameter, go to the FaaS
+// deployments co-located with that object when it is known. The bucket is
+// also passed on in the load balancer's match header. The latency and outcome
+// of each invocation count towards the latency weight of its upstream.
+func Invoke(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bucketName := vars["bucket"]
+
+	rs, exists, err := gateway.Route(bucketName)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if !exists {
+		util.PrintErr(fmt.Errorf("No route for bucket %v.", bucketName))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var matchHeader, objectHeader, objectQueryParam string
+	var routeOverridesMap map[string]database.LoadBalancerRouteSettings
+	if err = database.GetGlobalPolicy(conn, "lb_match_header", &matchHeader); err == nil {
+		if err = database.GetGlobalPolicy(conn, "lb_object_header", &objectHeader); err == nil {
+			if err = database.GetGlobalPolicy(conn, "lb_object_query_param", &objectQueryParam); err == nil {
+				err = database.GetGlobalPolicy(conn, "lb_route_overrides", &routeOverridesMap)
+			}
+		}
+	}
+	if err == nil {
+		objectName := r.Header.Get(objectHeader)
+		if objectName == "" { objectName = r.URL.Query().Get(objectQueryParam) }
+		// Overridden routes are used as configured, like on the load balancer.
+		if _, isOverridden := routeOverridesMap[bucketName]; objectName != "" && !isOverridden {
+			var upstreams []string
+			if upstreams, err = gateway.ObjectUpstreams(conn, bucketName, objectName); len(upstreams) > 0 {
+				rs.Upstreams = upstreams
+				// Weighed for the object's upstreams, not the bucket's.
+				if rs.Weights != nil { rs.Weights, err = mutations.ObjectRouteWeights(conn, rs, upstreams) }
+			}
+		}
+	}
+	conn.Release()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	upstream, done, err := gateway.SelectUpstream(rs, w, r)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer done()
+
+	target, err := gateway.UpstreamURL(upstream)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		req.URL.Path = "/" + vars["path"]
+		req.URL.RawPath = ""
+		director(req)
+		req.Host = target.Host
+		req.Header.Set(matchHeader, bucketName)
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		util.PrintErr(err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	proxy.ServeHTTP(recorder, r)
+	gateway.RecordInvocation(upstream, time.Since(start), recorder.status >= 500)
+}
+
+// Keeps the status the invocation was answered with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Streamed answers are flushed as they come, like without the recorder.
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok { f.Flush() }
+}
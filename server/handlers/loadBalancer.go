@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"reflect"
 
 	"github.com/smithyworks/FaDO/database"
 	"github.com/smithyworks/FaDO/mutations"
@@ -14,19 +13,32 @@ import (
 type LBSettingsInput struct {
 	MatchHeader string `json:"match_header"`
 	Policy string `json:"policy"`
+	PolicyParams *database.SelectionPolicyParams `json:"policy_params"`
+	// Global health check policies, null values restore the default. Left
+	// unchanged when omitted.
+	HealthChecks map[string]interface{} `json:"health_checks"`
 }
 
-func (i *LBSettingsInput) IsValid() bool {
-	return i.Policy != "" && i.MatchHeader != ""
+func (i *LBSettingsInput) Validate() (err error) {
+	for name, value := range i.HealthChecks {
+		if err = mutations.ValidateHealthCheckPolicy(name, value); err != nil { return util.ProcessErr(err) }
+	}
+	if i.MatchHeader == "" { return util.ProcessErr(fmt.Errorf("Expected a match header.")) }
+	return util.ProcessErr(mutations.ValidateSelectionPolicy(i.Policy, i.PolicyParams))
 }
 
 type LBOverridesInput struct {
 	RouteOverrides map[string]database.LoadBalancerRouteSettings `json:"route_overrides"`
 }
 
-func (i *LBOverridesInput) IsValid() bool {
+func (i *LBOverridesInput) Validate() (err error) {
 	if i.RouteOverrides == nil { i.RouteOverrides = make(map[string]database.LoadBalancerRouteSettings) }
-	return true
+	for bucketName, rs := range i.RouteOverrides {
+		if err = mutations.ValidateRouteOverride(rs); err != nil {
+			return util.ProcessErr(fmt.Errorf("Invalid route override of bucket %v: %v", bucketName, validationReason(err)))
+		}
+	}
+	return
 }
 
 func LoadBalancer(w http.ResponseWriter, r *http.Request) {
@@ -40,9 +52,8 @@ func LoadBalancer(w http.ResponseWriter, r *http.Request) {
 				util.PrintErr(err)
 				http.Error(w, "Bad Request", http.StatusBadRequest)
 				return
-			} else if !input.IsValid() {
-				util.PrintErr(fmt.Errorf("Invalid input. Got %+v of type %v.", input, reflect.TypeOf(input)))
-				http.Error(w, "Bad Request", http.StatusBadRequest)
+			} else if err := input.Validate(); err != nil {
+				sendValidationError(w, err)
 				return
 			}
 
@@ -52,24 +63,42 @@ func LoadBalancer(w http.ResponseWriter, r *http.Request) {
 				return
 			} else {
 				defer tx.Rollback(ctx)
+				conn, plan := planConn(r, tx)
 
-				if err := database.SetGlobalPolicy(tx, "lb_match_header", input.MatchHeader); err != nil {
+				if err := database.SetGlobalPolicy(conn, "lb_match_header", input.MatchHeader); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
-				if err := database.SetGlobalPolicy(tx, "lb_policy", input.Policy); err != nil {
+				if err := database.SetGlobalPolicy(conn, "lb_policy", input.Policy); err != nil {
+					util.PrintErr(err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				if input.PolicyParams == nil { input.PolicyParams = &database.SelectionPolicyParams{} }
+				if err := database.SetGlobalPolicy(conn, "lb_policy_params", input.PolicyParams); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
-				if err := mutations.ConfigureLoadBalancer(tx); err != nil {
+				if input.HealthChecks != nil {
+					if err := mutations.SetHealthCheckPolicies(conn, input.HealthChecks); err != nil {
+						util.PrintErr(err)
+						http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+						return
+					}
+				} else if err := mutations.ConfigureLoadBalancer(conn); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
+				if plan != nil {
+					sendPlan(w, conn, plan)
+					return
+				}
+
 				if err := tx.Commit(ctx); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -82,9 +111,8 @@ func LoadBalancer(w http.ResponseWriter, r *http.Request) {
 				util.PrintErr(err)
 				http.Error(w, "Bad Request", http.StatusBadRequest)
 				return
-			} else if !input.IsValid() {
-				util.PrintErr(fmt.Errorf("Invalid input. Got %+v of type %v.", input, reflect.TypeOf(input)))
-				http.Error(w, "Bad Request", http.StatusBadRequest)
+			} else if err := input.Validate(); err != nil {
+				sendValidationError(w, err)
 				return
 			}
 
@@ -94,19 +122,25 @@ func LoadBalancer(w http.ResponseWriter, r *http.Request) {
 				return
 			} else {
 				defer tx.Rollback(ctx)
+				conn, plan := planConn(r, tx)
 	
-				if err := database.SetGlobalPolicy(tx, "lb_route_overrides", input.RouteOverrides); err != nil {
+				if err := database.SetGlobalPolicy(conn, "lb_route_overrides", input.RouteOverrides); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
-				if err := mutations.ConfigureLoadBalancer(tx); err != nil {
+				if err := mutations.ConfigureLoadBalancer(conn); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
 
+				if plan != nil {
+					sendPlan(w, conn, plan)
+					return
+				}
+
 				if err := tx.Commit(ctx); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -126,4 +160,20 @@ func LoadBalancer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method Not Supported", http.StatusNotFound)
 		return
 	}
-}
\ No newline at end of file
+}
+
+// Lists the selection policies routes can be load balanced with, and their
+// parameters.
+func LoadBalancerPolicies(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/load-balancer/policies", "GET", nil) { return }
+
+	policiesJSON, err := json.Marshal(mutations.SelectionPolicies)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(policiesJSON)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/smithyworks/FaDO/database"
@@ -16,7 +17,24 @@ type NotifyRecordResponseElements struct {
     DeploymentID string `json:"x-minio-deployment-id"`
 }
 
+type NotifyRecordBucket struct {
+    Name string `json:"name"`
+}
+
+type NotifyRecordObject struct {
+    Key string `json:"key"`
+    Size int64 `json:"size"`
+    ETag string `json:"eTag"`
+}
+
+type NotifyRecordS3 struct {
+    Bucket NotifyRecordBucket `json:"bucket"`
+    Object NotifyRecordObject `json:"object"`
+}
+
 type NotifyRecord struct {
+    EventName string `json:"eventName"`
+    S3 NotifyRecordS3 `json:"s3"`
     ResponseElements NotifyRecordResponseElements `json:"responseElements"`
 }
 
@@ -37,40 +55,54 @@ func Notify(w http.ResponseWriter, r *http.Request) {
     fmt.Fprintf(w, "OK")
 
     err := json.NewDecoder(r.Body).Decode(&input)
-    if err != nil || len(input.Records) < 1 { log.Println("INFO: Notify: input not actionable.") }
+    if err != nil || len(input.Records) < 1 { log.Println("INFO: Notify: input not actionable."); return }
 
-    name := input.Key
+    tx, err := database.Begin()
+    if err != nil { util.PrintErr(err); return }
+    defer tx.Rollback(ctx)
 
-    var minioDeploymentID string
-    for _, r := range input.Records {
-        if r.ResponseElements.DeploymentID != "" {
-            minioDeploymentID = r.ResponseElements.DeploymentID
+    for _, record := range input.Records {
+        if err = processNotifyRecord(tx, record); err != nil {
+            util.PrintErr(err); return
         }
     }
-    if minioDeploymentID == "" { return }
 
-    nameTokens := strings.Split(name, "/")
-    bucketName := nameTokens[0]
+    tx.Commit(ctx)
+}
 
-    log.Printf("INFO: Notify on %v (%v).", bucketName, minioDeploymentID)
+// Tracks the single object named in an event record and queues its replication,
+// provided the event originates from the bucket's master storage deployment.
+func processNotifyRecord(conn database.DBConn, record NotifyRecord) (err error) {
+    minioDeploymentID := record.ResponseElements.DeploymentID
+    bucketName := record.S3.Bucket.Name
+    if minioDeploymentID == "" || bucketName == "" { return }
 
-    tx, err := database.Begin()
-    if err != nil { util.PrintErr(err); return }
-    defer tx.Rollback(ctx)
+    // Object keys are URL-encoded in MinIO event records.
+    key, err := url.QueryUnescape(record.S3.Object.Key)
+    if err != nil { return util.ProcessErr(err) }
 
-    bucket, err := database.QueryBucketRow(tx, "SELECT * FROM buckets WHERE name = $1", bucketName)
-    if err != nil { util.PrintErr(err); return }
-    storageDeployment, err := database.QueryStorageDeploymentRow(tx, "SELECT * FROM storage_deployments WHERE minio_deployment_id = $1", minioDeploymentID)
+    log.Printf("INFO: Notify %v on %v/%v (%v).", record.EventName, bucketName, key, minioDeploymentID)
+
+    bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE name = $1", bucketName)
+    if err != nil { return util.ProcessErr(err) }
+    storageDeployment, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE minio_deployment_id = $1", minioDeploymentID)
+    if err != nil { return util.ProcessErr(err) }
 
     if bucket.StorageID != storageDeployment.StorageID { return }
 
-    if err = mutations.TrackBucketObjects(tx, bucket); err != nil {
-        util.PrintErr(err); return
+    object := database.ObjectRecord{BucketID: bucket.BucketID, Name: key, ETag: record.S3.Object.ETag, Size: record.S3.Object.Size}
+    if strings.HasPrefix(record.EventName, "s3:ObjectCreated:") {
+        err = mutations.TrackObject(conn, object)
+    } else if strings.HasPrefix(record.EventName, "s3:ObjectRemoved:") {
+        err = mutations.UntrackObject(conn, object)
+    } else {
+        return
     }
+    if err != nil { return util.ProcessErr(err) }
 
-    if err = mutations.ReplicateBucket(tx, bucketName); err != nil {
-        util.PrintErr(err); return
+    if err = mutations.EnqueueBucketReplicationJobs(conn, bucket.Name, key); err != nil {
+        return util.ProcessErr(err)
     }
 
-    tx.Commit(ctx)
+    return
 }
@@ -2,16 +2,15 @@ package handlers
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/minio/minio-go/v7"
 	"github.com/smithyworks/FaDO/database"
 	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/storage"
 	"github.com/smithyworks/FaDO/util"
 )
 
@@ -63,7 +62,7 @@ func Objects(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var bucket database.BucketRecord
-		var client *minio.Client
+		var backend storage.Backend
 		if conn, err := database.Acquire(); err != nil {
 			util.PrintErr(err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -79,12 +78,12 @@ func Objects(w http.ResponseWriter, r *http.Request) {
 				bucket = b
 			}
 
-			if c, err := mutations.CreateMinioClient(conn, bucket.StorageID); err != nil {
+			if b, err := mutations.CreateStorageBackend(conn, bucket.StorageID); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			} else {
-				client = c
+				backend = b
 			}
 
 			file, handler, err := r.FormFile("file")
@@ -95,13 +94,22 @@ func Objects(w http.ResponseWriter, r *http.Request) {
 			}
 			defer file.Close()
 	
-			if _, err = client.PutObject(ctx, bucket.Name, handler.Filename, file, handler.Size, minio.PutObjectOptions{}); err != nil {
+			info, err := backend.PutObject(bucket.Name, handler.Filename, file, handler.Size, storage.PutOptions{ContentType: handler.Header.Get("Content-Type")})
+			if err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
-			if _, err = database.InsertObject(conn, database.ObjectRecord{BucketID: bucket.BucketID, Name: handler.Filename}); err != nil {
+			// The notification for this upload may already have tracked the object.
+			if err = mutations.TrackObject(conn, database.ObjectRecord{BucketID: bucket.BucketID, Name: handler.Filename, ETag: info.ETag, Size: info.Size}); err != nil {
+				util.PrintErr(err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			// Polled storage deployments send no notification, and polling would find
+			// the object already tracked.
+			if err = mutations.EnqueueBucketReplicationJobs(conn, bucket.Name, handler.Filename); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
@@ -188,25 +196,24 @@ func Object(w http.ResponseWriter, r *http.Request) {
 }
 
 func ServeObject(w http.ResponseWriter, r *http.Request, conn database.DBConn, bucket database.BucketRecord, object database.ObjectRecord) {
-	var client *minio.Client
-	if c, err := mutations.CreateMinioClient(conn, bucket.StorageID); err != nil {
+	var backend storage.Backend
+	if b, err := mutations.CreateStorageBackend(conn, bucket.StorageID); err != nil {
 		util.PrintErr(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	} else {
-		client = c
+		backend = b
 	}
 
-	if minioObj, err := client.GetObject(ctx, bucket.Name, object.Name, minio.GetObjectOptions{}); err != nil {
+	if storedObj, err := backend.GetObject(bucket.Name, object.Name); err != nil {
 		util.PrintErr(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	} else {
-		defer minioObj.Close()
-		log.Printf("%v", minioObj)
+		defer storedObj.Close()
 		w.Header().Set("Content-Disposition", "attachment; filename=" + strconv.Quote(object.Name))
 		w.Header().Set("Content-Type", "application/octet-stream")
-		http.ServeContent(w, r, object.Name, time.UnixMicro(0), minioObj)
+		http.ServeContent(w, r, object.Name, time.UnixMicro(0), storedObj)
 		return
 	}
 }
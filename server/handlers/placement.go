@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type PlacementOutput struct {
+	BucketID int64 `json:"bucket_id"`
+	BucketName string `json:"bucket_name"`
+	Rules []mutations.RulePlacement `json:"rules"`
+}
+
+// Shows how the replicas of the bucket given by bucket_id would be placed if
+// it were resolved now, with the score of every candidate. Nothing is changed.
+func Placement(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/placement", "GET", nil) { return }
+
+	bucketID, err := strconv.Atoi(r.URL.Query().Get("bucket_id"))
+	if err != nil {
+		util.PrintErr(fmt.Errorf("Expected an integer for bucket_id, got %v.", r.URL.Query().Get("bucket_id")))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bucketID)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if len(buckets) != 1 {
+		util.PrintErr(fmt.Errorf("Bucket %v not found.", bucketID))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	placements, err := mutations.ResolveBucketPlacement(conn, buckets[0])
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	outputJSON, err := json.Marshal(PlacementOutput{BucketID: buckets[0].BucketID, BucketName: buckets[0].Name, Rules: placements})
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(outputJSON)
+}
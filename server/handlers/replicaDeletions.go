@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Lists removed replicas whose data is still kept, soonest deleted first.
+func ReplicaDeletions(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/replica-deletions", "GET", nil) { return }
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	pendingDeletions, err := database.QueryPendingReplicaDeletions(conn, "SELECT * FROM pending_replica_deletions ORDER BY delete_after, deletion_id")
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if pendingDeletions == nil { pendingDeletions = []database.PendingReplicaDeletionRecord{} }
+
+	pendingDeletionsJSON, err := json.Marshal(pendingDeletions)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(pendingDeletionsJSON)
+}
+
+// Cancels a pending deletion and restores the replica.
+func ReplicaDeletion(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "DELETE" {
+		deletion_id, err := strconv.Atoi(mux.Vars(r)["deletion_id"])
+		if err != nil {
+			util.PrintErr(fmt.Errorf("Path not found. Expected %v, got %v.", "/api/replica-deletions/<int>", r.URL.RequestURI()))
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if tx, err := database.Begin(); err != nil {
+			util.PrintErr(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		} else {
+			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
+
+			if err = mutations.RestoreReplica(conn, int64(deletion_id)); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
+				return
+			} else {
+				tx.Commit(ctx)
+			}
+		}
+
+		SendResources(w)
+		return
+	} else {
+		util.PrintErr(fmt.Errorf("Method not supported. Got %v.", r.Method))
+		http.Error(w, "Method Not Supported", http.StatusNotFound)
+		return
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Lists the sync state of replicas, optionally filtered by bucket_id,
+// storage_id, status and min_lag (in seconds) to find drifting replicas.
+func ReplicaStates(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/replica-states", "GET", nil) { return }
+
+	query := r.URL.Query()
+	var conditions []string
+	var args []interface{}
+	for _, column := range []string{"bucket_id", "storage_id"} {
+		if value := query.Get(column); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				util.PrintErr(fmt.Errorf("Expected an integer for %v, got %v.", column, value))
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			args = append(args, id)
+			conditions = append(conditions, fmt.Sprintf("%v = $%v", column, len(args)))
+		}
+	}
+	if status := query.Get("status"); status != "" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%v", len(args)))
+	}
+	if value := query.Get("min_lag"); value != "" {
+		minLag, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			util.PrintErr(fmt.Errorf("Expected a number for min_lag, got %v.", value))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		args = append(args, minLag)
+		conditions = append(conditions, fmt.Sprintf("out_of_sync_since <= now() - make_interval(secs => $%v)", len(args)))
+	}
+
+	sql := "SELECT * FROM replica_sync_states"
+	if len(conditions) > 0 { sql += " WHERE " + strings.Join(conditions, " AND ") }
+	sql += " ORDER BY bucket_id, storage_id"
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	states, err := database.QueryReplicaSyncStates(conn, sql, args...)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if states == nil { states = []database.ReplicaSyncStateRecord{} }
+
+	statesJSON, err := json.Marshal(states)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statesJSON)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type ReplicationJobsOutput struct {
+	Jobs []database.ReplicationJobRecord `json:"jobs"`
+	Summaries []database.ReplicationJobSummaryRecord `json:"summaries"`
+}
+
+// Lists replication jobs, optionally filtered by bucket_id, storage_id
+// (destination) and status, along with per bucket and destination summaries.
+func ReplicationJobs(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/replication-jobs", "GET", nil) { return }
+
+	query := r.URL.Query()
+	var conditions []string
+	var args []interface{}
+	for _, filter := range []struct{ param, column string }{{"bucket_id", "bucket_id"}, {"storage_id", "dst_storage_id"}} {
+		if value := query.Get(filter.param); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				util.PrintErr(fmt.Errorf("Expected an integer for %v, got %v.", filter.param, value))
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			args = append(args, id)
+			conditions = append(conditions, fmt.Sprintf("%v = $%v", filter.column, len(args)))
+		}
+	}
+	summaryConditions := append([]string{}, conditions...)
+	summaryArgs := append([]interface{}{}, args...)
+	if status := query.Get("status"); status != "" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%v", len(args)))
+	}
+
+	limit := 500
+	if value := query.Get("limit"); value != "" {
+		if l, err := strconv.Atoi(value); err != nil || l < 1 {
+			util.PrintErr(fmt.Errorf("Expected a positive integer for limit, got %v.", value))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		} else {
+			limit = l
+		}
+	}
+
+	where := func(c []string) string {
+		if len(c) == 0 { return "" }
+		return " WHERE " + strings.Join(c, " AND ")
+	}
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	output := ReplicationJobsOutput{Jobs: []database.ReplicationJobRecord{}, Summaries: []database.ReplicationJobSummaryRecord{}}
+	args = append(args, limit)
+	if jobs, err := database.QueryReplicationJobs(conn, fmt.Sprintf("SELECT * FROM replication_jobs%v ORDER BY job_id DESC LIMIT $%v", where(conditions), len(args)), args...); err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if jobs != nil {
+		output.Jobs = jobs
+	}
+	if summaries, err := database.QueryReplicationJobSummaries(conn, "SELECT * FROM replication_job_summaries" + where(summaryConditions) + " ORDER BY bucket_id, dst_storage_id", summaryArgs...); err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if summaries != nil {
+		output.Summaries = summaries
+	}
+
+	outputJSON, err := json.Marshal(output)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(outputJSON)
+}
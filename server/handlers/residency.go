@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type ResidencyInput struct {
+	ReplicationDeniedClusters []string `json:"replication_denied_clusters"`
+}
+
+func (i *ResidencyInput) IsValid() bool {
+	if i.ReplicationDeniedClusters == nil { i.ReplicationDeniedClusters = make([]string, 0) }
+	return true
+}
+
+// Sets the clusters no bucket may be replicated into. Rejected if a bucket's
+// replica_locations pin replicas in one of them.
+func Residency(w http.ResponseWriter, r *http.Request) {
+    if r.Method == "GET" {
+        SendResources(w)
+		return
+    } else if r.Method == "PUT" {
+		var input ResidencyInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			util.PrintErr(err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		} else if !input.IsValid() {
+			util.PrintErr(fmt.Errorf("Invalid input. Got %+v of type %v.", input, reflect.TypeOf(input)))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if tx, err := database.Begin(); err != nil {
+			util.PrintErr(err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		} else {
+			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
+
+			if err = mutations.SetReplicationDeniedClusters(conn, input.ReplicationDeniedClusters); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
+				return
+			} else {
+				tx.Commit(ctx)
+			}
+		}
+
+		SendResources(w)
+		return
+	} else {
+		util.PrintErr(fmt.Errorf("Method not supported. Got %v.", r.Method))
+		http.Error(w, "Method Not Supported", http.StatusNotFound)
+		return
+	}
+}
@@ -10,15 +10,29 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/smithyworks/FaDO/database"
 	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/storage"
 	"github.com/smithyworks/FaDO/util"
 )
 
 type StorageInput struct {
 	StorageDeployment database.StorageDeploymentRecord `json:"storage_deployment"`
+	// Left unchanged when omitted.
+	FailureDomains map[string]string `json:"failure_domains"`
 }
 
 func (si *StorageInput) IsValid() bool {
-	return si.StorageDeployment.ClusterID != 0 && si.StorageDeployment.Alias != "" && si.StorageDeployment.Endpoint != "" && si.StorageDeployment.AccessKey != "" && si.StorageDeployment.SecretKey != ""
+	sd := si.StorageDeployment
+	if sd.Kind == storage.KindFilesystem { return sd.ClusterID != 0 && sd.Alias != "" && sd.Endpoint != "" }
+	return sd.ClusterID != 0 && sd.Alias != "" && sd.Endpoint != "" && sd.AccessKey != "" && sd.SecretKey != ""
+}
+
+func setStorageDeploymentFailureDomains(conn database.DBConn, input StorageInput) (err error) {
+	if input.FailureDomains == nil { return }
+
+	sd, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE endpoint = $1", input.StorageDeployment.Endpoint)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(mutations.SetStorageDeploymentFailureDomains(conn, sd, input.FailureDomains))
 }
 
 func StorageDeployments(w http.ResponseWriter, r *http.Request) {
@@ -43,10 +57,16 @@ func StorageDeployments(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if err = mutations.AddStorageDeployment(tx, input.StorageDeployment); err != nil {
-				util.PrintErr(err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if err = mutations.AddStorageDeployment(conn, input.StorageDeployment); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if err = setStorageDeploymentFailureDomains(conn, input); err != nil {
+				sendMutationError(w, err)
+				return
+			} else if plan != nil {
+				sendPlan(w, conn, plan)
 				return
 			} else {
 				tx.Commit(ctx)
@@ -79,16 +99,20 @@ func StorageDeployment(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			defer tx.Rollback(ctx)
+			conn, plan := planConn(r, tx)
 
-			if storage, err := database.QueryStorageDeploymentRow(tx, "SELECT * FROM storage_deployments WHERE storage_id = $1", storage_id); err != nil {
+			if storage, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", storage_id); err != nil {
 				util.PrintErr(err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			} else {
-				if err = mutations.DeleteStorageDeployment(tx, storage, permanent); err != nil {
+				if err = mutations.DeleteStorageDeployment(conn, storage, permanent); err != nil {
 					util.PrintErr(err)
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
+				} else if plan != nil {
+					sendPlan(w, conn, plan)
+					return
 				} else {
 					tx.Commit(ctx)
 				}
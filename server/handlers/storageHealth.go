@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Lists the health of the storage deployments probed so far, optionally
+// filtered by status.
+func StorageHealth(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/storage-health", "GET", nil) { return }
+
+	sql := "SELECT * FROM storage_health_states"
+	var args []interface{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		args = append(args, status)
+		sql += " WHERE status = $1"
+	}
+	sql += " ORDER BY storage_id"
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	states, err := database.QueryStorageHealthStates(conn, sql, args...)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if states == nil { states = []database.StorageHealthStateRecord{} }
+
+	statesJSON, err := json.Marshal(states)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(statesJSON)
+}
+
+// Lists the buckets whose master was failed over to a replica.
+func Failovers(w http.ResponseWriter, r *http.Request) {
+	if !ValidateRequest(w, r, "/api/failovers", "GET", nil) { return }
+
+	conn, err := database.Acquire()
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Release()
+
+	failovers, err := database.QueryBucketFailovers(conn, "SELECT * FROM bucket_failovers ORDER BY bucket_id")
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if failovers == nil { failovers = []database.BucketFailoverRecord{} }
+
+	failoversJSON, err := json.Marshal(failovers)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(failoversJSON)
+}
@@ -3,10 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
 
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
 	"github.com/smithyworks/FaDO/util"
 )
 
@@ -54,4 +57,57 @@ func ValidateRequest(w http.ResponseWriter, r *http.Request, path, method string
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+// Residency violations are the client's to fix, so they are reported back as
+// such. Other mutation errors are not.
+func sendMutationError(w http.ResponseWriter, err error) {
+	util.PrintErr(err)
+
+	var violation *mutations.ResidencyViolationError
+	if errors.As(err, &violation) {
+		http.Error(w, violation.Error(), http.StatusUnprocessableEntity)
+	} else {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// Invalid input is the client's to fix, so the reason is sent back.
+func sendValidationError(w http.ResponseWriter, err error) {
+	util.PrintErr(err)
+	http.Error(w, validationReason(err).Error(), http.StatusBadRequest)
+}
+
+// The error a validator returned, without the locations ProcessErr added.
+func validationReason(err error) error {
+	var se *util.ServerError
+	if errors.As(err, &se) && se.Cause != nil { return se.Cause }
+	return err
+}
+
+// Mutations run through the returned connection only plan their changes if the
+// request asks for a dry run, in which case the plan is returned as well.
+func planConn(r *http.Request, tx database.DBConn) (database.DBConn, *mutations.Plan) {
+	if r.URL.Query().Get("dry_run") != "true" { return tx, nil }
+	return mutations.PlanChanges(tx)
+}
+
+// Sends the plan back instead of the resources. The caller must roll back the
+// transaction.
+func sendPlan(w http.ResponseWriter, conn database.DBConn, plan *mutations.Plan) {
+	if err := plan.Finish(conn); err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		util.PrintErr(err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(planJSON)
+}
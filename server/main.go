@@ -17,9 +17,10 @@ import (
 	"github.com/smithyworks/FaDO/handlers"
 	"github.com/smithyworks/FaDO/mutations"
 	"github.com/smithyworks/FaDO/util"
+	"github.com/smithyworks/FaDO/workers"
 )
 
-func initAfterReady(configFilePath, databaseConnectionString, serverURL, caddyAdminURL string) {
+func initAfterReady(configFilePath, databaseConnectionString, serverURL, caddyAdminURL string, prune bool) {
 	time.Sleep(5 * time.Second)
 	handlers.SetReady(true)
 
@@ -36,7 +37,6 @@ func initAfterReady(configFilePath, databaseConnectionString, serverURL, caddyAd
 	if err != nil { util.PrintErr(err); return }
 
 	if clusterCount > 0 {
-		log.Printf("INFO: Found database populated, skipping configuration from file.")
 		log.Printf("INFO: Syncing database state with MinIO deployments.")
 		if storageDeployments, err := database.QueryStorageDeployments(tx, "SELECT * FROM storage_deployments"); err != nil {
 			util.PrintErr(err)
@@ -65,17 +65,43 @@ func initAfterReady(configFilePath, databaseConnectionString, serverURL, caddyAd
 			}
 		}
 		mutations.ConfigureLoadBalancer(tx)
-		tx.Commit(context.Background())
+	}
+	tx.Commit(context.Background())
+
+	if _, err = os.Stat(configFilePath); os.IsNotExist(err) && clusterCount > 0 {
+		log.Printf("INFO: No configuration file at '%v', keeping the database as is.", configFilePath)
 	} else {
-		log.Printf("INFO: Loading initial configuration file at '%v'.", configFilePath)
-		if err = config.LoadConfigFromFile(configFilePath); err != nil {
+		log.Printf("INFO: Applying configuration file at '%v'.", configFilePath)
+		if summary, err := config.ReconcileConfigFile(configFilePath, prune); err != nil {
 			util.PrintErr(err)
-			return
+		} else {
+			summary.Log()
 		}
 	}
+	workers.StartConfigWatcher(configFilePath, prune)
+
 	log.Printf("INFO: Finished loading.")
 }
 
+func exportConfig(format, outputPath string) (err error) {
+	conn, err := database.Acquire()
+	if err != nil { return util.ProcessErr(err) }
+	defer conn.Release()
+
+	pc, err := config.Export(conn)
+	if err != nil { return util.ProcessErr(err) }
+	data, err := config.Marshal(pc, format)
+	if err != nil { return util.ProcessErr(err) }
+
+	if outputPath == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(outputPath, data, 0600)
+	}
+
+	return util.ProcessErr(err)
+}
+
 //go:embed build/*
 var staticFiles embed.FS
 
@@ -116,7 +142,25 @@ func main() {
 	}
 	defer database.Close()
 
-	go initAfterReady(input.ConfigFilePath, input.DatabaseConnectionString, input.ServerURL, input.CaddyAdminURL)
+	if input.Command == "export" {
+		if err := exportConfig(input.ExportFormat, input.ExportOutput); err != nil {
+			util.PrintErr(err)
+			database.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	workers.StartReplicationWorkers(input.ReplicationWorkers)
+	workers.StartReplicaVerifier()
+	workers.StartRouteReconciler()
+	workers.StartStoragePoller()
+	workers.StartReplicaReaper()
+	workers.StartFaaSHealthMonitor()
+	workers.StartStorageHealthMonitor()
+	workers.StartLatencyWeightRefresher()
+
+	go initAfterReady(input.ConfigFilePath, input.DatabaseConnectionString, input.ServerURL, input.CaddyAdminURL, input.Prune)
 	
 	// HTTP Server
 
@@ -137,9 +181,27 @@ func main() {
 	r.HandleFunc("/api/load-balancer", handlers.LoadBalancer)
 	r.HandleFunc("/api/load-balancer/settings", handlers.LoadBalancer)
 	r.HandleFunc("/api/load-balancer/route-overrides", handlers.LoadBalancer)
+	r.HandleFunc("/api/load-balancer/policies", handlers.LoadBalancerPolicies)
+	r.HandleFunc("/api/replication-jobs", handlers.ReplicationJobs)
+	r.HandleFunc("/api/replica-states", handlers.ReplicaStates)
+	r.HandleFunc("/api/placement", handlers.Placement)
+	r.HandleFunc("/api/residency", handlers.Residency)
+	r.HandleFunc("/api/replica-deletions", handlers.ReplicaDeletions)
+	r.HandleFunc("/api/replica-deletions/{deletion_id:[0-9]+}", handlers.ReplicaDeletion)
+	r.HandleFunc("/api/config/export", handlers.ConfigExport)
+	r.HandleFunc("/api/faas-health", handlers.FaaSHealth)
+	r.HandleFunc("/api/faas-health/{faas_id:[0-9]+}", handlers.FaaSHealthHistory)
+	r.HandleFunc("/api/storage-health", handlers.StorageHealth)
+	r.HandleFunc("/api/failovers", handlers.Failovers)
 
 	r.HandleFunc("/healthz", handlers.Health)
 
+	if input.Gateway {
+		log.Printf("INFO: Serving function invocations at /invoke.")
+		r.HandleFunc("/invoke/{bucket}", handlers.Invoke)
+		r.HandleFunc("/invoke/{bucket}/{path:.*}", handlers.Invoke)
+	}
+
 	spaHandler := SpaHandler()
 	r.PathPrefix("/").Handler(spaHandler)
 
@@ -1,12 +1,11 @@
 package mutations
 
 import (
-	"strings"
+	"log"
+	"time"
 
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/notification"
 	"github.com/smithyworks/FaDO/database"
-	"github.com/smithyworks/FaDO/mc"
+	"github.com/smithyworks/FaDO/storage"
 	"github.com/smithyworks/FaDO/util"
 )
 
@@ -93,60 +92,73 @@ func SetBucketReplicas(conn database.DBConn, bucket database.BucketRecord, repli
 	return
 }
 
+// Works out where the bucket should be replicated: the bucket-wide policies
+// decide for objects matching no replication rule, and each rule decides for
+// the objects it matches. The bucket's replicas are the union of all those
+// locations. Replicas whose share of the bucket changed are mirrored again.
 func ResolveBucketReplicas(conn database.DBConn, bucket database.BucketRecord) (err error) {
-	var locations []int64
-	if ok, err := database.GetBucketPolicy(conn, bucket, "replica_locations", &locations); ok && err == nil {
-		err = SetBucketReplicas(conn, bucket, locations)
-		if err != nil { return util.ProcessErr(err) } else { return nil }
-	} // nothing to do
-
-	var bucketZones []string
-	_, err = database.GetBucketPolicy(conn, bucket, "zones", &bucketZones)
+	placements, err := ResolveBucketPlacement(conn, bucket)
 	if err != nil { return util.ProcessErr(err) }
 
-	// get bucket's home cluster for exclusion
+	if err = setBucketPlacementStatuses(conn, bucket, placements); err != nil {
+		return util.ProcessErr(err)
+	}
 
-	homeStorageDeployment, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", bucket.StorageID)
+	// A failed over bucket's master is one of the locations placed, and its
+	// original master stays a replica to fail back to.
+	ruleLocations := make(map[string][]int64)
+	var storageIDs []int64
+	for _, rp := range placements {
+		ruleLocations[rp.RuleKey] = util.DeleteInt(rp.StorageIDs, bucket.StorageID)
+		for _, id := range ruleLocations[rp.RuleKey] { storageIDs = util.AddInt(storageIDs, id) }
+	}
+	originalID, err := failoverOriginal(conn, bucket)
 	if err != nil { return util.ProcessErr(err) }
-	homeCluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE cluster_id = $1", homeStorageDeployment.ClusterID)
+	if originalID != 0 { storageIDs = util.AddInt(storageIDs, originalID) }
+
+	changedStorageIDs, err := setReplicaRuleLocations(conn, bucket, ruleLocations)
 	if err != nil { return util.ProcessErr(err) }
 
-	clusters, err := database.QueryClusters(conn, "SELECT * FROM clusters")
+	existingStorageIDs, err := replicaStorageIDs(conn, bucket)
 	if err != nil { return util.ProcessErr(err) }
 
-	var possibleCluster []int64
-	for _, c := range clusters {
-		var clusterZones []string
-		_, err = database.GetClusterPolicy(conn, c, "zones", &clusterZones)
-		if err != nil { return util.ProcessErr(err) }
+	err = SetBucketReplicas(conn, bucket, storageIDs)
+	if err != nil { return util.ProcessErr(err) }
 
-		overlap := false
-		if homeCluster.ClusterID != c.ClusterID {
-			if len(bucketZones) == 0 { overlap = true } else {
-				for _, z := range clusterZones { if util.HasString(bucketZones, z) { overlap = true; break } }
+	// New replicas are mirrored when added.
+	for _, id := range changedStorageIDs {
+		if util.HasInt(existingStorageIDs, id) && util.HasInt(storageIDs, id) {
+			if err = EnqueueReplicationJob(conn, bucket.BucketID, id, ""); err != nil {
+				return util.ProcessErr(err)
+			}
+			if plan := planOf(conn); plan != nil {
+				if err = plan.resyncReplica(conn, bucket.BucketID, id); err != nil {
+					return util.ProcessErr(err)
+				}
 			}
 		}
-
-		if overlap { possibleCluster = append(possibleCluster, c.ClusterID) }
 	}
+	
+	return
+}
 
-	var targetReplicaCount int
-	_, err = database.GetBucketPolicy(conn, bucket, "target_replica_count", &targetReplicaCount)
-	if err != nil { return util.ProcessErr(err) }
-
-	storageDeployments, err := database.QueryStorageDeployments(conn, "SELECT * FROM storage_deployments WHERE cluster_id = ANY($1) LIMIT $2", possibleCluster, targetReplicaCount)
-	if err != nil { return util.ProcessErr(err) }
+func replicaStorageIDs(conn database.DBConn, bucket database.BucketRecord) (storageIDs []int64, err error) {
+	replicaLocations, err := database.QueryReplicaBucketLocations(conn, "SELECT * FROM replica_bucket_locations WHERE bucket_id = $1", bucket.BucketID)
+	if err != nil { return storageIDs, util.ProcessErr(err) }
 
-	var storageIDs []int64
-	for _, sd := range storageDeployments { storageIDs = append(storageIDs, sd.StorageID) }
+	for _, rl := range replicaLocations { storageIDs = append(storageIDs, rl.StorageID) }
 
-	err = SetBucketReplicas(conn, bucket, storageIDs)
-	if err != nil { return util.ProcessErr(err) }
-	
 	return
 }
 
 func AddReplicaBucket(conn database.DBConn, bucketStorage database.ReplicaBucketLocationRecord) (err error) {
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bucketStorage.BucketID)
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = CheckReplicaResidency(conn, bucket, bucketStorage.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
+
 	// check for existence, insert into database
 	if replicaBucketsStorageDeployments, err := database.QueryReplicaBucketLocations(conn, "SELECT * FROM replica_bucket_locations WHERE bucket_id = $1 AND storage_id = $2", bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
 		return util.ProcessErr(err)
@@ -154,33 +166,26 @@ func AddReplicaBucket(conn database.DBConn, bucketStorage database.ReplicaBucket
 		if _, err = database.Exec(conn, "INSERT INTO replica_bucket_locations (bucket_id, storage_id) VALUES ($1, $2)", bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
 			return util.ProcessErr(err)
 		}
+		if plan := planOf(conn); plan != nil {
+			if err = plan.addReplica(conn, bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
+				return util.ProcessErr(err)
+			}
+		}
 	}
 
-	var bucketName string
-	if rows, err := database.Query(conn, "SELECT name FROM buckets WHERE bucket_id = $1", bucketStorage.BucketID); err != nil {
+	// keep the data of a replica removed earlier
+	if err = cancelReplicaDeletion(conn, bucket.Name, bucketStorage.StorageID); err != nil {
 		return util.ProcessErr(err)
-	} else {
-		rows.Next(); err = rows.Scan(&bucketName); rows.Close()
-		if err != nil { return util.ProcessErr(err) }
 	}
 
 	// create bucket in minio
-	if err = EnsureBucketCreation(conn, bucketStorage.StorageID, bucketName); err != nil {
+	if err = EnsureBucketCreation(conn, bucketStorage.StorageID, bucket.Name); err != nil {
 		return util.ProcessErr(err)
 	}
 
 	// mirror from master
-	if rows, err := database.Query(conn, "SELECT * FROM bucket_replications WHERE bucket_id = $1 AND dst_storage_id = $2", bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
+	if err = EnqueueReplicationJob(conn, bucketStorage.BucketID, bucketStorage.StorageID, ""); err != nil {
 		return util.ProcessErr(err)
-	} else {
-		if bucketReplications, err := database.ScanBucketReplicationRows(rows); err != nil {
-			return util.ProcessErr(err)
-		} else if len(bucketReplications) == 1 {
-			br := bucketReplications[0]
-			if err = mc.Mirror(br.SrcStorageAlias, br.BucketName, br.DstStorageAlias, br.BucketName); err != nil {
-				return util.ProcessErr(err)
-			}
-		}
 	}
 
 	// update LB config
@@ -223,6 +228,12 @@ func DeleteMasterBucket(conn database.DBConn, bucket database.BucketRecord) (err
 	}
 
 
+	if plan := planOf(conn); plan != nil {
+		if err = plan.deleteMaster(conn, bucket); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
 	// for replicas
 	//   DeleteReplicaBucket
 	for _, bucketStorage := range bucketStorageRecords {
@@ -251,17 +262,42 @@ func DeleteMasterBucket(conn database.DBConn, bucket database.BucketRecord) (err
 }
 
 func DeleteReplicaBucket(conn database.DBConn, bucketStorage database.ReplicaBucketLocationRecord) (err error) {
+	gracePeriod, err := replicaDeletionGracePeriod(conn)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(deleteReplicaBucket(conn, bucketStorage, gracePeriod))
+}
+
+// Replicas deleted without a grace period lose their data straight away.
+func deleteReplicaBucket(conn database.DBConn, bucketStorage database.ReplicaBucketLocationRecord, gracePeriod time.Duration) (err error) {
 	// Fetch bucket for which we want to delete the replica
 	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bucketStorage.BucketID)
 	if err != nil { return util.ProcessErr(err) }
 
+	if plan := planOf(conn); plan != nil {
+		if err = plan.deleteReplica(conn, bucketStorage.BucketID, bucketStorage.StorageID, gracePeriod); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
 	// delete from database
 	if _, err := database.Exec(conn, "DELETE FROM replica_bucket_locations WHERE bucket_id = $1 AND storage_id = $2", bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
 		return util.ProcessErr(err)
 	}
+	if err = DeleteReplicaSyncState(conn, bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
+	if err = DeleteReplicaObjectLocations(conn, bucketStorage.BucketID, bucketStorage.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
 
-	// delete from MinIO
-	if err = EnsureBucketDeletion(conn, bucketStorage.StorageID, bucket.Name); err != nil {
+	// delete from MinIO, once routes to the replica are withdrawn and the
+	// grace period is over
+	if gracePeriod > 0 {
+		if err = scheduleReplicaDeletion(conn, bucket, bucketStorage.StorageID, gracePeriod); err != nil {
+			return util.ProcessErr(err)
+		}
+	} else if err = EnsureBucketDeletion(conn, bucketStorage.StorageID, bucket.Name); err != nil {
 		util.PrintWarning(err)
 		err = nil
 	}
@@ -275,14 +311,16 @@ func DeleteReplicaBucket(conn database.DBConn, bucketStorage database.ReplicaBuc
 }
 
 func EnsureBucketCreation(conn database.DBConn, storage_id int64, bucketName string) (err error) {
-	// Ensure bucket exists in minio
-	if client, err := CreateMinioClient(conn, storage_id); err != nil {
+	if planOf(conn) != nil { return }
+
+	// Ensure bucket exists in storage
+	if backend, err := CreateStorageBackend(conn, storage_id); err != nil {
 		return util.ProcessErr(err)
 	} else {
-		if exists, err := client.BucketExists(ctx, bucketName); err != nil {
+		if exists, err := backend.BucketExists(bucketName); err != nil {
 			return util.ProcessErr(err)
 		} else if !exists {
-			if err = client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{}); err != nil {
+			if err = backend.CreateBucket(bucketName); err != nil {
 				return util.ProcessErr(err)
 			}
 		}
@@ -292,14 +330,16 @@ func EnsureBucketCreation(conn database.DBConn, storage_id int64, bucketName str
 }
 
 func EnsureBucketDeletion(conn database.DBConn, storage_id int64, bucketName string) (err error) {
-		// Ensure bucket is deleted in minio
-		if client, err := CreateMinioClient(conn, storage_id); err != nil {
+		if planOf(conn) != nil { return }
+
+		// Ensure bucket is deleted in storage
+		if backend, err := CreateStorageBackend(conn, storage_id); err != nil {
 			return util.ProcessErr(err)
 		} else {
-			if exists, err := client.BucketExists(ctx, bucketName); err != nil {
+			if exists, err := backend.BucketExists(bucketName); err != nil {
 				return util.ProcessErr(err)
 			} else if exists {
-				if err = client.RemoveBucketWithOptions(ctx, bucketName, minio.BucketOptions{ForceDelete: true}); err != nil {
+				if err = backend.DeleteBucket(bucketName); err != nil {
 					return util.ProcessErr(err)
 				}
 			}
@@ -308,47 +348,26 @@ func EnsureBucketDeletion(conn database.DBConn, storage_id int64, bucketName str
 		return
 }
 
+// Backends that cannot push notifications are left without, their buckets are
+// polled for changes instead.
 func SetupBucketNotifications(conn database.DBConn, bucket database.BucketRecord) (err error) {
-	storageDeployment, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", bucket.StorageID)
+	if planOf(conn) != nil { return }
+
+	backend, err := CreateStorageBackend(conn, bucket.StorageID)
 	if err != nil { return util.ProcessErr(err) }
 
-	if client, err := CreateMinioClient(conn, storageDeployment); err != nil {
-		return util.ProcessErr(err)
-	} else {
-		arnTokens := strings.Split(storageDeployment.SqsArn, ":")
-		queueArn := notification.NewArn(arnTokens[1], arnTokens[2], arnTokens[3], arnTokens[4], arnTokens[5])
-		queueConfig := notification.NewConfig(queueArn)
-		queueConfig.AddEvents(notification.ObjectCreatedAll, notification.ObjectRemovedAll)
-	
-		config := notification.Configuration{}
-		config.AddQueue(queueConfig)
-	
-		if err = client.SetBucketNotification(ctx, bucket.Name, config); err != nil {
-			return util.ProcessErr(err)
-		}
+	if err = backend.Subscribe(bucket.Name); err == storage.ErrNotSupported {
+		log.Printf("INFO: Storage deployment %v does not support notifications for %v.", bucket.StorageID, bucket.Name)
+		return nil
 	}
 
 	return util.ProcessErr(err)
 }
 
 func ReplicateBucket(conn database.DBConn, bucketName string) (err error) {
-	var bucketReplications []database.BucketReplicationRecord
-	if rows, err := database.Query(conn, "SELECT * FROM bucket_replications WHERE bucket_name = $1", bucketName); err != nil {
+	if err = EnqueueBucketReplicationJobs(conn, bucketName, ""); err != nil {
 		return util.ProcessErr(err)
-	} else {
-		if bucketReplications, err = database.ScanBucketReplicationRows(rows); err != nil {
-			return util.ProcessErr(err)
-		}
-	}
-
-	if len(bucketReplications) < 1 { return }
-
-	for _, brr := range bucketReplications {
-		if err = mc.Mirror(brr.SrcStorageAlias, brr.BucketName, brr.DstStorageAlias, brr.BucketName); err != nil {
-			return util.ProcessErr(err)
-		}
 	}
 
 	return
 }
-
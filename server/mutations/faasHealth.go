@@ -0,0 +1,180 @@
+package mutations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// How FaDO probes a FaaS deployment. Deployments without a path are not
+// probed.
+type FaaSProbeSettings struct {
+	Path string
+	Interval time.Duration
+	Timeout time.Duration
+	FailureThreshold int
+	SuccessThreshold int
+}
+
+func ResolveFaaSProbeSettings(conn database.DBConn, fd database.FaaSDeploymentRecord) (settings FaaSProbeSettings, err error) {
+	var interval, timeout float64
+	if err = getFaaSDeploymentOrGlobalPolicy(conn, fd, "faas_health_path", &settings.Path); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	if err = getFaaSDeploymentOrGlobalPolicy(conn, fd, "faas_health_interval", &interval); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	if err = getFaaSDeploymentOrGlobalPolicy(conn, fd, "faas_health_timeout", &timeout); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	if err = getFaaSDeploymentOrGlobalPolicy(conn, fd, "faas_health_failure_threshold", &settings.FailureThreshold); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	if err = getFaaSDeploymentOrGlobalPolicy(conn, fd, "faas_health_success_threshold", &settings.SuccessThreshold); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	settings.Interval = time.Duration(interval * float64(time.Second))
+	settings.Timeout = time.Duration(timeout * float64(time.Second))
+
+	return
+}
+
+type FaaSProbeResult struct {
+	Healthy bool
+	StatusCode int
+	Latency time.Duration
+	Err error
+}
+
+// FaaS deployment URLs are the addresses Caddy dials, so they usually come
+// without a scheme. Any answer below 500 means the deployment is up.
+func ProbeFaaSDeployment(fd database.FaaSDeploymentRecord, settings FaaSProbeSettings) (result FaaSProbeResult) {
+	url := fd.URL
+	if !strings.Contains(url, "://") { url = "http://" + url }
+	url = strings.TrimRight(url, "/") + settings.Path
+
+	ctx, cancel := context.WithTimeout(context.Background(), settings.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil { result.Err = err; return }
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil { result.Err = err; return }
+	resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 500 {
+		result.Err = fmt.Errorf("Health check of %v answered %v.", url, resp.Status)
+	} else {
+		result.Healthy = true
+	}
+
+	return
+}
+
+// Records the probe and moves the deployment between statuses: it is withdrawn
+// from the routes after FailureThreshold consecutive failures, and restored
+// after SuccessThreshold consecutive successes. Returns whether it was
+// withdrawn or restored.
+func RecordFaaSHealthCheck(conn database.DBConn, fd database.FaaSDeploymentRecord, settings FaaSProbeSettings, result FaaSProbeResult) (changed bool, err error) {
+	errMsg := ""
+	if result.Err != nil { errMsg = result.Err.Error() }
+	latencyMs := float64(result.Latency) / float64(time.Millisecond)
+
+	_, err = database.Exec(conn, "INSERT INTO faas_health_checks (faas_id, healthy, status_code, latency_ms, error) VALUES ($1, $2, $3, $4, $5)",
+		fd.FaaSID, result.Healthy, result.StatusCode, latencyMs, errMsg)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	_, err = database.Exec(conn, "INSERT INTO faas_health_states (faas_id) VALUES ($1) ON CONFLICT (faas_id) DO NOTHING", fd.FaaSID)
+	if err != nil { return changed, util.ProcessErr(err) }
+	state, err := database.QueryFaaSHealthStateRow(conn, "SELECT * FROM faas_health_states WHERE faas_id = $1 FOR UPDATE", fd.FaaSID)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	status := nextHealthStatus(state.Status, result.Healthy, &state.ConsecutiveSuccesses, &state.ConsecutiveFailures, settings.SuccessThreshold, settings.FailureThreshold)
+	if status == database.HealthHealthy && state.Status == database.HealthUnhealthy {
+		log.Printf("INFO: FaaS deployment %v is healthy again after %v successful health checks, restoring it to the routes.", fd.URL, state.ConsecutiveSuccesses)
+	} else if status == database.HealthUnhealthy && state.Status != database.HealthUnhealthy {
+		log.Printf("INFO: FaaS deployment %v failed %v health checks in a row, withdrawing it from the routes: %v", fd.URL, state.ConsecutiveFailures, errMsg)
+	}
+	changed = (status == database.HealthUnhealthy) != (state.Status == database.HealthUnhealthy)
+
+	_, err = database.Exec(conn, `UPDATE faas_health_states SET
+			status = $2,
+			consecutive_successes = $3,
+			consecutive_failures = $4,
+			last_checked_at = now(),
+			last_latency_ms = $5,
+			last_error = $6,
+			updated_at = now()
+		WHERE faas_id = $1`,
+		fd.FaaSID, status, state.ConsecutiveSuccesses, state.ConsecutiveFailures, latencyMs, errMsg)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	return
+}
+
+// Counts the check towards the consecutive successes or failures. Deployments
+// become unhealthy after failureThreshold failures in a row, and healthy again
+// after successThreshold successes. Unknown ones are healthy from the first
+// success.
+func nextHealthStatus(status string, healthy bool, successes, failures *int, successThreshold, failureThreshold int) string {
+	if healthy {
+		*successes++
+		*failures = 0
+	} else {
+		*failures++
+		*successes = 0
+	}
+
+	if status == database.HealthUnhealthy && *successes >= successThreshold {
+		return database.HealthHealthy
+	} else if status != database.HealthUnhealthy && *failures >= failureThreshold {
+		return database.HealthUnhealthy
+	} else if status == database.HealthUnknown && healthy {
+		return database.HealthHealthy
+	}
+
+	return status
+}
+
+// Forgets the health of a deployment no longer probed, so it is not kept out of
+// the routes. Returns whether it was withdrawn.
+func ClearFaaSHealth(conn database.DBConn, fd database.FaaSDeploymentRecord) (changed bool, err error) {
+	states, err := database.QueryFaaSHealthStates(conn, "DELETE FROM faas_health_states WHERE faas_id = $1 RETURNING *", fd.FaaSID)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	return len(states) == 1 && states[0].Status == database.HealthUnhealthy, nil
+}
+
+// Deletes the health checks older than the faas_health_history_retention
+// global policy (in seconds).
+func PruneFaaSHealthChecks(conn database.DBConn) (err error) {
+	var seconds float64
+	if err = database.GetGlobalPolicy(conn, "faas_health_history_retention", &seconds); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	_, err = database.Exec(conn, "DELETE FROM faas_health_checks WHERE checked_at < now() - make_interval(secs => $1)", seconds)
+	return util.ProcessErr(err)
+}
+
+// URLs of the FaaS deployments withdrawn from the routes.
+func unhealthyFaaSURLs(conn database.DBConn) (urls map[string]bool, err error) {
+	faasDeployments, err := database.QueryFaaSDeployments(conn, `SELECT fd.* FROM faas_deployments fd
+		INNER JOIN faas_health_states fhs ON fhs.faas_id = fd.faas_id
+		WHERE fhs.status = $1`, database.HealthUnhealthy)
+	if err != nil { return urls, util.ProcessErr(err) }
+
+	urls = make(map[string]bool)
+	for _, fd := range faasDeployments { urls[fd.URL] = true }
+
+	return
+}
@@ -0,0 +1,38 @@
+package mutations
+
+import (
+	"testing"
+
+	"github.com/smithyworks/FaDO/database"
+)
+
+func TestNextHealthStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		status string
+		healthy bool
+		successes, failures int
+		want string
+		wantSuccesses, wantFailures int
+	}{
+		{"unknown healthy from the first success", database.HealthUnknown, true, 0, 0, database.HealthHealthy, 1, 0},
+		{"unknown stays unknown below the failure threshold", database.HealthUnknown, false, 0, 1, database.HealthUnknown, 0, 2},
+		{"unknown unhealthy at the failure threshold", database.HealthUnknown, false, 0, 2, database.HealthUnhealthy, 0, 3},
+		{"healthy stays healthy below the failure threshold", database.HealthHealthy, false, 5, 0, database.HealthHealthy, 0, 1},
+		{"healthy unhealthy at the failure threshold", database.HealthHealthy, false, 0, 2, database.HealthUnhealthy, 0, 3},
+		{"success resets the failures", database.HealthHealthy, true, 0, 2, database.HealthHealthy, 1, 0},
+		{"unhealthy stays unhealthy below the success threshold", database.HealthUnhealthy, true, 0, 3, database.HealthUnhealthy, 1, 0},
+		{"unhealthy healthy at the success threshold", database.HealthUnhealthy, true, 1, 0, database.HealthHealthy, 2, 0},
+		{"failure resets the successes", database.HealthUnhealthy, false, 1, 0, database.HealthUnhealthy, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			successes, failures := tt.successes, tt.failures
+			got := nextHealthStatus(tt.status, tt.healthy, &successes, &failures, 2, 3)
+			if got != tt.want { t.Errorf("nextHealthStatus = %v, want %v", got, tt.want) }
+			if successes != tt.wantSuccesses || failures != tt.wantFailures {
+				t.Errorf("successes, failures = %v, %v, want %v, %v", successes, failures, tt.wantSuccesses, tt.wantFailures)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package mutations
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Replicas a bucket can fail over to: those holding the whole bucket, in sync
+// and on a storage deployment not known to be unhealthy, most recently synced
+// first. Expects the bucket ID as $1.
+const failoverCandidatesQuery = `SELECT rss.* FROM replica_sync_states rss
+	INNER JOIN replica_bucket_locations rbl ON rbl.bucket_id = rss.bucket_id AND rbl.storage_id = rss.storage_id
+	INNER JOIN replica_rule_locations rrl ON rrl.bucket_id = rss.bucket_id AND rrl.storage_id = rss.storage_id AND rrl.rule_key = ''
+	LEFT JOIN storage_health_states shs ON shs.storage_id = rss.storage_id
+	WHERE rss.bucket_id = $1 AND rss.status = $2 AND COALESCE(shs.status, '') <> $3
+	ORDER BY rss.last_sync_at DESC NULLS LAST, rss.storage_id`
+
+// Moves the master of the buckets held by the unhealthy storage deployment to
+// one of their replicas, for the buckets whose master_failover policy allows
+// it. Buckets without an up-to-date replica stay where they are.
+func FailOverStorageDeployment(conn database.DBConn, sd database.StorageDeploymentRecord) (err error) {
+	buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets WHERE storage_id = $1 ORDER BY name", sd.StorageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	failedOver := false
+	for _, b := range buckets {
+		var enabled bool
+		if _, err = database.GetBucketPolicy(conn, b, "master_failover", &enabled); err != nil {
+			return util.ProcessErr(err)
+		} else if !enabled { continue }
+
+		candidates, err := database.QueryReplicaSyncStates(conn, failoverCandidatesQuery, b.BucketID, database.ReplicaInSync, database.HealthUnhealthy)
+		if err != nil { return util.ProcessErr(err) }
+		if len(candidates) == 0 {
+			util.PrintWarning(fmt.Errorf("No up-to-date replica of bucket %v to fail over to, its master stays on storage deployment %v.", b.Name, sd.Alias))
+			continue
+		}
+
+		promotedID := candidates[0].StorageID
+		if err = promoteReplica(conn, b, promotedID); err != nil { return util.ProcessErr(err) }
+
+		// Failing over again keeps the original master, unless the bucket
+		// went back to it.
+		failovers, err := database.QueryBucketFailovers(conn, "SELECT * FROM bucket_failovers WHERE bucket_id = $1", b.BucketID)
+		if err != nil { return util.ProcessErr(err) }
+		if len(failovers) == 1 && failovers[0].OriginalStorageID == promotedID {
+			_, err = database.Exec(conn, "DELETE FROM bucket_failovers WHERE bucket_id = $1", b.BucketID)
+		} else {
+			_, err = database.Exec(conn, `INSERT INTO bucket_failovers (bucket_id, original_storage_id, promoted_storage_id) VALUES ($1, $2, $3)
+				ON CONFLICT (bucket_id) DO UPDATE SET promoted_storage_id = $3, status = $4, updated_at = now()`,
+				b.BucketID, sd.StorageID, promotedID, database.FailoverActive)
+		}
+		if err != nil { return util.ProcessErr(err) }
+
+		log.Printf("INFO: Failed bucket %v over from storage deployment %v to %v.", b.Name, sd.Alias, promotedID)
+		failedOver = true
+	}
+
+	if failedOver {
+		if err := ConfigureLoadBalancer(conn); err != nil { util.PrintWarning(err) }
+	}
+
+	return
+}
+
+// Makes the replica on the given storage deployment the bucket's master, and
+// the current master one of its replicas, standing in for the promoted one in
+// the bucket's placement. The former master is left stale, it is brought in
+// sync by whoever knows it is reachable.
+func promoteReplica(conn database.DBConn, bucket database.BucketRecord, storageID int64) (err error) {
+	formerID := bucket.StorageID
+
+	if _, err = database.Exec(conn, "UPDATE buckets SET storage_id = $2 WHERE bucket_id = $1", bucket.BucketID, storageID); err != nil {
+		return util.ProcessErr(err)
+	}
+	if _, err = database.Exec(conn, "DELETE FROM replica_bucket_locations WHERE bucket_id = $1 AND storage_id = $2", bucket.BucketID, storageID); err != nil {
+		return util.ProcessErr(err)
+	}
+	if _, err = database.Exec(conn, "INSERT INTO replica_bucket_locations (bucket_id, storage_id) VALUES ($1, $2) ON CONFLICT (bucket_id, storage_id) DO NOTHING", bucket.BucketID, formerID); err != nil {
+		return util.ProcessErr(err)
+	}
+	if _, err = database.Exec(conn, "UPDATE replica_rule_locations SET storage_id = $3 WHERE bucket_id = $1 AND storage_id = $2", bucket.BucketID, storageID, formerID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	// The new master has nothing left to receive.
+	if _, err = database.Exec(conn, "DELETE FROM replication_jobs WHERE bucket_id = $1 AND dst_storage_id = $2 AND status = $3", bucket.BucketID, storageID, database.ReplicationJobPending); err != nil {
+		return util.ProcessErr(err)
+	}
+	if err = DeleteReplicaSyncState(conn, bucket.BucketID, storageID); err != nil {
+		return util.ProcessErr(err)
+	}
+	if err = MarkReplicaStale(conn, bucket.BucketID, formerID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	// Changes are only taken from the master's notifications, those of the
+	// former master are ignored from now on.
+	bucket.StorageID = storageID
+	if err = SetupBucketNotifications(conn, bucket); err != nil {
+		util.PrintWarning(err)
+	}
+
+	return
+}
+
+// Brings the original master of the buckets failed over from the storage
+// deployment back in sync, so they can fail back.
+func RecoverStorageDeployment(conn database.DBConn, sd database.StorageDeploymentRecord) (err error) {
+	failovers, err := database.QueryBucketFailovers(conn, "SELECT * FROM bucket_failovers WHERE original_storage_id = $1 AND status = $2", sd.StorageID, database.FailoverActive)
+	if err != nil { return util.ProcessErr(err) }
+
+	for _, bf := range failovers {
+		if err = EnqueueReplicationJob(conn, bf.BucketID, sd.StorageID, ""); err != nil {
+			return util.ProcessErr(err)
+		}
+		if _, err = database.Exec(conn, "UPDATE bucket_failovers SET status = $2, updated_at = now() WHERE bucket_id = $1", bf.BucketID, database.FailoverFailingBack); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+// Moves the master of the buckets failing back to their original storage
+// deployment, once it is healthy and in sync. The promoted replica goes back
+// to being a replica, up to date but resynced to be sure.
+func FailBackBuckets(conn database.DBConn) (err error) {
+	failovers, err := database.QueryBucketFailovers(conn, `SELECT bf.* FROM bucket_failovers bf
+		INNER JOIN replica_sync_states rss ON rss.bucket_id = bf.bucket_id AND rss.storage_id = bf.original_storage_id
+		INNER JOIN storage_health_states shs ON shs.storage_id = bf.original_storage_id
+		WHERE bf.status = $1 AND rss.status = $2 AND shs.status = $3
+		FOR UPDATE OF bf SKIP LOCKED`,
+		database.FailoverFailingBack, database.ReplicaInSync, database.HealthHealthy)
+	if err != nil { return util.ProcessErr(err) }
+
+	failedBack := false
+	for _, bf := range failovers {
+		bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bf.BucketID)
+		if err != nil { return util.ProcessErr(err) }
+
+		promotedID := bucket.StorageID
+		if err = promoteReplica(conn, bucket, bf.OriginalStorageID); err != nil {
+			return util.ProcessErr(err)
+		}
+		if err = EnqueueReplicationJob(conn, bucket.BucketID, promotedID, ""); err != nil {
+			return util.ProcessErr(err)
+		}
+		if _, err = database.Exec(conn, "DELETE FROM bucket_failovers WHERE bucket_id = $1", bucket.BucketID); err != nil {
+			return util.ProcessErr(err)
+		}
+
+		log.Printf("INFO: Failed bucket %v back to its original storage deployment %v.", bucket.Name, bf.OriginalStorageID)
+		failedBack = true
+	}
+
+	if failedBack {
+		if err := ConfigureLoadBalancer(conn); err != nil { util.PrintWarning(err) }
+	}
+
+	return
+}
+
+// The storage deployment a failed over bucket keeps as a replica to fail back
+// to, if any.
+func failoverOriginal(conn database.DBConn, bucket database.BucketRecord) (storageID int64, err error) {
+	failovers, err := database.QueryBucketFailovers(conn, "SELECT * FROM bucket_failovers WHERE bucket_id = $1", bucket.BucketID)
+	if err != nil { return storageID, util.ProcessErr(err) }
+	if len(failovers) == 1 { storageID = failovers[0].OriginalStorageID }
+
+	return
+}
@@ -0,0 +1,184 @@
+package mutations
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Policies configuring the health checks Caddy runs against the FaaS
+// deployments, then those FaDO's own monitor runs. Each FaaS deployment can
+// override the global ones.
+var HealthCheckPolicies = []string{
+	"lb_health_check_path", "lb_health_check_interval", "lb_health_check_timeout", "lb_passive_fail_duration", "lb_passive_max_fails", "lb_passive_unhealthy_status",
+	"faas_health_path", "faas_health_interval", "faas_health_timeout", "faas_health_failure_threshold", "faas_health_success_threshold",
+}
+
+// Active checks are off while Path is empty, passive ones while FailDuration
+// is.
+type healthCheckSettings struct {
+	Path string
+	Interval string
+	Timeout string
+	FailDuration string
+	MaxFails int
+	UnhealthyStatus []int
+}
+
+// Works out the settings of the FaaS deployment, falling back to the global
+// policies where it sets none. The zero FaaS deployment gets the global ones.
+func resolveHealthCheckSettings(conn database.DBConn, fd database.FaaSDeploymentRecord) (hcs healthCheckSettings, err error) {
+	policies := map[string]interface{}{
+		"lb_health_check_path": &hcs.Path,
+		"lb_health_check_interval": &hcs.Interval,
+		"lb_health_check_timeout": &hcs.Timeout,
+		"lb_passive_fail_duration": &hcs.FailDuration,
+		"lb_passive_max_fails": &hcs.MaxFails,
+		"lb_passive_unhealthy_status": &hcs.UnhealthyStatus,
+	}
+	for name, value := range policies {
+		if err = getFaaSDeploymentOrGlobalPolicy(conn, fd, name, value); err != nil {
+			return hcs, util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+func getFaaSDeploymentOrGlobalPolicy(conn database.DBConn, fd database.FaaSDeploymentRecord, policyName string, value interface{}) (err error) {
+	if set, err := database.GetFaaSDeploymentPolicy(conn, fd, policyName, value); err != nil {
+		return util.ProcessErr(err)
+	} else if set { return nil }
+
+	return util.ProcessErr(database.GetGlobalPolicy(conn, policyName, value))
+}
+
+func (hcs healthCheckSettings) config() *database.HealthChecksConfig {
+	var hc database.HealthChecksConfig
+	if hcs.Path != "" {
+		hc.Active = &database.ActiveHealthChecksConfig{URI: hcs.Path, Interval: hcs.Interval, Timeout: hcs.Timeout}
+	}
+	if hcs.FailDuration != "" {
+		hc.Passive = &database.PassiveHealthChecksConfig{FailDuration: hcs.FailDuration, MaxFails: hcs.MaxFails, UnhealthyStatus: hcs.UnhealthyStatus}
+	}
+	if hc.Active == nil && hc.Passive == nil { return nil }
+	return &hc
+}
+
+// Caddy checks every upstream of a route the same way, so FaaS deployment
+// overrides only apply to routes whose upstreams all agree on them.
+type routeHealthChecks struct {
+	global healthCheckSettings
+	byURL map[string]healthCheckSettings
+}
+
+func resolveRouteHealthChecks(conn database.DBConn) (rhc routeHealthChecks, err error) {
+	if rhc.global, err = resolveHealthCheckSettings(conn, database.FaaSDeploymentRecord{}); err != nil {
+		return rhc, util.ProcessErr(err)
+	}
+
+	faasDeployments, err := database.QueryFaaSDeployments(conn, "SELECT * FROM faas_deployments")
+	if err != nil { return rhc, util.ProcessErr(err) }
+
+	rhc.byURL = make(map[string]healthCheckSettings)
+	for _, fd := range faasDeployments {
+		if rhc.byURL[fd.URL], err = resolveHealthCheckSettings(conn, fd); err != nil {
+			return rhc, util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+func (rhc routeHealthChecks) of(upstreamURLs []string) *database.HealthChecksConfig {
+	var settings *healthCheckSettings
+	for _, u := range upstreamURLs {
+		hcs, exists := rhc.byURL[u]
+		if !exists { hcs = rhc.global }
+		if settings == nil {
+			settings = &hcs
+		} else if !reflect.DeepEqual(*settings, hcs) {
+			log.Printf("INFO: Upstreams %v disagree on their health checks, the global ones are used.", upstreamURLs)
+			return rhc.global.config()
+		}
+	}
+
+	if settings == nil { return rhc.global.config() }
+	return settings.config()
+}
+
+// Checks the value has the type of the policy, and that durations parse. Null
+// is valid for any of them.
+func ValidateHealthCheckPolicy(name string, value interface{}) (err error) {
+	if !util.HasString(HealthCheckPolicies, name) {
+		return util.ProcessErr(fmt.Errorf("Unknown health check policy '%v'.", name))
+	} else if value == nil { return }
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil { return util.ProcessErr(err) }
+
+	switch name {
+	case "lb_health_check_path", "faas_health_path":
+		var path string
+		if err = json.Unmarshal(valueBytes, &path); err != nil { break }
+		if path != "" && path[0] != '/' { err = fmt.Errorf("Expected a path starting with /, got '%v'.", path) }
+	case "lb_health_check_interval", "lb_health_check_timeout", "lb_passive_fail_duration":
+		var duration string
+		if err = json.Unmarshal(valueBytes, &duration); err != nil { break }
+		if duration != "" { _, err = time.ParseDuration(duration) }
+	case "lb_passive_max_fails":
+		var maxFails int
+		if err = json.Unmarshal(valueBytes, &maxFails); err != nil { break }
+		if maxFails < 0 { err = fmt.Errorf("Expected a positive max fails, got %v.", maxFails) }
+	case "lb_passive_unhealthy_status":
+		var statuses []int
+		err = json.Unmarshal(valueBytes, &statuses)
+	case "faas_health_interval", "faas_health_timeout":
+		var seconds float64
+		if err = json.Unmarshal(valueBytes, &seconds); err != nil { break }
+		if seconds <= 0 { err = fmt.Errorf("Expected a positive number of seconds, got %v.", seconds) }
+	case "faas_health_failure_threshold", "faas_health_success_threshold":
+		var threshold int
+		if err = json.Unmarshal(valueBytes, &threshold); err != nil { break }
+		if threshold < 1 { err = fmt.Errorf("Expected a threshold of at least 1, got %v.", threshold) }
+	}
+	if err != nil { return util.ProcessErr(fmt.Errorf("Invalid value %v for %v: %w", string(valueBytes), name, err)) }
+
+	return
+}
+
+// Sets the global health check policies, a null value restores the default.
+func SetHealthCheckPolicies(conn database.DBConn, policies map[string]interface{}) (err error) {
+	for name, value := range policies {
+		if err = ValidateHealthCheckPolicy(name, value); err != nil { return util.ProcessErr(err) }
+		if value == nil {
+			err = database.DeleteGlobalPolicy(conn, name)
+		} else {
+			err = database.SetGlobalPolicy(conn, name, value)
+		}
+		if err != nil { return util.ProcessErr(err) }
+	}
+
+	return util.ProcessErr(ConfigureLoadBalancer(conn))
+}
+
+// Sets the health check policies of the FaaS deployment, a null value falls
+// back to the global policy.
+func SetFaaSDeploymentPolicies(conn database.DBConn, fd database.FaaSDeploymentRecord, policies map[string]interface{}) (err error) {
+	for name, value := range policies {
+		if err = ValidateHealthCheckPolicy(name, value); err != nil { return util.ProcessErr(err) }
+		if value == nil {
+			err = database.DeleteFaaSDeploymentPolicy(conn, fd, name)
+		} else {
+			err = database.SetFaaSDeploymentPolicy(conn, fd, name, value)
+		}
+		if err != nil { return util.ProcessErr(err) }
+	}
+
+	return util.ProcessErr(ConfigureLoadBalancer(conn))
+}
@@ -0,0 +1,162 @@
+package mutations
+
+import (
+	"math"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Counts invocations the gateway forwarded to a URL towards the latency weight
+// of the FaaS deployments behind it.
+func RecordFaaSInvocations(conn database.DBConn, url string, requests, errors int, latencyMsTotal float64) (err error) {
+	_, err = database.Exec(conn, `INSERT INTO faas_invocation_stats (faas_id, requests, errors, latency_ms_total)
+		SELECT faas_id, $2, $3, $4 FROM faas_deployments WHERE url = $1`, url, requests, errors, latencyMsTotal)
+	return util.ProcessErr(err)
+}
+
+// Weighs every FaaS deployment by its mean latency and error rate over the last
+// lb_latency_window seconds, taken from the invocations forwarded by the
+// gateway or, failing those, from the health monitor's probes. The best one
+// gets lb_latency_max_weight, the others proportionally less, and those not
+// measured get the average weight. Returns whether the routes need to be
+// regenerated, i.e. weights changed while the fado_latency policy is in use.
+func RefreshLatencyWeights(conn database.DBConn) (changed bool, err error) {
+	var window float64
+	var maxWeight int
+	if err = database.GetGlobalPolicy(conn, "lb_latency_window", &window); err != nil {
+		return changed, util.ProcessErr(err)
+	}
+	if err = database.GetGlobalPolicy(conn, "lb_latency_max_weight", &maxWeight); err != nil {
+		return changed, util.ProcessErr(err)
+	}
+
+	probes, err := database.QueryFaaSLatencySamples(conn, `SELECT faas_id, count(*)::int, (count(*) FILTER (WHERE NOT healthy))::int, sum(latency_ms)
+		FROM faas_health_checks WHERE checked_at > now() - make_interval(secs => $1) GROUP BY faas_id`, window)
+	if err != nil { return changed, util.ProcessErr(err) }
+	invocations, err := database.QueryFaaSLatencySamples(conn, `SELECT faas_id, sum(requests)::int, sum(errors)::int, sum(latency_ms_total)
+		FROM faas_invocation_stats WHERE sampled_at > now() - make_interval(secs => $1) GROUP BY faas_id`, window)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	samples := make(map[int64]database.FaaSLatencySampleRecord)
+	sources := make(map[int64]string)
+	for _, s := range probes { samples[s.FaaSID], sources[s.FaaSID] = s, database.LatencySourceProbes }
+	for _, s := range invocations {
+		if s.Requests > 0 { samples[s.FaaSID], sources[s.FaaSID] = s, database.LatencySourceInvocations }
+	}
+
+	faasDeployments, err := database.QueryFaaSDeployments(conn, "SELECT * FROM faas_deployments ORDER BY faas_id")
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	// Faster and more reliable deployments score higher, one failing every
+	// request scores nothing.
+	scores := make(map[int64]float64)
+	maxScore := 0.0
+	for _, fd := range faasDeployments {
+		s, exists := samples[fd.FaaSID]
+		if !exists || s.Requests == 0 { continue }
+		latency := math.Max(s.LatencyMsTotal / float64(s.Requests), 1)
+		scores[fd.FaaSID] = (1 - float64(s.Errors) / float64(s.Requests)) / latency
+		maxScore = math.Max(maxScore, scores[fd.FaaSID])
+	}
+
+	weights := make(map[int64]int)
+	total := 0
+	for id, score := range scores {
+		w := 1
+		if maxScore > 0 { w = int(math.Round(float64(maxWeight) * score / maxScore)) }
+		if w < 1 { w = 1 }
+		weights[id] = w
+		total += w
+	}
+	unmeasuredWeight := maxWeight
+	if len(weights) > 0 { unmeasuredWeight = int(math.Round(float64(total) / float64(len(weights)))) }
+
+	current, err := database.QueryFaaSLatencyWeights(conn, "SELECT * FROM faas_latency_weights")
+	if err != nil { return changed, util.ProcessErr(err) }
+	currentWeights := make(map[int64]int)
+	for _, flw := range current { currentWeights[flw.FaaSID] = flw.Weight }
+
+	for _, fd := range faasDeployments {
+		source, weight := database.LatencySourceNone, unmeasuredWeight
+		var samplesCount int
+		var latencyMs, errorRate *float64
+		if w, measured := weights[fd.FaaSID]; measured {
+			s := samples[fd.FaaSID]
+			source, weight, samplesCount = sources[fd.FaaSID], w, s.Requests
+			latency, rate := s.LatencyMsTotal / float64(s.Requests), float64(s.Errors) / float64(s.Requests)
+			latencyMs, errorRate = &latency, &rate
+		}
+
+		_, err = database.Exec(conn, `INSERT INTO faas_latency_weights (faas_id, source, samples, latency_ms, error_rate, weight) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (faas_id) DO UPDATE SET source = $2, samples = $3, latency_ms = $4, error_rate = $5, weight = $6, updated_at = now()`,
+			fd.FaaSID, source, samplesCount, latencyMs, errorRate, weight)
+		if err != nil { return changed, util.ProcessErr(err) }
+
+		if w, exists := currentWeights[fd.FaaSID]; !exists || w != weight { changed = true }
+	}
+
+	if _, err = database.Exec(conn, "DELETE FROM faas_invocation_stats WHERE sampled_at <= now() - make_interval(secs => $1)", window); err != nil {
+		return changed, util.ProcessErr(err)
+	}
+
+	if !changed { return }
+	return latencyPolicyInUse(conn)
+}
+
+func latencyPolicyInUse(conn database.DBConn) (inUse bool, err error) {
+	var policy string
+	if err = database.GetGlobalPolicy(conn, "lb_policy", &policy); err != nil {
+		return inUse, util.ProcessErr(err)
+	} else if policy == database.LatencyPolicy { return true, nil }
+
+	var routeOverridesMap map[string]database.LoadBalancerRouteSettings
+	if err = database.GetGlobalPolicy(conn, "lb_route_overrides", &routeOverridesMap); err != nil {
+		return inUse, util.ProcessErr(err)
+	}
+	for _, rs := range routeOverridesMap {
+		if rs.Policy == database.LatencyPolicy { return true, nil }
+	}
+
+	return
+}
+
+// Latency weights of the FaaS deployments by URL. Those not weighed yet get
+// lb_latency_max_weight until they are.
+type latencyWeights struct {
+	fallback int
+	byURL map[string]int
+}
+
+func resolveLatencyWeights(conn database.DBConn) (lw latencyWeights, err error) {
+	if err = database.GetGlobalPolicy(conn, "lb_latency_max_weight", &lw.fallback); err != nil {
+		return lw, util.ProcessErr(err)
+	}
+
+	faasDeployments, err := database.QueryFaaSDeployments(conn, "SELECT * FROM faas_deployments")
+	if err != nil { return lw, util.ProcessErr(err) }
+	faasWeights, err := database.QueryFaaSLatencyWeights(conn, "SELECT * FROM faas_latency_weights")
+	if err != nil { return lw, util.ProcessErr(err) }
+	weights := make(map[int64]int)
+	for _, flw := range faasWeights { weights[flw.FaaSID] = flw.Weight }
+
+	lw.byURL = make(map[string]int)
+	for _, fd := range faasDeployments {
+		if w, exists := weights[fd.FaaSID]; exists { lw.byURL[fd.URL] = w }
+	}
+
+	return
+}
+
+func (lw latencyWeights) of(urls []string) map[string]int {
+	weights := make(map[string]int)
+	for _, u := range urls {
+		if u == "" { continue }
+		if w, exists := lw.byURL[u]; exists {
+			weights[u] = w
+		} else {
+			weights[u] = lw.fallback
+		}
+	}
+	return weights
+}
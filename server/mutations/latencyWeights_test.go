@@ -0,0 +1,26 @@
+package mutations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLatencyWeightsOf(t *testing.T) {
+	lw := latencyWeights{fallback: 10, byURL: map[string]int{"faas-1:8080": 4, "faas-2:8080": 1}}
+
+	tests := []struct {
+		name string
+		urls []string
+		want map[string]int
+	}{
+		{"weighed", []string{"faas-1:8080", "faas-2:8080"}, map[string]int{"faas-1:8080": 4, "faas-2:8080": 1}},
+		{"not weighed yet", []string{"faas-1:8080", "faas-3:8080"}, map[string]int{"faas-1:8080": 4, "faas-3:8080": 10}},
+		{"empty upstreams skipped", []string{"", "faas-2:8080"}, map[string]int{"faas-2:8080": 1}},
+		{"no upstreams", nil, map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lw.of(tt.urls); !reflect.DeepEqual(got, tt.want) { t.Errorf("latencyWeights.of(%v) = %v, want %v", tt.urls, got, tt.want) }
+		})
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/smithyworks/FaDO/cli"
@@ -13,7 +16,11 @@ import (
 	"github.com/smithyworks/FaDO/util"
 )
 
+// Planned changes leave the load balancer alone, their routes are worked out
+// when the plan is finished.
 func ConfigureLoadBalancer(conn database.DBConn) (err error) {
+	if planOf(conn) != nil { return }
+
 	if conn == nil {
 		if c, err := database.Acquire(); err != nil {
 			return util.ProcessErr(err)
@@ -152,72 +159,303 @@ func ConfigureLoadBalancer(conn database.DBConn) (err error) {
 	return nil
 }
 
+// Caddy keeps its previous configuration when it rejects a new one, which is
+// only reported here as the caller has moved on.
 func postToCaddyWithDelay(url string, bytes io.Reader) {
 	time.Sleep(100 * time.Millisecond)
-	http.Post(url, "application/json", bytes)
+	resp, err := http.Post(url, "application/json", bytes)
+	if err != nil { util.PrintErr(err); return }
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		util.PrintErr(fmt.Errorf("Caddy rejected the load balancer configuration with status %v: %v", resp.Status, strings.TrimSpace(string(body))))
+	}
 }
 
 func GenerateRoutes(conn database.DBConn, policy, matchHeader string) (routes []database.LoadBalancerRouteConfig, err error) {
+	bucketNames, routesMap, newRoutesOverridesMap, err := generateRouteSettings(conn, policy)
+	if err != nil { return routes, util.ProcessErr(err) }
+	objectRoutesMap, err := generateObjectRouteSettings(conn, routesMap, newRoutesOverridesMap)
+	if err != nil { return routes, util.ProcessErr(err) }
+	healthChecks, err := resolveRouteHealthChecks(conn)
+	if err != nil { return routes, util.ProcessErr(err) }
+	weights, err := resolveLatencyWeights(conn)
+	if err != nil { return routes, util.ProcessErr(err) }
+
+	var objectHeader, objectQueryParam string
+	if err = database.GetGlobalPolicy(conn, "lb_object_header", &objectHeader); err != nil {
+		return routes, util.ProcessErr(err)
+	}
+	if err = database.GetGlobalPolicy(conn, "lb_object_query_param", &objectQueryParam); err != nil {
+		return routes, util.ProcessErr(err)
+	}
+
+	// Object routes come first, as the first matching route handles the request.
+	for _, bucketName := range bucketNames {
+		rs := routesMap[bucketName]
+		for _, key := range sortedKeys(objectRoutesMap[bucketName]) {
+			matchers := []database.MatchConfig{
+				{
+					Header: map[string][]string{
+						matchHeader: {rs.BucketName},
+						objectHeader: {key},
+					},
+				},
+				{
+					Header: map[string][]string{
+						matchHeader: {rs.BucketName},
+					},
+					Query: map[string][]string{
+						objectQueryParam: {key},
+					},
+				},
+			}
+			upstreams := objectRoutesMap[bucketName][key]
+			routeWeights := routeWeights(rs.Policy, rs.PolicyParams, upstreams, weights)
+			routes = append(routes, reverseProxyRoute(matchers, rs.Policy, rs.PolicyParams, upstreams, routeWeights, healthChecks.of(upstreams)))
+		}
+	}
+
+	for _, bucketName := range bucketNames {
+		rs := routesMap[bucketName]
+
+		matcher := database.MatchConfig{
+			Header: map[string][]string{
+				matchHeader: {rs.BucketName},
+			},
+		}
+
+		routes = append(routes, reverseProxyRoute([]database.MatchConfig{matcher}, rs.Policy, rs.PolicyParams, rs.Upstreams, rs.Weights, healthChecks.of(rs.Upstreams)))
+	}
+
+	if err := database.SetGlobalPolicy(conn, "lb_routes", routesMap); err != nil {
+		return routes, util.ProcessErr(err)
+	}
+	if err := database.SetGlobalPolicy(conn, "lb_object_routes", objectRoutesMap); err != nil {
+		return routes, util.ProcessErr(err)
+	}
+	if err := database.SetGlobalPolicy(conn, "lb_route_overrides", newRoutesOverridesMap); err != nil {
+		return routes, util.ProcessErr(err)
+	}
+
+	return
+}
+
+func reverseProxyRoute(matchers []database.MatchConfig, policy string, params *database.SelectionPolicyParams, upstreamURLs []string, weights map[string]int, healthChecks *database.HealthChecksConfig) database.LoadBalancerRouteConfig {
+	upstreams := make([]database.UpstreamConfig, 0)
+	for _, fe := range upstreamURLs {
+		if fe != "" { upstreams = append(upstreams, database.UpstreamConfig{Dial: fe}) }
+	}
+
+	handler := database.HandleConfig{
+		Handler: "reverse_proxy",
+		LoadBalancing: &database.LoadBalancingConfig{
+			SelectionPolicy: selectionPolicyConfig(policy, params, upstreams, weights),
+		},
+		HealthChecks: healthChecks,
+		Upstreams: upstreams,
+	}
+
+	return database.LoadBalancerRouteConfig{
+		Handle: []database.HandleConfig{handler},
+		Match: matchers,
+	}
+}
+
+func sortedKeys(m map[string][]string) (keys []string) {
+	for k := range m { keys = append(keys, k) }
+	sort.Strings(keys)
+	return
+}
+
+// Works out the route of every bucket, leaving out the FaaS deployments whose
+// local replica lags behind more than the bucket's replica_staleness_threshold,
+// and those the health monitor found unhealthy. Overridden upstreams are
+// filtered the same way, but the overrides themselves are kept intact so
+// withheld upstreams come back once their replica catches up or they recover.
+// Routes under the default policy take the default parameters, and those under
+// the weighted policies carry the weights of their upstreams.
+func generateRouteSettings(conn database.DBConn, policy string) (bucketNames []string, routesMap, newRoutesOverridesMap map[string]database.LoadBalancerRouteSettings, err error) {
 	// Get bucket and faas associations
 	rows, err := database.Query(conn, "SELECT * FROM buckets_faas_deployments")
-	if err != nil { return routes, util.ProcessErr(err) }
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
 	bucketsFaaSDeployments, err := database.ScanBucketFaaSDeploymentRows(rows)
-	if err != nil { return routes, util.ProcessErr(err) }
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
+
+	freshURLs, staleURLs, err := faasURLsByFreshness(conn)
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
+	unhealthyURLs, err := unhealthyFaaSURLs(conn)
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
+	weights, err := resolveLatencyWeights(conn)
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
+	var policyParams database.SelectionPolicyParams
+	err = database.GetGlobalPolicy(conn, "lb_policy_params", &policyParams)
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
 
 	// Get eventual route overrides
 	var routeOverridesMap map[string]database.LoadBalancerRouteSettings
 	err = database.GetGlobalPolicy(conn, "lb_route_overrides", &routeOverridesMap);
-	if err != nil { return routes, util.ProcessErr(err) }
-	newRoutesOverridesMap := make(map[string]database.LoadBalancerRouteSettings)
+	if err != nil { return bucketNames, routesMap, newRoutesOverridesMap, util.ProcessErr(err) }
+	newRoutesOverridesMap = make(map[string]database.LoadBalancerRouteSettings)
 
-	routesMap := make(map[string]database.LoadBalancerRouteSettings)
+	routesMap = make(map[string]database.LoadBalancerRouteSettings)
 	for _, bfd := range bucketsFaaSDeployments {
+		var upstreams []string
 		rs, isOverridden := routeOverridesMap[bfd.BucketName]
 		if isOverridden {
 			rs.BucketName = bfd.BucketName
+			rs.Weights = nil
 			newRoutesOverridesMap[bfd.BucketName] = rs
+			if rs.Policy == "" { rs.Policy, rs.PolicyParams = policy, globalPolicyParams(policyParams) }
+			for _, u := range rs.Upstreams {
+				if unhealthyURLs[u] { continue }
+				if !staleURLs[bfd.BucketID][u] || freshURLs[bfd.BucketID][u] { upstreams = append(upstreams, u) }
+			}
 		} else {
-			rs.Policy = policy
-			rs.Upstreams = util.MakeStringSet(bfd.FaaSURLs)
+			rs.Policy, rs.PolicyParams = policy, globalPolicyParams(policyParams)
 			rs.BucketName = bfd.BucketName
+			for _, u := range bfd.FaaSURLs {
+				if freshURLs[bfd.BucketID][u] && !unhealthyURLs[u] { upstreams = append(upstreams, u) }
+			}
 		}
+		rs.Upstreams = util.MakeStringSet(upstreams)
+		rs.Weights = routeWeights(rs.Policy, rs.PolicyParams, rs.Upstreams, weights)
 
-		matcher := database.MatchConfig{
-			Header: map[string][]string{
-				matchHeader: {rs.BucketName},
-			},
-		}
+		bucketNames = append(bucketNames, rs.BucketName)
+		routesMap[rs.BucketName] = rs
+	}
 
-		upstreams := make([]database.UpstreamConfig, 0)
-		for _, fe := range rs.Upstreams {
-			if fe != "" { upstreams = append(upstreams, database.UpstreamConfig{Dial: fe}) }
-		}
+	return
+}
 
-		handler := database.HandleConfig{
-			Handler: "reverse_proxy",
-			LoadBalancing: &database.LoadBalancingConfig{
-				SelectionPolicy: database.SelectionPolicyConfig{
-					Policy: rs.Policy,
-				},
-			},
-			Upstreams: upstreams,
-		}
+// Routes only carry the parameters of the global selection policy if it has
+// any.
+func globalPolicyParams(policyParams database.SelectionPolicyParams) *database.SelectionPolicyParams {
+	if len(selectionPolicyParamNames(&policyParams)) == 0 { return nil }
+	return &policyParams
+}
 
-		route := database.LoadBalancerRouteConfig{
-			Handle: []database.HandleConfig{handler},
-			Match: []database.MatchConfig{matcher},
+// Sorts the FaaS deployments co-located with each bucket's master or replicas
+// by whether their local copy of the bucket is fresh enough to be read from.
+func faasURLsByFreshness(conn database.DBConn) (freshURLs, staleURLs map[int64]map[string]bool, err error) {
+	bucketFaaSLocations, err := database.QueryBucketFaaSLocations(conn, "SELECT * FROM bucket_faas_locations")
+	if err != nil { return freshURLs, staleURLs, util.ProcessErr(err) }
+
+	freshURLs = make(map[int64]map[string]bool)
+	staleURLs = make(map[int64]map[string]bool)
+	thresholds := make(map[int64]time.Duration)
+	for _, bfl := range bucketFaaSLocations {
+		threshold, exists := thresholds[bfl.BucketID]
+		if !exists {
+			var seconds float64
+			bucket := database.BucketRecord{BucketID: bfl.BucketID, Name: bfl.BucketName}
+			if _, err = database.GetBucketPolicy(conn, bucket, "replica_staleness_threshold", &seconds); err != nil {
+				return freshURLs, staleURLs, util.ProcessErr(err)
+			}
+			threshold = time.Duration(seconds * float64(time.Second))
+			thresholds[bfl.BucketID] = threshold
 		}
-		
-		routes = append(routes, route)
-		routesMap[rs.BucketName] = rs
+
+		urls := staleURLs
+		if bfl.IsFresh(threshold) { urls = freshURLs }
+		if urls[bfl.BucketID] == nil { urls[bfl.BucketID] = make(map[string]bool) }
+		urls[bfl.BucketID][bfl.FaaSURL] = true
 	}
 
-	if err := database.SetGlobalPolicy(conn, "lb_routes", routesMap); err != nil {
-		return routes, util.ProcessErr(err)
+	return
+}
+
+// Works out the current route of every bucket, keyed by bucket name, without
+// storing them.
+func ResolveRoutes(conn database.DBConn) (routesMap map[string]database.LoadBalancerRouteSettings, err error) {
+	var policy string
+	err = database.GetGlobalPolicy(conn, "lb_policy", &policy)
+	if err != nil { return routesMap, util.ProcessErr(err) }
+
+	_, routesMap, _, err = generateRouteSettings(conn, policy)
+	return routesMap, util.ProcessErr(err)
+}
+
+// Works out which objects should be routed apart from their bucket: those held
+// by a different set of storage deployments than the bucket route covers, e.g.
+// new objects not yet on every replica. Their upstreams are the FaaS
+// deployments co-located with the storage deployments holding the current
+// version, unless the health monitor found them unhealthy. Buckets with
+// overridden routes are left alone, as are objects with no healthy upstream
+// left. At most lb_object_routes_max objects get their own route, the others
+// fall back to their bucket's route.
+func generateObjectRouteSettings(conn database.DBConn, routesMap, routeOverridesMap map[string]database.LoadBalancerRouteSettings) (objectRoutesMap database.ObjectRoutesMap, err error) {
+	var maxRoutes int
+	if err = database.GetGlobalPolicy(conn, "lb_object_routes_max", &maxRoutes); err != nil {
+		return objectRoutesMap, util.ProcessErr(err)
 	}
-	if err := database.SetGlobalPolicy(conn, "lb_route_overrides", newRoutesOverridesMap); err != nil {
-		return routes, util.ProcessErr(err)
+
+	objectFaaSLocations, err := database.QueryObjectFaaSLocations(conn, "SELECT * FROM object_faas_locations ORDER BY bucket_name, object_name")
+	if err != nil { return objectRoutesMap, util.ProcessErr(err) }
+
+	unhealthyURLs, err := unhealthyFaaSURLs(conn)
+	if err != nil { return objectRoutesMap, util.ProcessErr(err) }
+
+	type objectRef struct { bucketName, objectName string }
+	var objectRefs []objectRef
+	objectUpstreams := make(map[objectRef][]string)
+	for _, ofl := range objectFaaSLocations {
+		if unhealthyURLs[ofl.FaaSURL] { continue }
+		ref := objectRef{ofl.BucketName, ofl.ObjectName}
+		if _, exists := objectUpstreams[ref]; !exists { objectRefs = append(objectRefs, ref) }
+		objectUpstreams[ref] = util.AddString(objectUpstreams[ref], ofl.FaaSURL)
+	}
+
+	objectRoutesMap = make(database.ObjectRoutesMap)
+	count := 0
+	for _, ref := range objectRefs {
+		rs, exists := routesMap[ref.bucketName]
+		if _, isOverridden := routeOverridesMap[ref.bucketName]; !exists || isOverridden { continue }
+
+		upstreams := objectUpstreams[ref]
+		sort.Strings(upstreams)
+		bucketUpstreams := append([]string{}, rs.Upstreams...)
+		sort.Strings(bucketUpstreams)
+		if strings.Join(upstreams, "\n") == strings.Join(bucketUpstreams, "\n") { continue }
+
+		if count >= maxRoutes {
+			log.Printf("INFO: Reached the limit of %v object routes, remaining objects are routed by bucket.", maxRoutes)
+			break
+		}
+		if objectRoutesMap[ref.bucketName] == nil { objectRoutesMap[ref.bucketName] = make(map[string][]string) }
+		objectRoutesMap[ref.bucketName][ref.objectName] = upstreams
+		count++
 	}
 
 	return
-}
\ No newline at end of file
+}
+
+// Reconfigures the load balancer only if the routes it would now generate differ
+// from the ones in place, e.g. because a replica fell behind or caught up.
+func ReconcileLoadBalancer(conn database.DBConn) (changed bool, err error) {
+	var currentRoutesMap map[string]database.LoadBalancerRouteSettings
+	err = database.GetGlobalPolicy(conn, "lb_routes", &currentRoutesMap)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	var currentObjectRoutesMap database.ObjectRoutesMap
+	err = database.GetGlobalPolicy(conn, "lb_object_routes", &currentObjectRoutesMap)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	var policy string
+	err = database.GetGlobalPolicy(conn, "lb_policy", &policy)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	_, routesMap, routeOverridesMap, err := generateRouteSettings(conn, policy)
+	if err != nil { return changed, util.ProcessErr(err) }
+	objectRoutesMap, err := generateObjectRouteSettings(conn, routesMap, routeOverridesMap)
+	if err != nil { return changed, util.ProcessErr(err) }
+
+	currentJSON, err := json.Marshal([]interface{}{currentRoutesMap, currentObjectRoutesMap})
+	if err != nil { return changed, util.ProcessErr(err) }
+	routesJSON, err := json.Marshal([]interface{}{routesMap, objectRoutesMap})
+	if err != nil { return changed, util.ProcessErr(err) }
+	if bytes.Equal(currentJSON, routesJSON) { return }
+
+	return true, util.ProcessErr(ConfigureLoadBalancer(conn))
+}
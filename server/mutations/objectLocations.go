@@ -0,0 +1,51 @@
+package mutations
+
+import (
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/storage"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Records that a replica holds the given version of a tracked object. Objects
+// that are not tracked are ignored.
+func RecordObjectLocation(conn database.DBConn, bucketID, storageID int64, key, etag string) (err error) {
+	_, err = database.Exec(conn, `INSERT INTO object_locations (object_id, storage_id, etag)
+		SELECT object_id, $3::int, $4::text FROM objects WHERE bucket_id = $1 AND name = $2
+		ON CONFLICT (object_id, storage_id) DO UPDATE SET etag = EXCLUDED.etag, updated_at = now()`,
+		bucketID, key, storageID, etag)
+	return util.ProcessErr(err)
+}
+
+func RemoveObjectLocation(conn database.DBConn, bucketID, storageID int64, key string) (err error) {
+	_, err = database.Exec(conn, `DELETE FROM object_locations ol USING objects o
+		WHERE ol.object_id = o.object_id AND o.bucket_id = $1 AND o.name = $2 AND ol.storage_id = $3`,
+		bucketID, key, storageID)
+	return util.ProcessErr(err)
+}
+
+// Replaces everything known about which objects a replica holds.
+func SetReplicaObjectLocations(conn database.DBConn, bucketID, storageID int64, objects []storage.ObjectInfo) (err error) {
+	if err = DeleteReplicaObjectLocations(conn, bucketID, storageID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	keys := make([]string, 0, len(objects))
+	etags := make([]string, 0, len(objects))
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+		etags = append(etags, o.ETag)
+	}
+
+	_, err = database.Exec(conn, `INSERT INTO object_locations (object_id, storage_id, etag)
+		SELECT o.object_id, $2::int, x.etag FROM unnest($3::text[], $4::text[]) AS x(name, etag)
+		INNER JOIN objects o ON o.bucket_id = $1 AND o.name = x.name`,
+		bucketID, storageID, keys, etags)
+	return util.ProcessErr(err)
+}
+
+func DeleteReplicaObjectLocations(conn database.DBConn, bucketID, storageID int64) (err error) {
+	_, err = database.Exec(conn, `DELETE FROM object_locations ol USING objects o
+		WHERE ol.object_id = o.object_id AND o.bucket_id = $1 AND ol.storage_id = $2`,
+		bucketID, storageID)
+	return util.ProcessErr(err)
+}
@@ -1,48 +1,92 @@
 package mutations
 
 import (
-	"github.com/minio/minio-go/v7"
 	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/storage"
 	"github.com/smithyworks/FaDO/util"
 )
 
 func TrackBucketObjects(conn database.DBConn, bucket database.BucketRecord) (err error) {
+	_, err = trackBucketObjects(conn, bucket)
+	return util.ProcessErr(err)
+}
+
+// Detects changes to a bucket whose storage deployment cannot notify FaDO, by
+// diffing its listing against the tracked objects, and queues their replication.
+func PollBucketChanges(conn database.DBConn, bucket database.BucketRecord) (err error) {
+	changedKeys, err := trackBucketObjects(conn, bucket)
+	if err != nil { return util.ProcessErr(err) }
+
+	for _, key := range changedKeys {
+		if err = EnqueueBucketReplicationJobs(conn, bucket.Name, key); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+// Brings the tracked objects of a bucket in line with storage, returning the
+// keys of objects that were added, changed or removed.
+func trackBucketObjects(conn database.DBConn, bucket database.BucketRecord) (changedKeys []string, err error) {
 	// Fetch currently tracked objects and make a convenient map
 	databaseObjectMap := make(map[string]database.ObjectRecord)
 	if objectRecords, err := database.QueryObjects(conn, "SELECT * FROM objects WHERE bucket_id = $1", bucket.BucketID); err != nil {
-		return util.ProcessErr(err)
+		return changedKeys, util.ProcessErr(err)
 	} else {
 		for _, or := range objectRecords { databaseObjectMap[or.Name] = or }
 	}
 
-	// List out objects from minio
-	latestObjects := make([]string, 0)
-	if client, err := CreateMinioClient(conn, bucket.StorageID); err != nil {
-		return util.ProcessErr(err)
+	// List out objects from storage. Plans do not contact storage, the objects
+	// already tracked stand in for those stored.
+	if planOf(conn) != nil { return }
+	var latestObjects []storage.ObjectInfo
+	if backend, err := CreateStorageBackend(conn, bucket.StorageID); err != nil {
+		return changedKeys, util.ProcessErr(err)
 	} else {
-		for o := range client.ListObjects(ctx, bucket.Name, minio.ListObjectsOptions{Recursive: true}) {
-			latestObjects = append(latestObjects, o.Key)
+		if latestObjects, err = backend.ListObjects(bucket.Name); err != nil {
+			return changedKeys, util.ProcessErr(err)
 		}
 	}
 
-	// Go through all the minio objects and make sure they are tracked in the database,
-	for _, oName := range latestObjects {
-		_, oExists := databaseObjectMap[oName]
+	// Go through all the stored objects and make sure they are tracked in the database,
+	for _, o := range latestObjects {
+		or, oExists := databaseObjectMap[o.Key]
 		if oExists {
-			delete(databaseObjectMap, oName)
-		} else {
-			newO := database.ObjectRecord{BucketID: bucket.BucketID, Name: oName}
-			if _, err = database.InsertObject(conn, newO); err != nil {
-				return util.ProcessErr(err)
+			delete(databaseObjectMap, o.Key)
+		}
+		if !oExists || or.ETag != o.ETag || or.Size != o.Size {
+			newO := database.ObjectRecord{BucketID: bucket.BucketID, Name: o.Key, ETag: o.ETag, Size: o.Size}
+			if _, err = database.UpsertObject(conn, newO); err != nil {
+				return changedKeys, util.ProcessErr(err)
 			}
+			changedKeys = append(changedKeys, o.Key)
 		}
 	}
 
-	// Clean up any objects that are no longer in minio
+	// Clean up any objects that are no longer in storage
 	for _, obj := range databaseObjectMap {
 		if _, err = database.Exec(conn, "DELETE FROM objects WHERE object_id = $1", obj.ObjectID); err != nil {
-			return util.ProcessErr(err)
+			return changedKeys, util.ProcessErr(err)
 		}
+		changedKeys = append(changedKeys, obj.Name)
+	}
+
+	return
+}
+
+func TrackObject(conn database.DBConn, object database.ObjectRecord) (err error) {
+	object.ETag = trimETag(object.ETag)
+	if _, err = database.UpsertObject(conn, object); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return
+}
+
+func UntrackObject(conn database.DBConn, object database.ObjectRecord) (err error) {
+	if _, err = database.Exec(conn, "DELETE FROM objects WHERE bucket_id = $1 AND name = $2", object.BucketID, object.Name); err != nil {
+		return util.ProcessErr(err)
 	}
 
 	return
@@ -52,14 +96,20 @@ func DeleteObject(conn database.DBConn, object database.ObjectRecord) (err error
 	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", object.BucketID)
 	if err != nil { return util.ProcessErr(err) }
 
-	client, err := CreateMinioClient(conn, bucket.StorageID)
-	if err != nil { return util.ProcessErr(err) }
+	if planOf(conn) == nil {
+		backend, err := CreateStorageBackend(conn, bucket.StorageID)
+		if err != nil { return util.ProcessErr(err) }
 
-	err = client.RemoveObject(ctx, bucket.Name, object.Name, minio.RemoveObjectOptions{ForceDelete: true})
-	if err != nil { return util.ProcessErr(err) }
+		err = backend.DeleteObject(bucket.Name, object.Name)
+		if err != nil { return util.ProcessErr(err) }
+	}
 
 	_, err = database.Exec(conn, "DELETE FROM objects WHERE object_id = $1", object.ObjectID)
 	if err != nil { return util.ProcessErr(err) }
 
+	// Storage deployments that are polled do not report the deletion.
+	err = EnqueueBucketReplicationJobs(conn, bucket.Name, object.Name)
+	if err != nil { return util.ProcessErr(err) }
+
 	return
 }
\ No newline at end of file
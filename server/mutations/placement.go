@@ -0,0 +1,501 @@
+package mutations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/storage"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Relative importance of each placement factor. Each factor scores between 0
+// and 1, the cluster's placement_weight scales their weighted sum.
+const (
+	placementCapacityWeight = 0.4
+	placementLocalityWeight = 0.3
+	placementLoadWeight = 0.3
+)
+
+// Added to the score of storage deployments already replicating the rule's
+// objects, so that small differences between candidates do not move replicas
+// around.
+const placementStickiness = 0.1
+
+// Storage deployments whose capacity is unknown score as half full.
+const placementUnknownCapacity = 0.5
+
+// Capacity is only asked of a storage deployment this often.
+const capacityCacheTTL = time.Minute
+
+type PlacementCandidate struct {
+	StorageID int64 `json:"storage_id"`
+	Alias string `json:"alias"`
+	ClusterID int64 `json:"cluster_id"`
+	CapacityKnown bool `json:"capacity_known"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes uint64 `json:"free_bytes"`
+	FaaSCount int64 `json:"faas_count"`
+	BucketCount int64 `json:"bucket_count"`
+	ClusterWeight float64 `json:"cluster_weight"`
+	FailureDomains map[string]string `json:"failure_domains"`
+	Current bool `json:"current"`
+
+	CapacityScore float64 `json:"capacity_score"`
+	LocalityScore float64 `json:"locality_score"`
+	LoadScore float64 `json:"load_score"`
+	StickinessScore float64 `json:"stickiness_score"`
+	Score float64 `json:"score"`
+	Selected bool `json:"selected"`
+}
+
+// Where the objects covered by a replication rule are placed. The bucket-wide
+// rule has an empty key. Explicit placements are taken from the bucket's
+// replica_locations policy as is, without scoring any candidates. Placements
+// falling short of the replica count or the bucket's spread constraints are
+// unsatisfiable, the reasons say why.
+type RulePlacement struct {
+	RuleKey string `json:"rule_key"`
+	Zones []string `json:"zones"`
+	TargetReplicaCount int `json:"target_replica_count"`
+	Explicit bool `json:"explicit"`
+	Candidates []PlacementCandidate `json:"candidates"`
+	StorageIDs []int64 `json:"storage_ids"`
+	Status string `json:"status"`
+	Reasons []string `json:"reasons"`
+}
+
+func SetBucketSpreadConstraints(conn database.DBConn, bucket database.BucketRecord, constraints []database.SpreadConstraint) (err error) {
+	if err = database.ValidateSpreadConstraints(constraints); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	if len(constraints) == 0 {
+		err = database.DeleteBucketPolicy(conn, bucket, "spread_constraints")
+	} else {
+		err = database.SetBucketPolicy(conn, bucket, "spread_constraints", constraints)
+	}
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(ResolveBucketReplicas(conn, bucket))
+}
+
+func SetClusterFailureDomains(conn database.DBConn, cluster database.ClusterRecord, domains map[string]string) (err error) {
+	if len(domains) == 0 {
+		err = database.DeleteClusterPolicy(conn, cluster, "failure_domains")
+	} else {
+		err = database.SetClusterPolicy(conn, cluster, "failure_domains", domains)
+	}
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(ResolveAllBucketReplicas(conn))
+}
+
+func SetStorageDeploymentFailureDomains(conn database.DBConn, sd database.StorageDeploymentRecord, domains map[string]string) (err error) {
+	if len(domains) == 0 {
+		err = database.DeleteStorageDeploymentPolicy(conn, sd, "failure_domains")
+	} else {
+		err = database.SetStorageDeploymentPolicy(conn, sd, "failure_domains", domains)
+	}
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(ResolveAllBucketReplicas(conn))
+}
+
+func ResolveAllBucketReplicas(conn database.DBConn) (err error) {
+	buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets")
+	if err != nil { return util.ProcessErr(err) }
+
+	for _, b := range buckets {
+		if err = ResolveBucketReplicas(conn, b); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+// Works out where each replication rule of the bucket should place replicas.
+func ResolveBucketPlacement(conn database.DBConn, bucket database.BucketRecord) (placements []RulePlacement, err error) {
+	var constraints []database.SpreadConstraint
+	_, err = database.GetBucketPolicy(conn, bucket, "spread_constraints", &constraints)
+	if err != nil { return placements, util.ProcessErr(err) }
+
+	var locations []int64
+	if ok, err := database.GetBucketPolicy(conn, bucket, "replica_locations", &locations); ok && err == nil {
+		rp, err := explicitRulePlacement(conn, bucket, locations, constraints)
+		if err != nil { return placements, util.ProcessErr(err) }
+		placements = append(placements, rp)
+	} else {
+		var bucketZones []string
+		_, err = database.GetBucketPolicy(conn, bucket, "zones", &bucketZones)
+		if err != nil { return placements, util.ProcessErr(err) }
+
+		var targetReplicaCount int
+		_, err = database.GetBucketPolicy(conn, bucket, "target_replica_count", &targetReplicaCount)
+		if err != nil { return placements, util.ProcessErr(err) }
+
+		rp, err := scoreRulePlacement(conn, bucket, "", bucketZones, targetReplicaCount, constraints)
+		if err != nil { return placements, util.ProcessErr(err) }
+		placements = append(placements, rp)
+	}
+
+	var rules []database.ReplicationRule
+	_, err = database.GetBucketPolicy(conn, bucket, "replication_rules", &rules)
+	if err != nil { return placements, util.ProcessErr(err) }
+
+	for _, rr := range rules {
+		rp, err := scoreRulePlacement(conn, bucket, rr.Pattern, rr.Zones, rr.TargetReplicaCount, constraints)
+		if err != nil { return placements, util.ProcessErr(err) }
+		placements = append(placements, rp)
+	}
+
+	return
+}
+
+// Replica locations chosen by hand are kept even if they break the spread
+// constraints, which are only reported on, but never if they break the
+// bucket's residency policies.
+func explicitRulePlacement(conn database.DBConn, bucket database.BucketRecord, locations []int64, constraints []database.SpreadConstraint) (rp RulePlacement, err error) {
+	rp = RulePlacement{Zones: []string{}, TargetReplicaCount: len(locations), Explicit: true, Candidates: []PlacementCandidate{}, StorageIDs: locations}
+
+	for _, id := range locations {
+		if err = CheckReplicaResidency(conn, bucket, id); err != nil {
+			return rp, util.ProcessErr(err)
+		}
+	}
+
+	storageDeployments, err := database.QueryStorageDeployments(conn, "SELECT * FROM storage_deployments WHERE storage_id = ANY($1)", locations)
+	if err != nil { return rp, util.ProcessErr(err) }
+
+	var domains []map[string]string
+	for _, sd := range storageDeployments {
+		fd, err := storageFailureDomains(conn, sd)
+		if err != nil { return rp, util.ProcessErr(err) }
+		domains = append(domains, fd)
+	}
+
+	rp.setStatus(checkSpread(domains, len(locations), constraints))
+
+	return
+}
+
+// Scores the candidates for a rule and picks the best targetReplicaCount
+// allowed by the spread constraints.
+func scoreRulePlacement(conn database.DBConn, bucket database.BucketRecord, ruleKey string, zones []string, targetReplicaCount int, constraints []database.SpreadConstraint) (rp RulePlacement, err error) {
+	if zones == nil { zones = []string{} }
+	rp = RulePlacement{RuleKey: ruleKey, Zones: zones, TargetReplicaCount: targetReplicaCount, Candidates: []PlacementCandidate{}, StorageIDs: []int64{}}
+
+	candidates, err := replicaCandidates(conn, bucket, zones)
+	if err != nil { return rp, util.ProcessErr(err) }
+	if len(candidates) == 0 {
+		rp.setStatus(checkSpread(nil, targetReplicaCount, constraints))
+		return
+	}
+
+	faasCounts, err := countByID(conn, "SELECT cluster_id, count(*) FROM faas_deployments GROUP BY cluster_id")
+	if err != nil { return rp, util.ProcessErr(err) }
+
+	// Buckets held by each storage deployment, as master or replica, not
+	// counting the one being placed.
+	bucketCounts, err := countByID(conn, `SELECT storage_id, count(*) FROM (
+			SELECT storage_id FROM buckets WHERE bucket_id <> $1
+			UNION ALL SELECT storage_id FROM replica_bucket_locations WHERE bucket_id <> $1
+		) l GROUP BY storage_id`, bucket.BucketID)
+	if err != nil { return rp, util.ProcessErr(err) }
+
+	current, err := database.QueryReplicaRuleLocations(conn, "SELECT * FROM replica_rule_locations WHERE bucket_id = $1 AND rule_key = $2", bucket.BucketID, ruleKey)
+	if err != nil { return rp, util.ProcessErr(err) }
+
+	clusterWeights := make(map[int64]float64)
+	for _, sd := range candidates {
+		if _, ok := clusterWeights[sd.ClusterID]; !ok {
+			var weight float64
+			if _, err = database.GetClusterPolicy(conn, database.ClusterRecord{ClusterID: sd.ClusterID}, "placement_weight", &weight); err != nil {
+				return rp, util.ProcessErr(err)
+			}
+			clusterWeights[sd.ClusterID] = weight
+		}
+
+		pc := PlacementCandidate{StorageID: sd.StorageID, Alias: sd.Alias, ClusterID: sd.ClusterID, FaaSCount: faasCounts[sd.ClusterID], BucketCount: bucketCounts[sd.StorageID], ClusterWeight: clusterWeights[sd.ClusterID]}
+		if pc.FailureDomains, err = storageFailureDomains(conn, sd); err != nil {
+			return rp, util.ProcessErr(err)
+		}
+		if c, known := storageCapacity(conn, sd); known {
+			pc.CapacityKnown, pc.TotalBytes, pc.FreeBytes = true, c.Total, c.Free
+		}
+		for _, rrl := range current {
+			if rrl.StorageID == sd.StorageID { pc.Current = true }
+		}
+
+		rp.Candidates = append(rp.Candidates, pc)
+	}
+
+	scoreCandidates(rp.Candidates)
+	selectReplicas(&rp, constraints)
+
+	return
+}
+
+// Scores each candidate relative to the others and sorts them best first, ties
+// going to the oldest storage deployment.
+func scoreCandidates(candidates []PlacementCandidate) {
+	var maxFree uint64
+	var maxFaaS, maxBuckets int64
+	for _, pc := range candidates {
+		if pc.CapacityKnown && pc.FreeBytes > maxFree { maxFree = pc.FreeBytes }
+		if pc.FaaSCount > maxFaaS { maxFaaS = pc.FaaSCount }
+		if pc.BucketCount > maxBuckets { maxBuckets = pc.BucketCount }
+	}
+
+	for i := range candidates {
+		pc := &candidates[i]
+
+		pc.CapacityScore = placementUnknownCapacity
+		if pc.CapacityKnown {
+			pc.CapacityScore = 0
+			if maxFree > 0 { pc.CapacityScore = float64(pc.FreeBytes) / float64(maxFree) }
+		}
+		if maxFaaS > 0 { pc.LocalityScore = float64(pc.FaaSCount) / float64(maxFaaS) }
+		pc.LoadScore = 1
+		if maxBuckets > 0 { pc.LoadScore = 1 - float64(pc.BucketCount) / float64(maxBuckets) }
+		if pc.Current { pc.StickinessScore = placementStickiness }
+
+		pc.Score = pc.ClusterWeight * (placementCapacityWeight * pc.CapacityScore + placementLocalityWeight * pc.LocalityScore + placementLoadWeight * pc.LoadScore) + pc.StickinessScore
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score { return candidates[i].Score > candidates[j].Score }
+		return candidates[i].StorageID < candidates[j].StorageID
+	})
+}
+
+// Picks candidates in order of score. Candidates adding a new value to a
+// failure domain that needs more distinct values go first, and candidates that
+// would put too many replicas on one value are skipped. Clusters weighted at
+// zero or less never receive replicas.
+func selectReplicas(rp *RulePlacement, constraints []database.SpreadConstraint) {
+	perValue := make(map[string]map[string]int)
+	for _, sc := range constraints { perValue[sc.Domain] = make(map[string]int) }
+
+	allowed := func(pc PlacementCandidate) bool {
+		if pc.Selected || pc.ClusterWeight <= 0 { return false }
+		for _, sc := range constraints {
+			if sc.MaxPerValue == 0 { continue }
+			// Replicas can only be kept apart on domains they are labelled with.
+			value, ok := pc.FailureDomains[sc.Domain]
+			if !ok || perValue[sc.Domain][value] >= sc.MaxPerValue { return false }
+		}
+		return true
+	}
+	selectCandidate := func(pc *PlacementCandidate) {
+		pc.Selected = true
+		rp.StorageIDs = append(rp.StorageIDs, pc.StorageID)
+		for domain, counts := range perValue {
+			if value, ok := pc.FailureDomains[domain]; ok { counts[value]++ }
+		}
+	}
+
+	for _, sc := range constraints {
+		for i := range rp.Candidates {
+			pc := &rp.Candidates[i]
+			if len(perValue[sc.Domain]) >= sc.MinDistinct || len(rp.StorageIDs) >= rp.TargetReplicaCount { break }
+
+			value, ok := pc.FailureDomains[sc.Domain]
+			if ok && perValue[sc.Domain][value] == 0 && allowed(*pc) { selectCandidate(pc) }
+		}
+	}
+	for i := range rp.Candidates {
+		pc := &rp.Candidates[i]
+		if len(rp.StorageIDs) >= rp.TargetReplicaCount { break }
+		if allowed(*pc) { selectCandidate(pc) }
+	}
+
+	var domains []map[string]string
+	for _, pc := range rp.Candidates {
+		if pc.Selected { domains = append(domains, pc.FailureDomains) }
+	}
+	rp.setStatus(checkSpread(domains, rp.TargetReplicaCount, constraints))
+}
+
+// Lists the ways in which replicas with the given failure domains fall short
+// of the replica count and the spread constraints.
+func checkSpread(domains []map[string]string, targetReplicaCount int, constraints []database.SpreadConstraint) (reasons []string) {
+	if len(domains) < targetReplicaCount {
+		reasons = append(reasons, fmt.Sprintf("Only %v of %v replicas could be placed.", len(domains), targetReplicaCount))
+	}
+
+	for _, sc := range constraints {
+		counts := make(map[string]int)
+		for _, fd := range domains {
+			if value, ok := fd[sc.Domain]; ok { counts[value]++ }
+		}
+
+		if len(counts) < sc.MinDistinct {
+			reasons = append(reasons, fmt.Sprintf("Replicas span %v distinct %v values, at least %v are required.", len(counts), sc.Domain, sc.MinDistinct))
+		}
+		if sc.MaxPerValue > 0 {
+			var values []string
+			for value := range counts { values = append(values, value) }
+			sort.Strings(values)
+			for _, value := range values {
+				if counts[value] > sc.MaxPerValue {
+					reasons = append(reasons, fmt.Sprintf("%v replicas share %v '%v', at most %v are allowed.", counts[value], sc.Domain, value, sc.MaxPerValue))
+				}
+			}
+			unlabelled := 0
+			for _, fd := range domains {
+				if _, ok := fd[sc.Domain]; !ok { unlabelled++ }
+			}
+			if unlabelled > 0 {
+				reasons = append(reasons, fmt.Sprintf("%v replicas have no %v label.", unlabelled, sc.Domain))
+			}
+		}
+	}
+
+	return
+}
+
+// Records the status of each rule's placement, warning about those that
+// cannot be satisfied.
+func setBucketPlacementStatuses(conn database.DBConn, bucket database.BucketRecord, placements []RulePlacement) (err error) {
+	if _, err = database.Exec(conn, "DELETE FROM bucket_placement_statuses WHERE bucket_id = $1", bucket.BucketID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	for _, rp := range placements {
+		if rp.Status == database.PlacementUnsatisfiable {
+			util.PrintWarning(fmt.Errorf("Placement of bucket %v (rule '%v') is unsatisfiable: %v", bucket.Name, rp.RuleKey, strings.Join(rp.Reasons, " ")))
+		}
+		if _, err = database.Exec(conn, "INSERT INTO bucket_placement_statuses (bucket_id, rule_key, status, reasons) VALUES ($1, $2, $3, $4)", bucket.BucketID, rp.RuleKey, rp.Status, rp.Reasons); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+func (rp *RulePlacement) setStatus(reasons []string) {
+	rp.Status, rp.Reasons = database.PlacementSatisfied, []string{}
+	if len(reasons) > 0 { rp.Status, rp.Reasons = database.PlacementUnsatisfiable, reasons }
+}
+
+// Failure domain labels of a storage deployment, its own labels taking
+// precedence over those of its cluster.
+func storageFailureDomains(conn database.DBConn, sd database.StorageDeploymentRecord) (domains map[string]string, err error) {
+	domains = make(map[string]string)
+
+	var clusterDomains, storageDomains map[string]string
+	if _, err = database.GetClusterPolicy(conn, database.ClusterRecord{ClusterID: sd.ClusterID}, "failure_domains", &clusterDomains); err != nil {
+		return domains, util.ProcessErr(err)
+	}
+	if _, err = database.GetStorageDeploymentPolicy(conn, sd, "failure_domains", &storageDomains); err != nil {
+		return domains, util.ProcessErr(err)
+	}
+
+	for k, v := range clusterDomains { domains[k] = v }
+	for k, v := range storageDomains { domains[k] = v }
+
+	return
+}
+
+// Storage deployments outside of the bucket's home cluster, in clusters
+// sharing a zone with the given ones, if any, and where the bucket's residency
+// policies allow replicas.
+func replicaCandidates(conn database.DBConn, bucket database.BucketRecord, zones []string) (storageDeployments []database.StorageDeploymentRecord, err error) {
+	// get bucket's home cluster for exclusion
+
+	homeStorageDeployment, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", bucket.StorageID)
+	if err != nil { return storageDeployments, util.ProcessErr(err) }
+	homeCluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE cluster_id = $1", homeStorageDeployment.ClusterID)
+	if err != nil { return storageDeployments, util.ProcessErr(err) }
+
+	clusters, err := database.QueryClusters(conn, "SELECT * FROM clusters")
+	if err != nil { return storageDeployments, util.ProcessErr(err) }
+
+	var possibleCluster []int64
+	for _, c := range clusters {
+		var clusterZones []string
+		_, err = database.GetClusterPolicy(conn, c, "zones", &clusterZones)
+		if err != nil { return storageDeployments, util.ProcessErr(err) }
+
+		overlap := false
+		if homeCluster.ClusterID != c.ClusterID {
+			if len(zones) == 0 { overlap = true } else {
+				for _, z := range clusterZones { if util.HasString(zones, z) { overlap = true; break } }
+			}
+		}
+
+		if overlap {
+			if reason, err := residencyViolation(conn, bucket, c, true); err != nil {
+				return storageDeployments, util.ProcessErr(err)
+			} else if reason != "" {
+				overlap = false
+			}
+		}
+
+		if overlap { possibleCluster = append(possibleCluster, c.ClusterID) }
+	}
+
+	storageDeployments, err = database.QueryStorageDeployments(conn, "SELECT * FROM storage_deployments WHERE cluster_id = ANY($1) ORDER BY storage_id", possibleCluster)
+	return storageDeployments, util.ProcessErr(err)
+}
+
+func countByID(conn database.DBConn, sql string, args ...interface{}) (counts map[int64]int64, err error) {
+	counts = make(map[int64]int64)
+
+	rows, err := database.Query(conn, sql, args...)
+	if err != nil { return counts, util.ProcessErr(err) }
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int64
+		if err = rows.Scan(&id, &count); err != nil { return counts, util.ProcessErr(err) }
+		counts[id] = count
+	}
+
+	return counts, util.ProcessErr(rows.Err())
+}
+
+type capacityCacheEntry struct {
+	capacity storage.Capacity
+	known bool
+	expires time.Time
+}
+
+var capacityCache = struct {
+	sync.Mutex
+	entries map[int64]capacityCacheEntry
+}{entries: make(map[int64]capacityCacheEntry)}
+
+// Asks the storage deployment for its capacity, remembering the answer for a
+// while. Failures are remembered too, so an unreachable deployment does not
+// slow down every placement. Plans only use answers already remembered, even
+// stale ones, and leave the capacity of other deployments unknown.
+func storageCapacity(conn database.DBConn, sd database.StorageDeploymentRecord) (c storage.Capacity, known bool) {
+	capacityCache.Lock()
+	entry, ok := capacityCache.entries[sd.StorageID]
+	capacityCache.Unlock()
+	if ok && (time.Now().Before(entry.expires) || planOf(conn) != nil) { return entry.capacity, entry.known }
+	if planOf(conn) != nil { return }
+
+	entry = capacityCacheEntry{expires: time.Now().Add(capacityCacheTTL)}
+	if backend, err := CreateStorageBackend(conn, sd); err != nil {
+		util.PrintWarning(err)
+	} else if reporter, ok := backend.(storage.CapacityReporter); ok {
+		if entry.capacity, err = reporter.Capacity(); err == nil {
+			entry.known = true
+		} else if err != storage.ErrNotSupported {
+			util.PrintWarning(err)
+		}
+	}
+
+	capacityCache.Lock()
+	capacityCache.entries[sd.StorageID] = entry
+	capacityCache.Unlock()
+
+	return entry.capacity, entry.known
+}
@@ -0,0 +1,90 @@
+package mutations
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreCandidates(t *testing.T) {
+	tests := []struct {
+		name string
+		candidates []PlacementCandidate
+		wantOrder []int64
+		wantScores []float64
+	}{
+		{
+			"more free capacity first",
+			[]PlacementCandidate{
+				{StorageID: 1, CapacityKnown: true, FreeBytes: 50, ClusterWeight: 1},
+				{StorageID: 2, CapacityKnown: true, FreeBytes: 100, ClusterWeight: 1},
+			},
+			[]int64{2, 1},
+			[]float64{0.7, 0.5},
+		},
+		{
+			"unknown capacity scores as half full",
+			[]PlacementCandidate{
+				{StorageID: 1, CapacityKnown: true, FreeBytes: 0, ClusterWeight: 1},
+				{StorageID: 2, ClusterWeight: 1},
+			},
+			[]int64{2, 1},
+			[]float64{0.5, 0.3},
+		},
+		{
+			"more FaaS deployments first",
+			[]PlacementCandidate{
+				{StorageID: 1, FaaSCount: 1, ClusterWeight: 1},
+				{StorageID: 2, FaaSCount: 4, ClusterWeight: 1},
+			},
+			[]int64{2, 1},
+			[]float64{0.8, 0.575},
+		},
+		{
+			"fewer buckets first",
+			[]PlacementCandidate{
+				{StorageID: 1, BucketCount: 4, ClusterWeight: 1},
+				{StorageID: 2, BucketCount: 2, ClusterWeight: 1},
+			},
+			[]int64{2, 1},
+			[]float64{0.35, 0.2},
+		},
+		{
+			"current replica kept over a slightly better candidate",
+			[]PlacementCandidate{
+				{StorageID: 1, CapacityKnown: true, FreeBytes: 100, ClusterWeight: 1},
+				{StorageID: 2, CapacityKnown: true, FreeBytes: 80, ClusterWeight: 1, Current: true},
+			},
+			[]int64{2, 1},
+			[]float64{0.72, 0.7},
+		},
+		{
+			"cluster weight scales the score",
+			[]PlacementCandidate{
+				{StorageID: 1, ClusterWeight: 1},
+				{StorageID: 2, ClusterWeight: 2},
+				{StorageID: 3, ClusterWeight: 0},
+			},
+			[]int64{2, 1, 3},
+			[]float64{1, 0.5, 0},
+		},
+		{
+			"ties go to the oldest storage deployment",
+			[]PlacementCandidate{
+				{StorageID: 3, ClusterWeight: 1},
+				{StorageID: 1, ClusterWeight: 1},
+				{StorageID: 2, ClusterWeight: 1},
+			},
+			[]int64{1, 2, 3},
+			[]float64{0.5, 0.5, 0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoreCandidates(tt.candidates)
+			for i, pc := range tt.candidates {
+				if pc.StorageID != tt.wantOrder[i] { t.Fatalf("candidate %v is storage deployment %v, want %v", i, pc.StorageID, tt.wantOrder[i]) }
+				if math.Abs(pc.Score - tt.wantScores[i]) > 1e-9 { t.Errorf("score of storage deployment %v = %v, want %v", pc.StorageID, pc.Score, tt.wantScores[i]) }
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package mutations
+
+import (
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type PlannedBucket struct {
+	BucketID int64 `json:"bucket_id"`
+	BucketName string `json:"bucket_name"`
+	StorageID int64 `json:"storage_id"`
+	StorageAlias string `json:"storage_alias"`
+	Bytes int64 `json:"bytes"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+}
+
+// What a set of mutations would do. Bytes copied count resynced replicas in
+// full, so they are an upper bound; bytes destroyed are those found on the
+// deleted masters and on replicas deleted without a grace period. Replicas
+// kept for a grace period carry the time their data would be deleted.
+type Plan struct {
+	ReplicasCreated []PlannedBucket `json:"replicas_created"`
+	ReplicasResynced []PlannedBucket `json:"replicas_resynced"`
+	ReplicasDeleted []PlannedBucket `json:"replicas_deleted"`
+	MastersDeleted []PlannedBucket `json:"masters_deleted"`
+	BytesCopied int64 `json:"bytes_copied"`
+	BytesDestroyed int64 `json:"bytes_destroyed"`
+	Routes map[string]database.LoadBalancerRouteSettings `json:"routes"`
+	ObjectRoutes database.ObjectRoutesMap `json:"object_routes"`
+}
+
+// Mutations run through a plan connection change the database as usual, but
+// leave storage deployments and the load balancer alone and record what they
+// would have done instead. The surrounding transaction must be rolled back.
+type planConn struct {
+	database.DBConn
+	plan *Plan
+}
+
+func PlanChanges(conn database.DBConn) (database.DBConn, *Plan) {
+	plan := &Plan{ReplicasCreated: []PlannedBucket{}, ReplicasResynced: []PlannedBucket{}, ReplicasDeleted: []PlannedBucket{}, MastersDeleted: []PlannedBucket{}}
+	return &planConn{DBConn: conn, plan: plan}, plan
+}
+
+// Returns the plan being recorded, or nil if changes are for real.
+func planOf(conn database.DBConn) *Plan {
+	if pc, ok := conn.(*planConn); ok { return pc.plan }
+	return nil
+}
+
+// Fills in the load balancer routes resulting from the planned changes.
+func (p *Plan) Finish(conn database.DBConn) (err error) {
+	var policy string
+	if err = database.GetGlobalPolicy(conn, "lb_policy", &policy); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	_, routesMap, routeOverridesMap, err := generateRouteSettings(conn, policy)
+	if err != nil { return util.ProcessErr(err) }
+	if p.ObjectRoutes, err = generateObjectRouteSettings(conn, routesMap, routeOverridesMap); err != nil {
+		return util.ProcessErr(err)
+	}
+	p.Routes = routesMap
+
+	return
+}
+
+func plannedBucket(conn database.DBConn, bucketID, storageID int64) (pb PlannedBucket, err error) {
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bucketID)
+	if err != nil { return pb, util.ProcessErr(err) }
+	sd, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", storageID)
+	if err != nil { return pb, util.ProcessErr(err) }
+
+	return PlannedBucket{BucketID: bucketID, BucketName: bucket.Name, StorageID: storageID, StorageAlias: sd.Alias}, nil
+}
+
+// The objects the replica would receive, according to the bucket's rules.
+func replicaCopy(conn database.DBConn, bucketID, storageID int64) (pb PlannedBucket, err error) {
+	if pb, err = plannedBucket(conn, bucketID, storageID); err != nil {
+		return pb, util.ProcessErr(err)
+	}
+
+	bucket, err := database.QueryBucketRow(conn, "SELECT * FROM buckets WHERE bucket_id = $1", bucketID)
+	if err != nil { return pb, util.ProcessErr(err) }
+	includes, err := replicaObjectFilter(conn, bucket, storageID)
+	if err != nil { return pb, util.ProcessErr(err) }
+	objects, err := database.QueryObjects(conn, "SELECT * FROM objects WHERE bucket_id = $1", bucketID)
+	if err != nil { return pb, util.ProcessErr(err) }
+
+	for _, o := range objects {
+		if includes(o.Name) { pb.Bytes += o.Size }
+	}
+
+	return
+}
+
+func (p *Plan) addReplica(conn database.DBConn, bucketID, storageID int64) (err error) {
+	pb, err := replicaCopy(conn, bucketID, storageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	p.ReplicasCreated = append(p.ReplicasCreated, pb)
+	p.BytesCopied += pb.Bytes
+
+	return
+}
+
+func (p *Plan) resyncReplica(conn database.DBConn, bucketID, storageID int64) (err error) {
+	pb, err := replicaCopy(conn, bucketID, storageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	p.ReplicasResynced = append(p.ReplicasResynced, pb)
+	p.BytesCopied += pb.Bytes
+
+	return
+}
+
+// Must be recorded before the replica's object locations are removed.
+func (p *Plan) deleteReplica(conn database.DBConn, bucketID, storageID int64, gracePeriod time.Duration) (err error) {
+	pb, err := plannedBucket(conn, bucketID, storageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	if rows, err := database.Query(conn, `SELECT COALESCE(sum(o.size), 0)::bigint FROM object_locations ol
+		JOIN objects o ON o.object_id = ol.object_id
+		WHERE o.bucket_id = $1 AND ol.storage_id = $2`, bucketID, storageID); err != nil {
+		return util.ProcessErr(err)
+	} else {
+		rows.Next(); err = rows.Scan(&pb.Bytes); rows.Close()
+		if err != nil { return util.ProcessErr(err) }
+	}
+
+	if gracePeriod > 0 {
+		deleteAfter := time.Now().Add(gracePeriod)
+		pb.DeleteAfter = &deleteAfter
+	} else {
+		p.BytesDestroyed += pb.Bytes
+	}
+	p.ReplicasDeleted = append(p.ReplicasDeleted, pb)
+
+	return
+}
+
+func (p *Plan) deleteMaster(conn database.DBConn, bucket database.BucketRecord) (err error) {
+	pb, err := plannedBucket(conn, bucket.BucketID, bucket.StorageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	objects, err := database.QueryObjects(conn, "SELECT * FROM objects WHERE bucket_id = $1", bucket.BucketID)
+	if err != nil { return util.ProcessErr(err) }
+	for _, o := range objects { pb.Bytes += o.Size }
+
+	p.MastersDeleted = append(p.MastersDeleted, pb)
+	p.BytesDestroyed += pb.Bytes
+
+	return
+}
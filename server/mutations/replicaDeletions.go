@@ -0,0 +1,123 @@
+package mutations
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// How long removed replicas keep their data, set by the
+// replica_deletion_grace_period global policy (in seconds). Zero deletes them
+// straight away.
+func replicaDeletionGracePeriod(conn database.DBConn) (gracePeriod time.Duration, err error) {
+	var seconds int
+	if err = database.GetGlobalPolicy(conn, "replica_deletion_grace_period", &seconds); err != nil {
+		return gracePeriod, util.ProcessErr(err)
+	}
+	if seconds < 0 { seconds = 0 }
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Leaves the replica's data in place until the grace period is over. Scheduling
+// it again does not push the deletion back.
+func scheduleReplicaDeletion(conn database.DBConn, bucket database.BucketRecord, storageID int64, gracePeriod time.Duration) (err error) {
+	_, err = database.Exec(conn, `INSERT INTO pending_replica_deletions (bucket_id, bucket_name, storage_id, delete_after)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+		ON CONFLICT (bucket_name, storage_id) DO NOTHING`, bucket.BucketID, bucket.Name, storageID, gracePeriod.Seconds())
+	return util.ProcessErr(err)
+}
+
+// Called when the bucket is stored on the storage deployment again, its data
+// must then be kept.
+func cancelReplicaDeletion(conn database.DBConn, bucketName string, storageID int64) (err error) {
+	_, err = database.Exec(conn, "DELETE FROM pending_replica_deletions WHERE bucket_name = $1 AND storage_id = $2", bucketName, storageID)
+	return util.ProcessErr(err)
+}
+
+// Deletes the data of a replica whose grace period is over, returning whether
+// it did. Deletions already being reaped elsewhere are left alone, as are those
+// whose bucket has since come back to the storage deployment.
+func ReapReplicaDeletion(conn database.DBConn, deletionID int64) (reaped bool, err error) {
+	pendingDeletions, err := database.QueryPendingReplicaDeletions(conn, "SELECT * FROM pending_replica_deletions WHERE deletion_id = $1 AND delete_after <= now() FOR UPDATE SKIP LOCKED", deletionID)
+	if err != nil { return reaped, util.ProcessErr(err) }
+	if len(pendingDeletions) == 0 { return }
+
+	return reapReplica(conn, pendingDeletions[0])
+}
+
+// Deletes the data of every replica pending deletion on the storage deployment
+// without waiting for their grace period, as the storage deployment is being
+// removed and its pending deletions with it.
+func reapStorageReplicaDeletions(conn database.DBConn, storageID int64) (err error) {
+	pendingDeletions, err := database.QueryPendingReplicaDeletions(conn, "SELECT * FROM pending_replica_deletions WHERE storage_id = $1 FOR UPDATE", storageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	for _, prd := range pendingDeletions {
+		if _, err = reapReplica(conn, prd); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+func reapReplica(conn database.DBConn, prd database.PendingReplicaDeletionRecord) (reaped bool, err error) {
+	if _, err = database.Exec(conn, "DELETE FROM pending_replica_deletions WHERE deletion_id = $1", prd.DeletionID); err != nil {
+		return reaped, util.ProcessErr(err)
+	}
+
+	var stored bool
+	if rows, err := database.Query(conn, `SELECT EXISTS (SELECT 1 FROM buckets b
+		WHERE b.name = $1 AND (b.storage_id = $2 OR EXISTS (SELECT 1 FROM replica_bucket_locations rbl
+			WHERE rbl.bucket_id = b.bucket_id AND rbl.storage_id = $2)))`, prd.BucketName, prd.StorageID); err != nil {
+		return reaped, util.ProcessErr(err)
+	} else {
+		rows.Next(); err = rows.Scan(&stored); rows.Close()
+		if err != nil { return reaped, util.ProcessErr(err) }
+	}
+	if stored { return }
+
+	if err = EnsureBucketDeletion(conn, prd.StorageID, prd.BucketName); err != nil {
+		return reaped, util.ProcessErr(err)
+	}
+
+	return true, nil
+}
+
+// Stops a pending deletion and puts the replica back. A replica the bucket
+// pins through replica_locations is pinned again; otherwise it is restored as
+// is and, like any other replica, may be moved when placement is next resolved.
+func RestoreReplica(conn database.DBConn, deletionID int64) (err error) {
+	prd, err := database.QueryPendingReplicaDeletionRow(conn, "SELECT * FROM pending_replica_deletions WHERE deletion_id = $1 FOR UPDATE", deletionID)
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = cancelReplicaDeletion(conn, prd.BucketName, prd.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	buckets, err := database.QueryBuckets(conn, "SELECT * FROM buckets WHERE bucket_id = $1 AND name = $2", prd.BucketID, prd.BucketName)
+	if err != nil { return util.ProcessErr(err) }
+	if len(buckets) == 0 {
+		return util.ProcessErr(fmt.Errorf("Bucket %v no longer exists, its replica cannot be restored.", prd.BucketName))
+	}
+	bucket := buckets[0]
+	if bucket.StorageID == prd.StorageID {
+		return util.ProcessErr(fmt.Errorf("Bucket %v now has its master on storage deployment %v.", bucket.Name, prd.StorageID))
+	}
+
+	var replicaLocations []int64
+	if _, err = database.GetBucketPolicy(conn, bucket, "replica_locations", &replicaLocations); err != nil {
+		return util.ProcessErr(err)
+	}
+	if len(replicaLocations) > 0 {
+		if err = database.SetBucketPolicy(conn, bucket, "replica_locations", util.AddInt(replicaLocations, prd.StorageID)); err != nil {
+			return util.ProcessErr(err)
+		}
+		return util.ProcessErr(ResolveBucketReplicas(conn, bucket))
+	}
+
+	return util.ProcessErr(AddReplicaBucket(conn, database.ReplicaBucketLocationRecord{BucketID: bucket.BucketID, StorageID: prd.StorageID}))
+}
@@ -0,0 +1,113 @@
+package mutations
+
+import (
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Outstanding replication work for a (bucket, destination) pair, derived from
+// the job queue. Expects the bucket and storage IDs as $1 and $2.
+const replicaBacklogQuery = `SELECT count(*) AS jobs, count(*) FILTER (WHERE j.object_name <> '') AS objects, COALESCE(sum(o.size), 0) AS bytes
+	FROM replication_jobs j
+	LEFT JOIN objects o ON o.bucket_id = j.bucket_id AND o.name = j.object_name
+	WHERE j.bucket_id = $1 AND j.dst_storage_id = $2 AND j.status IN ('pending', 'running')`
+
+// Records that changes await replication to the replica, creating its state
+// if needed. Replicas that were in sync become stale.
+func MarkReplicaStale(conn database.DBConn, bucketID, storageID int64) (err error) {
+	_, err = database.Exec(conn, `WITH backlog AS (` + replicaBacklogQuery + `)
+		INSERT INTO replica_sync_states (bucket_id, storage_id, status, objects_behind, bytes_behind)
+		SELECT $1::int, $2::int, $3::text, backlog.objects, backlog.bytes FROM backlog
+		ON CONFLICT (bucket_id, storage_id) DO UPDATE SET
+			status = CASE WHEN replica_sync_states.status = $4 THEN $3 ELSE replica_sync_states.status END,
+			objects_behind = EXCLUDED.objects_behind,
+			bytes_behind = EXCLUDED.bytes_behind,
+			out_of_sync_since = COALESCE(replica_sync_states.out_of_sync_since, now()),
+			updated_at = now()`,
+		bucketID, storageID, database.ReplicaStale, database.ReplicaInSync)
+	return util.ProcessErr(err)
+}
+
+// Records the exact backlog found by comparing the master and the replica.
+func SetReplicaBacklog(conn database.DBConn, bucketID, storageID int64, status string, objects, bytes int64) (err error) {
+	_, err = database.Exec(conn, `INSERT INTO replica_sync_states (bucket_id, storage_id, status, objects_behind, bytes_behind) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (bucket_id, storage_id) DO UPDATE SET
+			status = $3,
+			objects_behind = $4,
+			bytes_behind = $5,
+			out_of_sync_since = COALESCE(replica_sync_states.out_of_sync_since, now()),
+			updated_at = now()`,
+		bucketID, storageID, status, objects, bytes)
+	return util.ProcessErr(err)
+}
+
+// Failed replicas stay failed until a full sync succeeds.
+func MarkReplicaSyncing(conn database.DBConn, bucketID, storageID int64) (err error) {
+	_, err = database.Exec(conn, "UPDATE replica_sync_states SET status = $3, updated_at = now() WHERE bucket_id = $1 AND storage_id = $2 AND status <> $4",
+		bucketID, storageID, database.ReplicaSyncing, database.ReplicaFailed)
+	return util.ProcessErr(err)
+}
+
+// Re-derives the replica's state after replication work succeeded. It is in
+// sync once no work is left, unless it failed earlier and this was not a full
+// sync.
+func MarkReplicaSynced(conn database.DBConn, bucketID, storageID int64, fullSync bool) (err error) {
+	_, err = database.Exec(conn, "INSERT INTO replica_sync_states (bucket_id, storage_id) VALUES ($1, $2) ON CONFLICT (bucket_id, storage_id) DO NOTHING", bucketID, storageID)
+	if err != nil { return util.ProcessErr(err) }
+
+	_, err = database.Exec(conn, `WITH backlog AS (` + replicaBacklogQuery + `), next AS (
+			SELECT CASE WHEN rss.status = $4 AND NOT $3 THEN $4 WHEN backlog.jobs > 0 THEN $5 ELSE $6 END AS status, backlog.objects, backlog.bytes
+			FROM replica_sync_states rss, backlog
+			WHERE rss.bucket_id = $1 AND rss.storage_id = $2
+		)
+		UPDATE replica_sync_states rss SET
+			status = next.status,
+			objects_behind = next.objects,
+			bytes_behind = next.bytes,
+			last_sync_at = CASE WHEN next.status = $6 THEN now() ELSE rss.last_sync_at END,
+			out_of_sync_since = CASE WHEN next.status = $6 THEN NULL ELSE COALESCE(rss.out_of_sync_since, now()) END,
+			last_error = CASE WHEN next.status = $6 THEN '' ELSE rss.last_error END,
+			updated_at = now()
+		FROM next WHERE rss.bucket_id = $1 AND rss.storage_id = $2`,
+		bucketID, storageID, fullSync, database.ReplicaFailed, database.ReplicaStale, database.ReplicaInSync)
+	return util.ProcessErr(err)
+}
+
+// Records a replication error. Only errors that exhausted their retries mark
+// the replica as failed.
+func MarkReplicaFailed(conn database.DBConn, bucketID, storageID int64, replicationErr error, permanent bool) (err error) {
+	_, err = database.Exec(conn, "UPDATE replica_sync_states SET status = CASE WHEN $3 THEN $4 ELSE status END, last_error = $5, out_of_sync_since = COALESCE(out_of_sync_since, now()), updated_at = now() WHERE bucket_id = $1 AND storage_id = $2",
+		bucketID, storageID, permanent, database.ReplicaFailed, replicationErr.Error())
+	return util.ProcessErr(err)
+}
+
+func DeleteReplicaSyncState(conn database.DBConn, bucketID, storageID int64) (err error) {
+	_, err = database.Exec(conn, "DELETE FROM replica_sync_states WHERE bucket_id = $1 AND storage_id = $2", bucketID, storageID)
+	return util.ProcessErr(err)
+}
+
+// Compares the replica against its master without copying anything, records
+// the result, and queues a full sync if the replica has drifted.
+func VerifyReplica(conn database.DBConn, br database.BucketReplicationRecord) (err error) {
+	if planOf(conn) != nil { return }
+
+	bm, err := prepareBucketMirror(conn, br)
+	if err != nil { return util.ProcessErr(err) }
+
+	d, err := bm.diff()
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = SetReplicaObjectLocations(conn, br.BucketID, br.DstStorageID, d.InSync); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	if len(d.Copy) == 0 && len(d.Remove) == 0 {
+		return util.ProcessErr(MarkReplicaSynced(conn, br.BucketID, br.DstStorageID, true))
+	}
+
+	if err = EnqueueReplicationJob(conn, br.BucketID, br.DstStorageID, ""); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return util.ProcessErr(SetReplicaBacklog(conn, br.BucketID, br.DstStorageID, database.ReplicaStale, d.Objects(), d.Bytes()))
+}
@@ -0,0 +1,275 @@
+package mutations
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smithyworks/FaDO/cli"
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/storage"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// User metadata key under which the source ETag is recorded on replicated
+// objects, since multipart uploads produce a different ETag at the destination.
+const sourceETagMetadataKey = "Fado-Source-Etag"
+
+// Per destination storage deployment semaphores, bounding the number of object
+// transfers running concurrently against it across all bucket replications.
+var destinationSlots = make(map[int64]chan struct{})
+var destinationSlotsMutex sync.Mutex
+
+func acquireDestinationSlot(storageID int64) (release func()) {
+	destinationSlotsMutex.Lock()
+	slots, exists := destinationSlots[storageID]
+	if !exists {
+		slots = make(chan struct{}, cli.Input.ReplicationConcurrency)
+		destinationSlots[storageID] = slots
+	}
+	destinationSlotsMutex.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+type replicationEndpoint struct {
+	StorageDeployment database.StorageDeploymentRecord
+	Backend storage.Backend
+}
+
+type bucketMirror struct {
+	Replication database.BucketReplicationRecord
+	Src replicationEndpoint
+	Dst replicationEndpoint
+	// Whether an object belongs on the destination under the bucket's
+	// replication rules.
+	Includes func(key string) bool
+}
+
+type mirrorDiff struct {
+	Copy []storage.ObjectInfo
+	Remove []string
+	InSync []storage.ObjectInfo
+}
+
+func (d *mirrorDiff) Objects() int64 {
+	return int64(len(d.Copy) + len(d.Remove))
+}
+
+func (d *mirrorDiff) Bytes() (bytes int64) {
+	for _, o := range d.Copy { bytes += o.Size }
+	return
+}
+
+func trimETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
+
+func prepareBucketMirror(conn database.DBConn, br database.BucketReplicationRecord) (bm bucketMirror, err error) {
+	bm.Replication = br
+
+	if bm.Src.StorageDeployment, err = database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", br.SrcStorageID); err != nil {
+		return bm, util.ProcessErr(err)
+	}
+	if bm.Dst.StorageDeployment, err = database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", br.DstStorageID); err != nil {
+		return bm, util.ProcessErr(err)
+	}
+	if bm.Src.Backend, err = CreateStorageBackend(conn, bm.Src.StorageDeployment); err != nil {
+		return bm, util.ProcessErr(err)
+	}
+	if bm.Dst.Backend, err = CreateStorageBackend(conn, bm.Dst.StorageDeployment); err != nil {
+		return bm, util.ProcessErr(err)
+	}
+	if bm.Includes, err = replicaObjectFilter(conn, database.BucketRecord{BucketID: br.BucketID, StorageID: br.SrcStorageID, Name: br.BucketName}, br.DstStorageID); err != nil {
+		return bm, util.ProcessErr(err)
+	}
+
+	return
+}
+
+func listBucketObjects(backend storage.Backend, bucketName string) (objects map[string]storage.ObjectInfo, err error) {
+	objectInfos, err := backend.ListObjects(bucketName)
+	if err != nil { return objects, util.ProcessErr(err) }
+
+	objects = make(map[string]storage.ObjectInfo)
+	for _, o := range objectInfos { objects[o.Key] = o }
+	return
+}
+
+// Decides whether the destination copy of an object is current. Objects
+// whose ETags differ are stat'ed to compare against the recorded source ETag.
+func isObjectInSync(dst replicationEndpoint, bucketName string, srcObj, dstObj storage.ObjectInfo) bool {
+	if srcObj.Size != dstObj.Size { return false }
+	if srcObj.ETag == dstObj.ETag { return true }
+	if etag, ok := dstObj.UserMetadata[sourceETagMetadataKey]; ok { return etag == srcObj.ETag }
+
+	info, err := dst.Backend.StatObject(bucketName, dstObj.Key)
+	if err != nil { return false }
+	return info.UserMetadata[sourceETagMetadataKey] == srcObj.ETag
+}
+
+func (bm *bucketMirror) diff() (d mirrorDiff, err error) {
+	srcObjects, err := listBucketObjects(bm.Src.Backend, bm.Replication.BucketName)
+	if err != nil { return d, util.ProcessErr(err) }
+	// Objects left out by the replication rules are removed from the replica.
+	for key := range srcObjects {
+		if !bm.Includes(key) { delete(srcObjects, key) }
+	}
+	dstObjects, err := listBucketObjects(bm.Dst.Backend, bm.Replication.BucketName)
+	if err != nil { return d, util.ProcessErr(err) }
+
+	for key, srcObj := range srcObjects {
+		if dstObj, exists := dstObjects[key]; !exists || !isObjectInSync(bm.Dst, bm.Replication.BucketName, srcObj, dstObj) {
+			d.Copy = append(d.Copy, srcObj)
+		} else {
+			d.InSync = append(d.InSync, srcObj)
+		}
+	}
+	for key := range dstObjects {
+		if _, exists := srcObjects[key]; !exists {
+			d.Remove = append(d.Remove, key)
+		}
+	}
+
+	return
+}
+
+// Objects are streamed through FaDO. Buckets have the same name everywhere, so
+// a server-side copy within one server would copy each object onto itself.
+func (bm *bucketMirror) copyObject(srcObj storage.ObjectInfo) (err error) {
+	bucketName := bm.Replication.BucketName
+	opts := storage.PutOptions{
+		ContentType: srcObj.ContentType,
+		UserMetadata: map[string]string{sourceETagMetadataKey: srcObj.ETag},
+	}
+
+	reader, err := bm.Src.Backend.GetObject(bucketName, srcObj.Key)
+	if err != nil { return util.ProcessErr(err) }
+	defer reader.Close()
+
+	_, err = bm.Dst.Backend.PutObject(bucketName, srcObj.Key, reader, srcObj.Size, opts)
+	return util.ProcessErr(err)
+}
+
+func (bm *bucketMirror) removeObject(key string) (err error) {
+	err = bm.Dst.Backend.DeleteObject(bm.Replication.BucketName, key)
+	return util.ProcessErr(err)
+}
+
+// Brings a single object at the destination in line with the source, copying
+// it if it changed and removing it if it no longer exists at the source or no
+// longer belongs on the destination.
+func (bm *bucketMirror) syncObject(key string) (srcObj storage.ObjectInfo, removed bool, err error) {
+	bucketName := bm.Replication.BucketName
+
+	release := acquireDestinationSlot(bm.Replication.DstStorageID)
+	defer release()
+
+	if !bm.Includes(key) { return srcObj, true, util.ProcessErr(bm.removeObject(key)) }
+
+	srcObj, err = bm.Src.Backend.StatObject(bucketName, key)
+	if err == storage.ErrObjectNotFound {
+		return srcObj, true, util.ProcessErr(bm.removeObject(key))
+	} else if err != nil {
+		return srcObj, false, util.ProcessErr(err)
+	}
+
+	if dstObj, err := bm.Dst.Backend.StatObject(bucketName, key); err == nil && isObjectInSync(bm.Dst, bucketName, srcObj, dstObj) {
+		return srcObj, false, nil
+	}
+
+	return srcObj, false, util.ProcessErr(bm.copyObject(srcObj))
+}
+
+// Copies changed objects and removes deleted ones, running transfers in
+// parallel within the destination's concurrency limit. Returns the objects
+// that were copied successfully.
+func (bm *bucketMirror) apply(d mirrorDiff) (copied []storage.ObjectInfo, err error) {
+	d1 := time.Now()
+
+	var wg sync.WaitGroup
+	var errMutex sync.Mutex
+	var errs []string
+	// The slot is acquired before spawning, so at most the concurrency limit
+	// of goroutines exist per destination regardless of the bucket size.
+	transfer := func(f func() error) {
+		release := acquireDestinationSlot(bm.Replication.DstStorageID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer release()
+			if err := f(); err != nil {
+				errMutex.Lock()
+				errs = append(errs, err.Error())
+				errMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, o := range d.Copy {
+		obj := o
+		transfer(func() error {
+			if err := bm.copyObject(obj); err != nil { return err }
+			errMutex.Lock()
+			copied = append(copied, obj)
+			errMutex.Unlock()
+			return nil
+		})
+	}
+	for _, k := range d.Remove {
+		key := k
+		transfer(func() error { return bm.removeObject(key) })
+	}
+	wg.Wait()
+
+	log.Printf("INFO: Mirrored %v from %v to %v (%v copied, %v removed) in %v seconds.", bm.Replication.BucketName, bm.Replication.SrcStorageAlias, bm.Replication.DstStorageAlias, len(d.Copy), len(d.Remove), time.Since(d1).Seconds())
+
+	if len(errs) > 0 {
+		return copied, util.ProcessErr(fmt.Errorf("Mirroring %v to %v failed for %v object(s): %v", bm.Replication.BucketName, bm.Replication.DstStorageAlias, len(errs), strings.Join(errs, "; ")))
+	}
+
+	return
+}
+
+func MirrorBucket(conn database.DBConn, br database.BucketReplicationRecord) (err error) {
+	if planOf(conn) != nil { return }
+
+	bm, err := prepareBucketMirror(conn, br)
+	if err != nil { return util.ProcessErr(err) }
+
+	d, err := bm.diff()
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = SetReplicaBacklog(conn, br.BucketID, br.DstStorageID, database.ReplicaSyncing, d.Objects(), d.Bytes()); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	copied, err := bm.apply(d)
+
+	// Partially applied mirrors still tell which objects the replica holds.
+	if locErr := SetReplicaObjectLocations(conn, br.BucketID, br.DstStorageID, append(d.InSync, copied...)); locErr != nil {
+		util.PrintWarning(locErr)
+	}
+
+	return util.ProcessErr(err)
+}
+
+// Propagates the current state of a single object from the master bucket to
+// one replica.
+func ReplicateObjectTo(conn database.DBConn, br database.BucketReplicationRecord, key string) (err error) {
+	if planOf(conn) != nil { return }
+
+	bm, err := prepareBucketMirror(conn, br)
+	if err != nil { return util.ProcessErr(err) }
+
+	srcObj, removed, err := bm.syncObject(key)
+	if err != nil { return util.ProcessErr(err) }
+
+	if removed {
+		return util.ProcessErr(RemoveObjectLocation(conn, br.BucketID, br.DstStorageID, key))
+	}
+	return util.ProcessErr(RecordObjectLocation(conn, br.BucketID, br.DstStorageID, key, srcObj.ETag))
+}
@@ -0,0 +1,157 @@
+package mutations
+
+import (
+	"math"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Channel used to wake up replication workers, notified on commit.
+const ReplicationJobsChannel = "replication_jobs"
+
+const replicationBackoffBase = 5 * time.Second
+const replicationBackoffMax = 15 * time.Minute
+
+// How long a worker holds a job it claimed. Workers renew the lease while the
+// job runs, so only jobs whose worker is gone outlive it.
+const ReplicationJobLease = 2 * time.Minute
+
+// How long finished jobs are kept around for inspection.
+const replicationJobRetention = 7 * 24 * time.Hour
+
+// Queues the replication of an object, or the whole bucket if objectName is
+// empty, to a destination storage deployment. Nothing is queued if equivalent
+// work is already pending.
+func EnqueueReplicationJob(conn database.DBConn, bucketID, dstStorageID int64, objectName string) (err error) {
+	ct, err := database.Exec(conn, `INSERT INTO replication_jobs (bucket_id, dst_storage_id, object_name)
+		SELECT $1::int, $2::int, $3::text WHERE NOT EXISTS (
+			SELECT 1 FROM replication_jobs
+			WHERE bucket_id = $1 AND dst_storage_id = $2 AND status = $4 AND (object_name = $3 OR object_name = '')
+		)`, bucketID, dstStorageID, objectName, database.ReplicationJobPending)
+	if err != nil { return util.ProcessErr(err) }
+	if ct.RowsAffected() == 0 { return }
+
+	if err = MarkReplicaStale(conn, bucketID, dstStorageID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	// Delivered when the surrounding transaction commits.
+	_, err = database.Exec(conn, "SELECT pg_notify($1, '')", ReplicationJobsChannel)
+	return util.ProcessErr(err)
+}
+
+// Queues replication jobs towards every replica of the bucket.
+func EnqueueBucketReplicationJobs(conn database.DBConn, bucketName, objectName string) (err error) {
+	var bucketReplications []database.BucketReplicationRecord
+	if rows, err := database.Query(conn, "SELECT * FROM bucket_replications WHERE bucket_name = $1", bucketName); err != nil {
+		return util.ProcessErr(err)
+	} else {
+		if bucketReplications, err = database.ScanBucketReplicationRows(rows); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	for _, br := range bucketReplications {
+		if err = EnqueueReplicationJob(conn, br.BucketID, br.DstStorageID, objectName); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+// Atomically marks the next due job as running, leased to the caller. Jobs
+// whose lease expired are taken over. Concurrent workers skip rows locked by
+// one another, so a job is never claimed twice.
+func ClaimReplicationJob(conn database.DBConn) (job database.ReplicationJobRecord, claimed bool, err error) {
+	jobs, err := database.QueryReplicationJobs(conn, `UPDATE replication_jobs SET status = $1, attempts = attempts + 1, updated_at = now(), lease_expires_at = now() + make_interval(secs => $3)
+		WHERE job_id = (
+			SELECT job_id FROM replication_jobs
+			WHERE (status = $2 AND next_attempt_at <= now()) OR (status = $1 AND lease_expires_at <= now())
+			ORDER BY next_attempt_at, job_id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		) RETURNING *`, database.ReplicationJobRunning, database.ReplicationJobPending, ReplicationJobLease.Seconds())
+	if err != nil { return job, false, util.ProcessErr(err) }
+	if len(jobs) != 1 { return job, false, nil }
+
+	return jobs[0], true, nil
+}
+
+// Extends the lease on a running job, returning false once the job was taken
+// over by another worker.
+func RenewReplicationJobLease(conn database.DBConn, job database.ReplicationJobRecord) (held bool, err error) {
+	ct, err := database.Exec(conn, "UPDATE replication_jobs SET lease_expires_at = now() + make_interval(secs => $1) WHERE job_id = $2 AND status = $3 AND attempts = $4",
+		ReplicationJobLease.Seconds(), job.JobID, database.ReplicationJobRunning, job.Attempts)
+	if err != nil { return held, util.ProcessErr(err) }
+
+	return ct.RowsAffected() == 1, nil
+}
+
+// Jobs taken over by another worker are left to it.
+func CompleteReplicationJob(conn database.DBConn, job database.ReplicationJobRecord) (err error) {
+	ct, err := database.Exec(conn, "UPDATE replication_jobs SET status = $1, last_error = '', updated_at = now(), lease_expires_at = NULL WHERE job_id = $2 AND status = $3 AND attempts = $4",
+		database.ReplicationJobCompleted, job.JobID, database.ReplicationJobRunning, job.Attempts)
+	if err != nil { return util.ProcessErr(err) }
+	if ct.RowsAffected() == 0 { return }
+
+	return util.ProcessErr(MarkReplicaSynced(conn, job.BucketID, job.DstStorageID, job.ObjectName == ""))
+}
+
+// Schedules a retry with exponential backoff, or marks the job failed once it
+// has used up its attempts. Jobs taken over by another worker are left to it.
+func FailReplicationJob(conn database.DBConn, job database.ReplicationJobRecord, jobErr error) (err error) {
+	status := database.ReplicationJobPending
+	if job.Attempts >= job.MaxAttempts { status = database.ReplicationJobFailed }
+
+	backoff := time.Duration(float64(replicationBackoffBase) * math.Pow(2, float64(job.Attempts - 1)))
+	if backoff > replicationBackoffMax { backoff = replicationBackoffMax }
+
+	ct, err := database.Exec(conn, "UPDATE replication_jobs SET status = $1, last_error = $2, next_attempt_at = now() + make_interval(secs => $3), updated_at = now(), lease_expires_at = NULL WHERE job_id = $4 AND status = $5 AND attempts = $6",
+		status, jobErr.Error(), backoff.Seconds(), job.JobID, database.ReplicationJobRunning, job.Attempts)
+	if err != nil { return util.ProcessErr(err) }
+	if ct.RowsAffected() == 0 { return }
+
+	return util.ProcessErr(MarkReplicaFailed(conn, job.BucketID, job.DstStorageID, jobErr, status == database.ReplicationJobFailed))
+}
+
+// Requeues jobs whose worker is gone, e.g. with a previous server process. Jobs
+// still leased may be running on another FaDO instance and are left alone.
+func RecoverReplicationJobs(conn database.DBConn) (err error) {
+	_, err = database.Exec(conn, "UPDATE replication_jobs SET status = $1, updated_at = now(), lease_expires_at = NULL WHERE status = $2 AND lease_expires_at <= now()",
+		database.ReplicationJobPending, database.ReplicationJobRunning)
+	return util.ProcessErr(err)
+}
+
+func PruneReplicationJobs(conn database.DBConn) (err error) {
+	_, err = database.Exec(conn, "DELETE FROM replication_jobs WHERE status IN ($1, $2) AND updated_at < now() - make_interval(secs => $3)",
+		database.ReplicationJobCompleted, database.ReplicationJobFailed, replicationJobRetention.Seconds())
+	return util.ProcessErr(err)
+}
+
+// Performs the replication described by a job. Jobs whose replica has since
+// been removed have nothing left to do.
+func RunReplicationJob(conn database.DBConn, job database.ReplicationJobRecord) (err error) {
+	var bucketReplications []database.BucketReplicationRecord
+	if rows, err := database.Query(conn, "SELECT * FROM bucket_replications WHERE bucket_id = $1 AND dst_storage_id = $2", job.BucketID, job.DstStorageID); err != nil {
+		return util.ProcessErr(err)
+	} else {
+		if bucketReplications, err = database.ScanBucketReplicationRows(rows); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+	if len(bucketReplications) != 1 { return }
+
+	if job.ObjectName == "" {
+		err = MirrorBucket(conn, bucketReplications[0])
+	} else {
+		if err = MarkReplicaSyncing(conn, job.BucketID, job.DstStorageID); err != nil {
+			return util.ProcessErr(err)
+		}
+		err = ReplicateObjectTo(conn, bucketReplications[0], job.ObjectName)
+	}
+
+	return util.ProcessErr(err)
+}
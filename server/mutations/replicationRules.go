@@ -0,0 +1,82 @@
+package mutations
+
+import (
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+func SetBucketReplicationRules(conn database.DBConn, bucket database.BucketRecord, rules []database.ReplicationRule) (err error) {
+	if err = database.ValidateReplicationRules(rules); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	if len(rules) == 0 {
+		err = database.DeleteBucketPolicy(conn, bucket, "replication_rules")
+	} else {
+		err = database.SetBucketPolicy(conn, bucket, "replication_rules", rules)
+	}
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(ResolveBucketReplicas(conn, bucket))
+}
+
+// Stores which storage deployments each rule of the bucket replicates to,
+// returning the storage deployments whose rules changed.
+func setReplicaRuleLocations(conn database.DBConn, bucket database.BucketRecord, ruleLocations map[string][]int64) (changedStorageIDs []int64, err error) {
+	existing, err := database.QueryReplicaRuleLocations(conn, "SELECT * FROM replica_rule_locations WHERE bucket_id = $1", bucket.BucketID)
+	if err != nil { return changedStorageIDs, util.ProcessErr(err) }
+
+	before := make(map[int64][]string)
+	for _, rrl := range existing { before[rrl.StorageID] = append(before[rrl.StorageID], rrl.RuleKey) }
+	after := make(map[int64][]string)
+	for ruleKey, storageIDs := range ruleLocations {
+		for _, id := range storageIDs { after[id] = append(after[id], ruleKey) }
+	}
+
+	for id, ruleKeys := range after {
+		if !sameStrings(before[id], ruleKeys) { changedStorageIDs = append(changedStorageIDs, id) }
+	}
+	for id, ruleKeys := range before {
+		if _, exists := after[id]; !exists && len(ruleKeys) > 0 { changedStorageIDs = append(changedStorageIDs, id) }
+	}
+
+	if _, err = database.Exec(conn, "DELETE FROM replica_rule_locations WHERE bucket_id = $1", bucket.BucketID); err != nil {
+		return changedStorageIDs, util.ProcessErr(err)
+	}
+	for ruleKey, storageIDs := range ruleLocations {
+		if _, err = database.Exec(conn, "INSERT INTO replica_rule_locations (bucket_id, rule_key, storage_id) SELECT $1::int, $2::text, unnest($3::int[])", bucket.BucketID, ruleKey, storageIDs); err != nil {
+			return changedStorageIDs, util.ProcessErr(err)
+		}
+	}
+
+	return
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) { return false }
+	for _, s := range a {
+		if !util.HasString(b, s) { return false }
+	}
+	return true
+}
+
+// Decides which objects of the bucket belong on a replica, according to the
+// rule matching each object. Buckets that were never resolved replicate all of
+// their objects everywhere.
+func replicaObjectFilter(conn database.DBConn, bucket database.BucketRecord, storageID int64) (includes func(key string) bool, err error) {
+	var rules []database.ReplicationRule
+	if _, err = database.GetBucketPolicy(conn, bucket, "replication_rules", &rules); err != nil {
+		return nil, util.ProcessErr(err)
+	}
+
+	ruleLocations, err := database.QueryReplicaRuleLocations(conn, "SELECT * FROM replica_rule_locations WHERE bucket_id = $1", bucket.BucketID)
+	if err != nil { return nil, util.ProcessErr(err) }
+	if len(ruleLocations) == 0 { return func(key string) bool { return true }, nil }
+
+	ruleKeys := make(map[string]bool)
+	for _, rrl := range ruleLocations {
+		if rrl.StorageID == storageID { ruleKeys[rrl.RuleKey] = true }
+	}
+
+	return func(key string) bool { return ruleKeys[database.MatchReplicationRule(rules, key)] }, nil
+}
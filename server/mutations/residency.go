@@ -0,0 +1,103 @@
+package mutations
+
+import (
+	"fmt"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Returned when a bucket would be stored somewhere its residency policies
+// forbid: in one of the bucket's denied_zones, or as a replica in one of the
+// clusters listed in the global replication_denied_clusters policy.
+type ResidencyViolationError struct {
+	BucketName string
+	StorageAlias string
+	ClusterName string
+	Reason string
+}
+
+func (e *ResidencyViolationError) Error() string {
+	return fmt.Sprintf("Bucket %v may not be stored on storage deployment %v in cluster %v: %v.", e.BucketName, e.StorageAlias, e.ClusterName, e.Reason)
+}
+
+// Checks that the bucket may be replicated to the storage deployment.
+func CheckReplicaResidency(conn database.DBConn, bucket database.BucketRecord, storageID int64) (err error) {
+	return util.ProcessErr(checkResidency(conn, bucket, storageID, true))
+}
+
+// Checks that the bucket may be stored on the storage deployment at all, be it
+// as master or replica.
+func CheckBucketResidency(conn database.DBConn, bucket database.BucketRecord, storageID int64) (err error) {
+	return util.ProcessErr(checkResidency(conn, bucket, storageID, false))
+}
+
+func checkResidency(conn database.DBConn, bucket database.BucketRecord, storageID int64, replica bool) (err error) {
+	sd, err := database.QueryStorageDeploymentRow(conn, "SELECT * FROM storage_deployments WHERE storage_id = $1", storageID)
+	if err != nil { return util.ProcessErr(err) }
+	cluster, err := database.QueryClusterRow(conn, "SELECT * FROM clusters WHERE cluster_id = $1", sd.ClusterID)
+	if err != nil { return util.ProcessErr(err) }
+
+	reason, err := residencyViolation(conn, bucket, cluster, replica)
+	if err != nil { return util.ProcessErr(err) }
+	if reason == "" { return }
+
+	return util.ProcessErr(&ResidencyViolationError{BucketName: bucket.Name, StorageAlias: sd.Alias, ClusterName: cluster.Name, Reason: reason})
+}
+
+// Describes why the bucket may not be stored in the cluster, or returns an
+// empty string if it may.
+func residencyViolation(conn database.DBConn, bucket database.BucketRecord, cluster database.ClusterRecord, replica bool) (reason string, err error) {
+	if replica {
+		var deniedClusters []string
+		if err = database.GetGlobalPolicy(conn, "replication_denied_clusters", &deniedClusters); err != nil {
+			return reason, util.ProcessErr(err)
+		}
+		if util.HasString(deniedClusters, cluster.Name) {
+			return "the cluster does not accept replicas", nil
+		}
+	}
+
+	var deniedZones, clusterZones []string
+	if _, err = database.GetBucketPolicy(conn, bucket, "denied_zones", &deniedZones); err != nil {
+		return reason, util.ProcessErr(err)
+	}
+	if _, err = database.GetClusterPolicy(conn, cluster, "zones", &clusterZones); err != nil {
+		return reason, util.ProcessErr(err)
+	}
+	for _, z := range clusterZones {
+		if util.HasString(deniedZones, z) {
+			return fmt.Sprintf("zone %v is denied for the bucket", z), nil
+		}
+	}
+
+	return
+}
+
+// Denies zones to the bucket. Rejected if the bucket's master lies in one of
+// them; replicas in them are moved elsewhere.
+func SetBucketDeniedZones(conn database.DBConn, bucket database.BucketRecord, zones []string) (err error) {
+	if len(zones) == 0 {
+		err = database.DeleteBucketPolicy(conn, bucket, "denied_zones")
+	} else {
+		err = database.SetBucketPolicy(conn, bucket, "denied_zones", zones)
+	}
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = CheckBucketResidency(conn, bucket, bucket.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return util.ProcessErr(ResolveBucketReplicas(conn, bucket))
+}
+
+// Forbids replicating into the named clusters. Replicas already there are
+// moved elsewhere.
+func SetReplicationDeniedClusters(conn database.DBConn, clusterNames []string) (err error) {
+	if clusterNames == nil { clusterNames = []string{} }
+	if err = database.SetGlobalPolicy(conn, "replication_denied_clusters", clusterNames); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return util.ProcessErr(ResolveAllBucketReplicas(conn))
+}
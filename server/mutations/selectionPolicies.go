@@ -0,0 +1,206 @@
+package mutations
+
+import (
+	"fmt"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type SelectionPolicyParameter struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Required bool `json:"required"`
+	Description string `json:"description"`
+}
+
+// A selection policy routes can be load balanced with, and the Caddy policy it
+// is configured as.
+type SelectionPolicy struct {
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Parameters []SelectionPolicyParameter `json:"parameters"`
+	caddyPolicy string
+}
+
+// The selection policies the load balancer supports, any other is rejected
+// rather than passed on to Caddy.
+var SelectionPolicies = []SelectionPolicy{
+	{
+		Name: "round_robin",
+		Description: "Each upstream in turn.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "round_robin",
+	},
+	{
+		Name: "random",
+		Description: "An upstream at random.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "random",
+	},
+	{
+		Name: "least_conn",
+		Description: "The upstream with the fewest requests in flight, ties broken at random.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "least_conn",
+	},
+	{
+		Name: "first",
+		Description: "The first available upstream, the others only take over when it is down.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "first",
+	},
+	{
+		Name: "ip_hash",
+		Description: "An upstream picked by hashing the client IP, so each client sticks to one.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "ip_hash",
+	},
+	{
+		Name: "uri_hash",
+		Description: "An upstream picked by hashing the request URI.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "uri_hash",
+	},
+	{
+		Name: "header",
+		Description: "An upstream picked by hashing a request header, at random when the request lacks it.",
+		Parameters: []SelectionPolicyParameter{
+			{Name: "field", Type: "string", Required: true, Description: "Name of the request header to hash."},
+		},
+		caddyPolicy: "header",
+	},
+	{
+		Name: "cookie",
+		Description: "Sticky sessions: the upstream is picked at random, then remembered in a cookie.",
+		Parameters: []SelectionPolicyParameter{
+			{Name: "name", Type: "string", Description: "Name of the cookie, lb by default."},
+			{Name: "secret", Type: "string", Description: "Secret the cookie value is signed with."},
+		},
+		caddyPolicy: "cookie",
+	},
+	{
+		Name: database.WeightedPolicy,
+		Description: "Each upstream in turn, as many times as its weight.",
+		Parameters: []SelectionPolicyParameter{
+			{Name: "weights", Type: "object", Required: true, Description: "Weight of each upstream URL, those left out weigh 1 and those weighing 0 are not used."},
+		},
+		caddyPolicy: "weighted_round_robin",
+	},
+	{
+		Name: database.LatencyPolicy,
+		Description: "Each upstream in turn, weighted by FaDO from the latency and error rate measured for each FaaS deployment. Those not weighed yet weigh lb_latency_max_weight.",
+		Parameters: []SelectionPolicyParameter{},
+		caddyPolicy: "weighted_round_robin",
+	},
+}
+
+func selectionPolicyNamed(name string) (sp SelectionPolicy, exists bool) {
+	for _, sp = range SelectionPolicies {
+		if sp.Name == name { return sp, true }
+	}
+	return sp, false
+}
+
+func (sp SelectionPolicy) parameter(name string) (exists bool) {
+	for _, p := range sp.Parameters {
+		if p.Name == name { return true }
+	}
+	return false
+}
+
+func selectionPolicyParamNames(params *database.SelectionPolicyParams) (names []string) {
+	if params == nil { return }
+	if params.Field != "" { names = append(names, "field") }
+	if params.Name != "" { names = append(names, "name") }
+	if params.Secret != "" { names = append(names, "secret") }
+	if params.Weights != nil { names = append(names, "weights") }
+	return
+}
+
+// Checks the policy is in the catalog, and that it is given the parameters it
+// requires and no other.
+func ValidateSelectionPolicy(name string, params *database.SelectionPolicyParams) (err error) {
+	sp, exists := selectionPolicyNamed(name)
+	if !exists { return util.ProcessErr(fmt.Errorf("Unknown selection policy '%v'.", name)) }
+
+	given := selectionPolicyParamNames(params)
+	for _, p := range given {
+		if !sp.parameter(p) { return util.ProcessErr(fmt.Errorf("Selection policy %v takes no parameter %v.", name, p)) }
+	}
+	for _, p := range sp.Parameters {
+		if p.Required && !util.HasString(given, p.Name) {
+			return util.ProcessErr(fmt.Errorf("Selection policy %v requires parameter %v.", name, p.Name))
+		}
+	}
+
+	if params != nil {
+		for url, w := range params.Weights {
+			if w < 0 { return util.ProcessErr(fmt.Errorf("Expected a weight of at least 0 for %v, got %v.", url, w)) }
+		}
+	}
+
+	return
+}
+
+// Overrides without a policy only pick the upstreams, and are load balanced
+// with the global selection policy.
+func ValidateRouteOverride(rs database.LoadBalancerRouteSettings) (err error) {
+	if rs.Policy == "" {
+		if len(selectionPolicyParamNames(rs.PolicyParams)) > 0 {
+			return util.ProcessErr(fmt.Errorf("Selection policy parameters given without a selection policy."))
+		}
+		return
+	}
+	return util.ProcessErr(ValidateSelectionPolicy(rs.Policy, rs.PolicyParams))
+}
+
+// Weight of the upstreams the weights of a route leave out.
+const DefaultUpstreamWeight = 1
+
+// Weight of an upstream under one of the weighted policies. The load balancer
+// and the gateway both weigh upstreams this way, so they split traffic alike.
+func UpstreamWeight(weights map[string]int, upstream string) int {
+	if w, exists := weights[upstream]; exists { return w }
+	return DefaultUpstreamWeight
+}
+
+// Weights of the upstreams of a route under one of the weighted policies, nil
+// under the others.
+func routeWeights(policy string, params *database.SelectionPolicyParams, upstreams []string, lw latencyWeights) (weights map[string]int) {
+	switch policy {
+	case database.LatencyPolicy:
+		return lw.of(upstreams)
+	case database.WeightedPolicy:
+		var given map[string]int
+		if params != nil { given = params.Weights }
+		weights = make(map[string]int)
+		for _, u := range upstreams {
+			if u != "" { weights[u] = UpstreamWeight(given, u) }
+		}
+	}
+	return
+}
+
+// Weights of the upstreams of an object routed apart from its bucket, like the
+// load balancer's object routes are weighed.
+func ObjectRouteWeights(conn database.DBConn, rs database.LoadBalancerRouteSettings, upstreams []string) (weights map[string]int, err error) {
+	lw, err := resolveLatencyWeights(conn)
+	if err != nil { return weights, util.ProcessErr(err) }
+
+	return routeWeights(rs.Policy, rs.PolicyParams, upstreams, lw), nil
+}
+
+// Configures the policy on Caddy. Weights are listed in the same order as the
+// upstreams they are for.
+func selectionPolicyConfig(policy string, params *database.SelectionPolicyParams, upstreams []database.UpstreamConfig, weights map[string]int) database.SelectionPolicyConfig {
+	spc := database.SelectionPolicyConfig{Policy: policy}
+	if sp, exists := selectionPolicyNamed(policy); exists { spc.Policy = sp.caddyPolicy }
+	if params != nil { spc.Field, spc.Name, spc.Secret = params.Field, params.Name, params.Secret }
+
+	if spc.Policy == "weighted_round_robin" {
+		for _, u := range upstreams { spc.Weights = append(spc.Weights, UpstreamWeight(weights, u.Dial)) }
+	}
+
+	return spc
+}
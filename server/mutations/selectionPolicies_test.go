@@ -0,0 +1,103 @@
+package mutations
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/smithyworks/FaDO/database"
+)
+
+func TestValidateSelectionPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		policy string
+		params *database.SelectionPolicyParams
+		valid bool
+	}{
+		{"no parameters", "round_robin", nil, true},
+		{"empty parameters", "least_conn", &database.SelectionPolicyParams{}, true},
+		{"unknown policy", "fastest", nil, false},
+		{"empty policy", "", nil, false},
+		{"unexpected parameter", "random", &database.SelectionPolicyParams{Field: "X-User"}, false},
+		{"required parameter", "header", &database.SelectionPolicyParams{Field: "X-User"}, true},
+		{"missing required parameter", "header", nil, false},
+		{"optional parameters", "cookie", &database.SelectionPolicyParams{Name: "sticky", Secret: "s3cr3t"}, true},
+		{"optional parameters left out", "cookie", nil, true},
+		{"weights", database.WeightedPolicy, &database.SelectionPolicyParams{Weights: map[string]int{"faas-1:8080": 3, "faas-2:8080": 0}}, true},
+		{"negative weight", database.WeightedPolicy, &database.SelectionPolicyParams{Weights: map[string]int{"faas-1:8080": -1}}, false},
+		{"weights on the latency policy", database.LatencyPolicy, &database.SelectionPolicyParams{Weights: map[string]int{"faas-1:8080": 3}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSelectionPolicy(tt.policy, tt.params)
+			if (err == nil) != tt.valid { t.Errorf("ValidateSelectionPolicy(%q) = %v, want valid %v", tt.policy, err, tt.valid) }
+		})
+	}
+}
+
+func TestValidateRouteOverride(t *testing.T) {
+	tests := []struct {
+		name string
+		rs database.LoadBalancerRouteSettings
+		valid bool
+	}{
+		{"upstreams only", database.LoadBalancerRouteSettings{Upstreams: []string{"faas-1:8080"}}, true},
+		{"parameters without a policy", database.LoadBalancerRouteSettings{PolicyParams: &database.SelectionPolicyParams{Field: "X-User"}}, false},
+		{"empty parameters without a policy", database.LoadBalancerRouteSettings{PolicyParams: &database.SelectionPolicyParams{}}, true},
+		{"policy", database.LoadBalancerRouteSettings{Policy: "first"}, true},
+		{"invalid policy", database.LoadBalancerRouteSettings{Policy: "header"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRouteOverride(tt.rs)
+			if (err == nil) != tt.valid { t.Errorf("ValidateRouteOverride = %v, want valid %v", err, tt.valid) }
+		})
+	}
+}
+
+func TestRouteWeights(t *testing.T) {
+	lw := latencyWeights{fallback: 10, byURL: map[string]int{"faas-1:8080": 4, "faas-2:8080": 1}}
+
+	tests := []struct {
+		name string
+		policy string
+		params *database.SelectionPolicyParams
+		upstreams []string
+		want map[string]int
+	}{
+		{"unweighted policy", "round_robin", nil, []string{"faas-1:8080"}, nil},
+		{"latency", database.LatencyPolicy, nil, []string{"faas-1:8080", "faas-2:8080"}, map[string]int{"faas-1:8080": 4, "faas-2:8080": 1}},
+		{"latency of an unweighed deployment", database.LatencyPolicy, nil, []string{"faas-1:8080", "faas-3:8080"}, map[string]int{"faas-1:8080": 4, "faas-3:8080": 10}},
+		{"weighted", database.WeightedPolicy, &database.SelectionPolicyParams{Weights: map[string]int{"faas-1:8080": 3, "faas-2:8080": 0}}, []string{"faas-1:8080", "faas-2:8080"}, map[string]int{"faas-1:8080": 3, "faas-2:8080": 0}},
+		{"weighted, left out weighs 1", database.WeightedPolicy, &database.SelectionPolicyParams{Weights: map[string]int{"faas-1:8080": 3}}, []string{"faas-1:8080", "faas-3:8080"}, map[string]int{"faas-1:8080": 3, "faas-3:8080": 1}},
+		{"weighted without parameters", database.WeightedPolicy, nil, []string{"faas-1:8080"}, map[string]int{"faas-1:8080": 1}},
+		{"weights of other upstreams ignored", database.WeightedPolicy, &database.SelectionPolicyParams{Weights: map[string]int{"faas-9:8080": 3}}, []string{"faas-1:8080"}, map[string]int{"faas-1:8080": 1}},
+		{"empty upstreams skipped", database.WeightedPolicy, nil, []string{"", "faas-1:8080"}, map[string]int{"faas-1:8080": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := routeWeights(tt.policy, tt.params, tt.upstreams, lw)
+			if !reflect.DeepEqual(got, tt.want) { t.Errorf("routeWeights = %v, want %v", got, tt.want) }
+		})
+	}
+}
+
+func TestSelectionPolicyConfigWeights(t *testing.T) {
+	upstreams := []database.UpstreamConfig{{Dial: "faas-1:8080"}, {Dial: "faas-2:8080"}}
+
+	tests := []struct {
+		name string
+		weights map[string]int
+		want []int
+	}{
+		{"in upstream order", map[string]int{"faas-2:8080": 0, "faas-1:8080": 3}, []int{3, 0}},
+		{"left out weighs 1", map[string]int{"faas-1:8080": 3}, []int{3, 1}},
+		{"no weights", nil, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spc := selectionPolicyConfig(database.WeightedPolicy, nil, upstreams, tt.weights)
+			if !reflect.DeepEqual(spc.Weights, tt.want) { t.Errorf("selectionPolicyConfig weights = %v, want %v", spc.Weights, tt.want) }
+		})
+	}
+}
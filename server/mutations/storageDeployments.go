@@ -1,13 +1,11 @@
 package mutations
 
 import (
-	"log"
-	"strings"
-	"time"
+	"errors"
+	"fmt"
 
-	"github.com/minio/madmin-go"
 	"github.com/smithyworks/FaDO/database"
-	"github.com/smithyworks/FaDO/mc"
+	"github.com/smithyworks/FaDO/storage"
 	"github.com/smithyworks/FaDO/util"
 )
 
@@ -20,7 +18,9 @@ func AddStorageDeployment(conn database.DBConn, storageDeployment database.Stora
 		shouldUpdate = true
 	}
 
-	// get info from MinIO
+	if storageDeployment.Kind == "" { storageDeployment.Kind = storage.KindMinio }
+
+	// get info from the storage backend
 	if err = GetStorageDeploymentInfo(conn, &storageDeployment); err != nil {
 		return util.ProcessErr(err)
 	}
@@ -44,21 +44,43 @@ func AddStorageDeployment(conn database.DBConn, storageDeployment database.Stora
 		for _, b := range buckets { bucketMap[b.Name] = b }
 	}
 
-	// Scan buckets from new deployments
-	if client, err := CreateMinioClient(conn, storageDeployment); err != nil {
+	// Scan buckets from new deployments. Planned deployments are not
+	// contacted, so the buckets they would adopt are not part of the plan.
+	if planOf(conn) != nil { return }
+
+	// Replicas waiting out their grace period are still in storage, but must
+	// not be adopted again. Only restoring them or placing a replica there
+	// cancels their deletion.
+	pendingDeletions, err := database.QueryPendingReplicaDeletions(conn, "SELECT * FROM pending_replica_deletions WHERE storage_id = $1", storageDeployment.StorageID)
+	if err != nil { return util.ProcessErr(err) }
+	pendingBucketNames := make(map[string]bool)
+	for _, prd := range pendingDeletions { pendingBucketNames[prd.BucketName] = true }
+
+	if backend, err := CreateStorageBackend(conn, storageDeployment); err != nil {
 		return util.ProcessErr(err)
 	} else {
-		if minioBuckets, err := client.ListBuckets(ctx); err != nil {
+		if bucketNames, err := backend.ListBuckets(); err != nil {
 			return util.ProcessErr(err)
 		} else {
-			for _, mb := range minioBuckets {
+			for _, bucketName := range bucketNames {
+				if pendingBucketNames[bucketName] { continue }
+
 				// AddMastBucket / AddReplicaBucket
-				if br, exists := bucketMap[mb.Name]; exists && br.StorageID != storageDeployment.StorageID {
+				if br, exists := bucketMap[bucketName]; exists && br.StorageID != storageDeployment.StorageID {
+					// Copies of buckets found where they may not be replicated are left alone.
+					var violation *ResidencyViolationError
+					if err = CheckReplicaResidency(conn, br, storageDeployment.StorageID); errors.As(err, &violation) {
+						util.PrintWarning(fmt.Errorf("Not adopting bucket %v: %w", bucketName, violation))
+						continue
+					} else if err != nil {
+						return util.ProcessErr(err)
+					}
+
 					if err = AddReplicaBucket(conn, database.ReplicaBucketLocationRecord{BucketID: br.BucketID, StorageID: storageDeployment.StorageID}); err != nil {
 						return util.ProcessErr(err)
 					}
 				} else if !exists {
-					if err = AddMasterBucket(conn, database.BucketRecord{StorageID: storageDeployment.StorageID, Name: mb.Name}, 0, []string{}, []int64{}); err != nil {
+					if err = AddMasterBucket(conn, database.BucketRecord{StorageID: storageDeployment.StorageID, Name: bucketName}, 0, []string{}, []int64{}); err != nil {
 						return util.ProcessErr(err)
 					}
 				}
@@ -69,6 +91,23 @@ func AddStorageDeployment(conn database.DBConn, storageDeployment database.Stora
 	return
 }
 
+// Updates how the storage deployment is reached and which cluster it belongs
+// to, then registers with it again.
+func EditStorageDeployment(conn database.DBConn, storageDeployment database.StorageDeploymentRecord) (err error) {
+	if storageDeployment.Kind == "" { storageDeployment.Kind = storage.KindMinio }
+
+	if _, err = database.Exec(conn, "UPDATE storage_deployments SET cluster_id = $1, alias = $2, endpoint = $3, access_key = $4, secret_key = $5, use_ssl = $6, management_url = $7, kind = $8 WHERE storage_id = $9",
+		storageDeployment.ClusterID, storageDeployment.Alias, storageDeployment.Endpoint, storageDeployment.AccessKey, storageDeployment.SecretKey, storageDeployment.UseSSL, storageDeployment.ManagementURL, storageDeployment.Kind, storageDeployment.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	if err = AddStorageDeployment(conn, storageDeployment); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return util.ProcessErr(ResolveAllBucketReplicas(conn))
+}
+
 func DeleteStorageDeployment(conn database.DBConn, storageDeployement database.StorageDeploymentRecord, permanent bool) (err error) {
 	// Delete Master Buckets and replicas if permanent.
 	if permanent {
@@ -76,6 +115,11 @@ func DeleteStorageDeployment(conn database.DBConn, storageDeployement database.S
 			return util.ProcessErr(err)
 		} else {
 			for _, b := range masterBuckets {
+				if plan := planOf(conn); plan != nil {
+					if err = plan.deleteMaster(conn, b); err != nil {
+						return util.ProcessErr(err)
+					}
+				}
 				if err = EnsureBucketDeletion(conn, storageDeployement.StorageID, b.Name); err != nil {
 					util.PrintWarning(err)
 					err = nil
@@ -99,7 +143,11 @@ func DeleteStorageDeployment(conn database.DBConn, storageDeployement database.S
 		}
 	}
 	
-	// Delete Replica Buckets.
+	// Delete Replica Buckets. Their data goes with the storage deployment, as
+	// do pending deletions, so none is kept for a grace period.
+	if err = reapStorageReplicaDeletions(conn, storageDeployement.StorageID); err != nil {
+		return util.ProcessErr(err)
+	}
 	var bucketIdsToResolve []int64
 	if rows, err := database.Query(conn, "SELECT * FROM replica_bucket_locations WHERE storage_id = $1", storageDeployement.StorageID); err != nil {
 		return util.ProcessErr(err)
@@ -109,7 +157,7 @@ func DeleteStorageDeployment(conn database.DBConn, storageDeployement database.S
 		} else {
 			for _, bs := range bucketStorageRecords {
 				bucketIdsToResolve = append(bucketIdsToResolve, bs.BucketID)
-				if err = DeleteReplicaBucket(conn, bs); err != nil {
+				if err = deleteReplicaBucket(conn, bs, 0); err != nil {
 					return util.ProcessErr(err)
 				}
 			}
@@ -135,43 +183,17 @@ func DeleteStorageDeployment(conn database.DBConn, storageDeployement database.S
 	return
 }
 
+// Registers FaDO with the storage deployment, filling in its identity and
+// notification details.
 func GetStorageDeploymentInfo(conn database.DBConn, sd *database.StorageDeploymentRecord) (err error) {
-	if err = mc.SetAlias(*sd); err != nil {
-		return util.ProcessErr(err)
+	// Planned deployments are not registered, they stand in for themselves.
+	if planOf(conn) != nil {
+		if sd.MinioDeploymentID == "" { sd.MinioDeploymentID = fmt.Sprintf("planned:%v", sd.Endpoint) }
+		return
 	}
 
-	if adminClient, err := CreateMinioAdminClient(conn, sd); err != nil {
-		return util.ProcessErr(err)
-	} else {
-		if err = mc.SetNotificationTarget(*sd); err != nil {
-			return util.ProcessErr(err)
-		}
-
-		if err = adminClient.ServiceRestart(ctx); err != nil {
-			return util.ProcessErr(err)
-		}
-
-		d1 := time.Now()
-		log.Printf("INFO: Restarting minio deployment %v.", sd.Alias)
-		var info madmin.InfoMessage
-		for i := 0; i < 3; i++ {
-			time.Sleep(5 * time.Second)
-			if info, err = adminClient.ServerInfo(ctx); err == nil {
-				break
-			}
-		}
-		if err != nil { return util.ProcessErr(err) }
-		d2 := time.Since(d1)
-		log.Printf("INFO: Service restarted after %v seconds.", d2.Seconds())
-
-		sd.MinioDeploymentID = info.DeploymentID
-		for _, val := range info.SQSARN {
-			if strings.HasSuffix(val, "fado:webhook") {
-				sd.SqsArn = val
-				break
-			}
-		}
-	}
+	backend, err := CreateStorageBackend(conn, sd)
+	if err != nil { return util.ProcessErr(err) }
 
-	return util.ProcessErr(err)
+	return util.ProcessErr(backend.Register(sd))
 }
@@ -0,0 +1,84 @@
+package mutations
+
+import (
+	"log"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+type StorageProbeSettings struct {
+	Interval time.Duration
+	FailureThreshold int
+	SuccessThreshold int
+}
+
+func ResolveStorageProbeSettings(conn database.DBConn) (settings StorageProbeSettings, err error) {
+	var interval float64
+	if err = database.GetGlobalPolicy(conn, "storage_health_interval", &interval); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	if err = database.GetGlobalPolicy(conn, "storage_health_failure_threshold", &settings.FailureThreshold); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	if err = database.GetGlobalPolicy(conn, "storage_health_success_threshold", &settings.SuccessThreshold); err != nil {
+		return settings, util.ProcessErr(err)
+	}
+	settings.Interval = time.Duration(interval * float64(time.Second))
+
+	return
+}
+
+type StorageProbeResult struct {
+	Latency time.Duration
+	Err error
+}
+
+// Uses the backend's own health check, i.e. MinIO's liveness endpoint.
+func ProbeStorageDeployment(sd database.StorageDeploymentRecord) (result StorageProbeResult) {
+	backend, err := CreateStorageBackend(nil, sd)
+	if err != nil { result.Err = err; return }
+
+	start := time.Now()
+	result.Err = backend.Health()
+	result.Latency = time.Since(start)
+
+	return
+}
+
+// Records the probe and returns the status of the deployment before and after.
+// Master buckets are failed over when it becomes unhealthy, and fail back
+// once it recovered.
+func RecordStorageHealthCheck(conn database.DBConn, sd database.StorageDeploymentRecord, settings StorageProbeSettings, result StorageProbeResult) (previous, status string, err error) {
+	errMsg := ""
+	if result.Err != nil { errMsg = result.Err.Error() }
+	latencyMs := float64(result.Latency) / float64(time.Millisecond)
+
+	_, err = database.Exec(conn, "INSERT INTO storage_health_states (storage_id) VALUES ($1) ON CONFLICT (storage_id) DO NOTHING", sd.StorageID)
+	if err != nil { return previous, status, util.ProcessErr(err) }
+	state, err := database.QueryStorageHealthStateRow(conn, "SELECT * FROM storage_health_states WHERE storage_id = $1 FOR UPDATE", sd.StorageID)
+	if err != nil { return previous, status, util.ProcessErr(err) }
+
+	previous = state.Status
+	status = nextHealthStatus(state.Status, result.Err == nil, &state.ConsecutiveSuccesses, &state.ConsecutiveFailures, settings.SuccessThreshold, settings.FailureThreshold)
+	if status == database.HealthHealthy && previous == database.HealthUnhealthy {
+		log.Printf("INFO: Storage deployment %v is healthy again after %v successful health checks.", sd.Alias, state.ConsecutiveSuccesses)
+	} else if status == database.HealthUnhealthy && previous != database.HealthUnhealthy {
+		log.Printf("INFO: Storage deployment %v failed %v health checks in a row: %v", sd.Alias, state.ConsecutiveFailures, errMsg)
+	}
+
+	_, err = database.Exec(conn, `UPDATE storage_health_states SET
+			status = $2,
+			consecutive_successes = $3,
+			consecutive_failures = $4,
+			last_checked_at = now(),
+			last_latency_ms = $5,
+			last_error = $6,
+			updated_at = now()
+		WHERE storage_id = $1`,
+		sd.StorageID, status, state.ConsecutiveSuccesses, state.ConsecutiveFailures, latencyMs, errMsg)
+	if err != nil { return previous, status, util.ProcessErr(err) }
+
+	return
+}
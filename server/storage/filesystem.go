@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Directory under the root holding object metadata, mirroring the bucket
+// layout. It is never listed as a bucket.
+const filesystemMetadataDir = ".fado"
+const filesystemTempPrefix = ".fado-tmp-"
+
+// Stores each bucket as a directory under the root given as the deployment's
+// endpoint and each object as a file, with its metadata kept alongside.
+type filesystemBackend struct {
+	sd database.StorageDeploymentRecord
+	root string
+}
+
+type filesystemObjectMetadata struct {
+	ETag string `json:"etag"`
+	Size int64 `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	ContentType string `json:"content_type"`
+	UserMetadata map[string]string `json:"user_metadata"`
+}
+
+func newFilesystemBackend(sd database.StorageDeploymentRecord) (b *filesystemBackend, err error) {
+	root, err := filepath.Abs(sd.Endpoint)
+	if err != nil { return nil, util.ProcessErr(err) }
+
+	return &filesystemBackend{sd: sd, root: root}, nil
+}
+
+func (b *filesystemBackend) bucketPath(bucketName string) (string, error) {
+	if bucketName == "" || strings.HasPrefix(bucketName, ".") || strings.ContainsAny(bucketName, "/\\") {
+		return "", util.ProcessErr(fmt.Errorf("Invalid bucket name '%v'.", bucketName))
+	}
+	return filepath.Join(b.root, bucketName), nil
+}
+
+// Resolves the paths of an object and its metadata, refusing keys that would
+// escape the bucket directory.
+func (b *filesystemBackend) objectPaths(bucketName, key string) (objectPath, metadataPath string, err error) {
+	bucketPath, err := b.bucketPath(bucketName)
+	if err != nil { return objectPath, metadataPath, util.ProcessErr(err) }
+
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".." + string(filepath.Separator)) || strings.HasPrefix(filepath.Base(clean), filesystemTempPrefix) {
+		return objectPath, metadataPath, util.ProcessErr(fmt.Errorf("Invalid object key '%v'.", key))
+	}
+
+	return filepath.Join(bucketPath, clean), filepath.Join(b.root, filesystemMetadataDir, bucketName, clean + ".json"), nil
+}
+
+func (b *filesystemBackend) Register(sd *database.StorageDeploymentRecord) (err error) {
+	if err = os.MkdirAll(b.root, 0755); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	sd.MinioDeploymentID = fmt.Sprintf("%v:%v", KindFilesystem, b.root)
+	sd.SqsArn = ""
+	b.sd = *sd
+
+	return
+}
+
+func (b *filesystemBackend) Health() (err error) {
+	info, err := os.Stat(b.root)
+	if err != nil { return util.ProcessErr(err) }
+	if !info.IsDir() { return util.ProcessErr(fmt.Errorf("Storage root %v is not a directory.", b.root)) }
+
+	return
+}
+
+func (b *filesystemBackend) ListBuckets() (bucketNames []string, err error) {
+	entries, err := os.ReadDir(b.root)
+	if err != nil { return bucketNames, util.ProcessErr(err) }
+
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") { bucketNames = append(bucketNames, e.Name()) }
+	}
+
+	return
+}
+
+func (b *filesystemBackend) BucketExists(bucketName string) (exists bool, err error) {
+	bucketPath, err := b.bucketPath(bucketName)
+	if err != nil { return exists, util.ProcessErr(err) }
+
+	info, err := os.Stat(bucketPath)
+	if os.IsNotExist(err) { return false, nil }
+	if err != nil { return exists, util.ProcessErr(err) }
+
+	return info.IsDir(), nil
+}
+
+func (b *filesystemBackend) CreateBucket(bucketName string) (err error) {
+	bucketPath, err := b.bucketPath(bucketName)
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(os.MkdirAll(bucketPath, 0755))
+}
+
+func (b *filesystemBackend) DeleteBucket(bucketName string) (err error) {
+	bucketPath, err := b.bucketPath(bucketName)
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = os.RemoveAll(filepath.Join(b.root, filesystemMetadataDir, bucketName)); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return util.ProcessErr(os.RemoveAll(bucketPath))
+}
+
+func (b *filesystemBackend) ListObjects(bucketName string) (objects []ObjectInfo, err error) {
+	bucketPath, err := b.bucketPath(bucketName)
+	if err != nil { return objects, util.ProcessErr(err) }
+
+	err = filepath.WalkDir(bucketPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil { return err }
+		if d.IsDir() || strings.HasPrefix(d.Name(), filesystemTempPrefix) { return nil }
+
+		rel, err := filepath.Rel(bucketPath, path)
+		if err != nil { return err }
+
+		object, err := b.StatObject(bucketName, filepath.ToSlash(rel))
+		if err != nil { return err }
+		objects = append(objects, object)
+
+		return nil
+	})
+
+	return objects, util.ProcessErr(err)
+}
+
+// Metadata is recomputed when the file was changed outside of FaDO.
+func (b *filesystemBackend) StatObject(bucketName, key string) (object ObjectInfo, err error) {
+	objectPath, metadataPath, err := b.objectPaths(bucketName, key)
+	if err != nil { return object, util.ProcessErr(err) }
+
+	info, err := os.Stat(objectPath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) { return object, ErrObjectNotFound }
+	if err != nil { return object, util.ProcessErr(err) }
+
+	var metadata filesystemObjectMetadata
+	if metadataBytes, err := os.ReadFile(metadataPath); err == nil {
+		json.Unmarshal(metadataBytes, &metadata)
+	}
+	if metadata.Size != info.Size() || !metadata.ModTime.Equal(info.ModTime()) {
+		f, err := os.Open(objectPath)
+		if err != nil { return object, util.ProcessErr(err) }
+		defer f.Close()
+
+		hash := md5.New()
+		if _, err = io.Copy(hash, f); err != nil { return object, util.ProcessErr(err) }
+		metadata = filesystemObjectMetadata{ETag: hex.EncodeToString(hash.Sum(nil)), Size: info.Size(), ModTime: info.ModTime()}
+	}
+
+	return ObjectInfo{Key: key, ETag: metadata.ETag, Size: info.Size(), ContentType: metadata.ContentType, LastModified: info.ModTime(), UserMetadata: metadata.UserMetadata}, nil
+}
+
+func (b *filesystemBackend) GetObject(bucketName, key string) (object Object, err error) {
+	objectPath, _, err := b.objectPaths(bucketName, key)
+	if err != nil { return object, util.ProcessErr(err) }
+
+	f, err := os.Open(objectPath)
+	if os.IsNotExist(err) { return object, ErrObjectNotFound }
+	if err != nil { return object, util.ProcessErr(err) }
+
+	return f, nil
+}
+
+// Writes to a temporary file renamed into place, so readers never see a
+// partially written object.
+func (b *filesystemBackend) PutObject(bucketName, key string, reader io.Reader, size int64, opts PutOptions) (object ObjectInfo, err error) {
+	objectPath, metadataPath, err := b.objectPaths(bucketName, key)
+	if err != nil { return object, util.ProcessErr(err) }
+
+	if exists, err := b.BucketExists(bucketName); err != nil {
+		return object, util.ProcessErr(err)
+	} else if !exists {
+		return object, util.ProcessErr(fmt.Errorf("Bucket %v does not exist.", bucketName))
+	}
+
+	if err = os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil { return object, util.ProcessErr(err) }
+	if err = os.MkdirAll(filepath.Dir(metadataPath), 0755); err != nil { return object, util.ProcessErr(err) }
+
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), filesystemTempPrefix)
+	if err != nil { return object, util.ProcessErr(err) }
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if err != nil { return object, util.ProcessErr(err) }
+	if size >= 0 && written != size {
+		return object, util.ProcessErr(fmt.Errorf("Expected %v bytes for %v/%v, got %v.", size, bucketName, key, written))
+	}
+	if err = tmp.Close(); err != nil { return object, util.ProcessErr(err) }
+	if err = os.Rename(tmp.Name(), objectPath); err != nil { return object, util.ProcessErr(err) }
+
+	info, err := os.Stat(objectPath)
+	if err != nil { return object, util.ProcessErr(err) }
+
+	metadata := filesystemObjectMetadata{ETag: hex.EncodeToString(hash.Sum(nil)), Size: written, ModTime: info.ModTime(), ContentType: opts.ContentType, UserMetadata: opts.UserMetadata}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil { return object, util.ProcessErr(err) }
+	if err = os.WriteFile(metadataPath, metadataBytes, 0644); err != nil { return object, util.ProcessErr(err) }
+
+	return ObjectInfo{Key: key, ETag: metadata.ETag, Size: written, ContentType: opts.ContentType, LastModified: info.ModTime(), UserMetadata: opts.UserMetadata}, nil
+}
+
+func (b *filesystemBackend) DeleteObject(bucketName, key string) (err error) {
+	objectPath, metadataPath, err := b.objectPaths(bucketName, key)
+	if err != nil { return util.ProcessErr(err) }
+
+	if err = os.Remove(objectPath); err != nil && !os.IsNotExist(err) {
+		return util.ProcessErr(err)
+	}
+	if err = os.Remove(metadataPath); err != nil && !os.IsNotExist(err) {
+		return util.ProcessErr(err)
+	}
+
+	return nil
+}
+
+// Space of the file system holding the root.
+func (b *filesystemBackend) Capacity() (c Capacity, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(b.root, &st); err != nil {
+		return c, util.ProcessErr(err)
+	}
+
+	return Capacity{Total: st.Blocks * uint64(st.Bsize), Free: st.Bavail * uint64(st.Bsize)}, nil
+}
+
+func (b *filesystemBackend) Subscribe(bucketName string) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/smithyworks/FaDO/database"
+)
+
+func newTestFilesystemBackend(t *testing.T) Backend {
+	t.Helper()
+	sd := database.StorageDeploymentRecord{Kind: KindFilesystem, Endpoint: t.TempDir()}
+	b, err := New(sd)
+	if err != nil { t.Fatalf("New: %v", err) }
+	if err = b.Register(&sd); err != nil { t.Fatalf("Register: %v", err) }
+	return b
+}
+
+func TestFilesystemObjectRoundTrip(t *testing.T) {
+	b := newTestFilesystemBackend(t)
+	if err := b.CreateBucket("photos"); err != nil { t.Fatalf("CreateBucket: %v", err) }
+
+	written, err := b.PutObject("photos", "2021/cat.jpg", strings.NewReader("meow"), 4, PutOptions{ContentType: "image/jpeg", UserMetadata: map[string]string{"owner": "ada"}})
+	if err != nil { t.Fatalf("PutObject: %v", err) }
+	// md5("meow")
+	if written.ETag != "4a4be40c96ac6314e91d93f38043a634" { t.Errorf("ETag = %v", written.ETag) }
+
+	info, err := b.StatObject("photos", "2021/cat.jpg")
+	if err != nil { t.Fatalf("StatObject: %v", err) }
+	if info.ETag != written.ETag || info.Size != 4 || info.ContentType != "image/jpeg" || info.UserMetadata["owner"] != "ada" {
+		t.Errorf("StatObject = %+v", info)
+	}
+
+	object, err := b.GetObject("photos", "2021/cat.jpg")
+	if err != nil { t.Fatalf("GetObject: %v", err) }
+	content, err := io.ReadAll(object)
+	object.Close()
+	if err != nil || string(content) != "meow" { t.Errorf("GetObject read %q, %v", content, err) }
+
+	objects, err := b.ListObjects("photos")
+	if err != nil { t.Fatalf("ListObjects: %v", err) }
+	if len(objects) != 1 || objects[0].Key != "2021/cat.jpg" { t.Errorf("ListObjects = %+v", objects) }
+
+	buckets, err := b.ListBuckets()
+	if err != nil { t.Fatalf("ListBuckets: %v", err) }
+	if len(buckets) != 1 || buckets[0] != "photos" { t.Errorf("ListBuckets = %v, the metadata directory must not be listed", buckets) }
+
+	if err = b.DeleteObject("photos", "2021/cat.jpg"); err != nil { t.Fatalf("DeleteObject: %v", err) }
+	if _, err = b.StatObject("photos", "2021/cat.jpg"); err != ErrObjectNotFound { t.Errorf("StatObject after delete = %v, want ErrObjectNotFound", err) }
+	if err = b.DeleteObject("photos", "2021/cat.jpg"); err != nil { t.Errorf("deleting a missing object = %v, want nil", err) }
+}
+
+func TestFilesystemPutObject(t *testing.T) {
+	b := newTestFilesystemBackend(t)
+	if err := b.CreateBucket("docs"); err != nil { t.Fatalf("CreateBucket: %v", err) }
+
+	tests := []struct {
+		name string
+		bucket string
+		key string
+		content string
+		size int64
+		wantErr bool
+	}{
+		{"nested key", "docs", "a/b/c.txt", "abc", 3, false},
+		{"unknown size", "docs", "d.txt", "abcd", -1, false},
+		{"size mismatch", "docs", "e.txt", "abc", 5, true},
+		{"missing bucket", "nope", "f.txt", "abc", 3, true},
+		{"escaping key", "docs", "../g.txt", "abc", 3, true},
+		{"absolute key", "docs", "/etc/passwd", "abc", 3, true},
+		{"temporary file key", "docs", filesystemTempPrefix + "h", "abc", 3, true},
+		{"hidden bucket", ".fado", "i.txt", "abc", 3, true},
+		{"empty key", "docs", "", "abc", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := b.PutObject(tt.bucket, tt.key, strings.NewReader(tt.content), tt.size, PutOptions{})
+			if (err != nil) != tt.wantErr { t.Errorf("PutObject(%q, %q) error = %v, wantErr %v", tt.bucket, tt.key, err, tt.wantErr) }
+		})
+	}
+
+	// A failed write leaves nothing behind.
+	if _, err := b.StatObject("docs", "e.txt"); err != ErrObjectNotFound { t.Errorf("StatObject after a failed write = %v, want ErrObjectNotFound", err) }
+}
+
+func TestFilesystemBucketExists(t *testing.T) {
+	b := newTestFilesystemBackend(t)
+	if err := b.CreateBucket("logs"); err != nil { t.Fatalf("CreateBucket: %v", err) }
+
+	tests := []struct {
+		bucket string
+		want bool
+	}{
+		{"logs", true},
+		{"missing", false},
+	}
+	for _, tt := range tests {
+		if exists, err := b.BucketExists(tt.bucket); err != nil || exists != tt.want {
+			t.Errorf("BucketExists(%q) = %v, %v, want %v", tt.bucket, exists, err, tt.want)
+		}
+	}
+
+	if err := b.DeleteBucket("logs"); err != nil { t.Fatalf("DeleteBucket: %v", err) }
+	if exists, err := b.BucketExists("logs"); err != nil || exists { t.Errorf("BucketExists after delete = %v, %v", exists, err) }
+	if err := b.Health(); err != nil { t.Errorf("Health = %v", err) }
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/madmin-go"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/notification"
+	"github.com/smithyworks/FaDO/cli"
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+var ctx = context.Background()
+
+type minioBackend struct {
+	sd database.StorageDeploymentRecord
+	client *minio.Client
+}
+
+func newMinioBackend(sd database.StorageDeploymentRecord) (b *minioBackend, err error) {
+	client, err := minio.New(sd.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(sd.AccessKey, sd.SecretKey, ""),
+		Secure: sd.UseSSL,
+	})
+	if err != nil { return nil, util.ProcessErr(err) }
+
+	return &minioBackend{sd: sd, client: client}, nil
+}
+
+func trimETag(etag string) string {
+	return strings.Trim(etag, "\"")
+}
+
+func toObjectInfo(o minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{Key: o.Key, ETag: trimETag(o.ETag), Size: o.Size, ContentType: o.ContentType, LastModified: o.LastModified, UserMetadata: o.UserMetadata}
+}
+
+// Name of FaDO's webhook notification target on MinIO deployments.
+const minioNotifyTarget = "notify_webhook:fado"
+
+// Makes sure FaDO is set up as a webhook notification target, then reads back
+// the deployment ID and the target's ARN. The target is only configured when
+// missing or outdated, and relies on MinIO applying it dynamically. The service
+// is restarted only if MinIO requires it and restarts are allowed; otherwise
+// the record is left without an ARN so its buckets are polled instead.
+func (b *minioBackend) Register(sd *database.StorageDeploymentRecord) (err error) {
+	adminClient, err := madmin.New(sd.Endpoint, sd.AccessKey, sd.SecretKey, sd.UseSSL)
+	if err != nil { return util.ProcessErr(err) }
+
+	endpoint := fmt.Sprintf("%v/api/notify", cli.Input.ServerURL)
+	configured, err := isNotifyTargetConfigured(adminClient, endpoint)
+	if err != nil { return util.ProcessErr(err) }
+
+	restart := false
+	if !configured {
+		log.Printf("INFO: Configuring notification target on minio deployment %v.", sd.Alias)
+		if restart, err = adminClient.SetConfigKV(ctx, fmt.Sprintf("%v endpoint=%v enable=on", minioNotifyTarget, endpoint)); err != nil {
+			return util.ProcessErr(err)
+		}
+	}
+
+	info, err := adminClient.ServerInfo(ctx)
+	if err != nil { return util.ProcessErr(err) }
+	arn := notifyTargetArn(info)
+
+	if arn == "" && !restart && !configured {
+		// Dynamically applied targets may take a moment to come up.
+		time.Sleep(time.Second)
+		if info, err = adminClient.ServerInfo(ctx); err != nil { return util.ProcessErr(err) }
+		arn = notifyTargetArn(info)
+	}
+
+	if arn == "" {
+		if cli.Input.AllowStorageRestart {
+			if info, err = restartMinio(adminClient, sd.Alias); err != nil { return util.ProcessErr(err) }
+			arn = notifyTargetArn(info)
+		} else {
+			util.PrintWarning(fmt.Errorf("Notification target on minio deployment %v is not active and restarts are not allowed, its buckets will be polled for changes.", sd.Alias))
+		}
+	}
+
+	sd.MinioDeploymentID = info.DeploymentID
+	sd.SqsArn = arn
+	b.sd = *sd
+
+	return
+}
+
+// Whether the target is enabled and points at FaDO's current notify endpoint.
+func isNotifyTargetConfigured(adminClient *madmin.AdminClient, endpoint string) (configured bool, err error) {
+	config, err := adminClient.GetConfigKV(ctx, minioNotifyTarget)
+	if isConfigNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, util.ProcessErr(err)
+	}
+
+	fields := strings.Fields(string(config))
+	return util.HasString(fields, "endpoint=" + endpoint) && !util.HasString(fields, "enable=off"), nil
+}
+
+// MinIO reports targets that were never set as a config error saying so. Any
+// other error, e.g. bad credentials or an unreachable deployment, is real.
+func isConfigNotFound(err error) bool {
+	if err == nil { return false }
+	er := madmin.ToErrorResponse(err)
+	return er.Code == "XMinioConfigError" && strings.Contains(strings.ToLower(er.Message), "not found")
+}
+
+func notifyTargetArn(info madmin.InfoMessage) string {
+	for _, val := range info.SQSARN {
+		if strings.HasSuffix(val, "fado:webhook") { return val }
+	}
+	return ""
+}
+
+func restartMinio(adminClient *madmin.AdminClient, alias string) (info madmin.InfoMessage, err error) {
+	if err = adminClient.ServiceRestart(ctx); err != nil {
+		return info, util.ProcessErr(err)
+	}
+
+	d1 := time.Now()
+	log.Printf("INFO: Restarting minio deployment %v.", alias)
+	for i := 0; i < 3; i++ {
+		time.Sleep(5 * time.Second)
+		if info, err = adminClient.ServerInfo(ctx); err == nil {
+			break
+		}
+	}
+	if err != nil { return info, util.ProcessErr(err) }
+	d2 := time.Since(d1)
+	log.Printf("INFO: Service restarted after %v seconds.", d2.Seconds())
+
+	return
+}
+
+func (b *minioBackend) Health() (err error) {
+	proto := "http"
+	if b.sd.UseSSL { proto = "https" }
+
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("%v://%v/minio/health/live", proto, b.sd.Endpoint))
+	if err != nil { return util.ProcessErr(err) }
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return util.ProcessErr(fmt.Errorf("MinIO deployment %v is not healthy, got status %v.", b.sd.Alias, resp.StatusCode))
+	}
+
+	return
+}
+
+// Sums up the raw space of the deployment's drives, without accounting for
+// erasure coding. Good enough to compare deployments with one another.
+func (b *minioBackend) Capacity() (c Capacity, err error) {
+	adminClient, err := madmin.New(b.sd.Endpoint, b.sd.AccessKey, b.sd.SecretKey, b.sd.UseSSL)
+	if err != nil { return c, util.ProcessErr(err) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	info, err := adminClient.StorageInfo(ctx)
+	if err != nil { return c, util.ProcessErr(err) }
+
+	for _, d := range info.Disks {
+		c.Total += d.TotalSpace
+		c.Free += d.AvailableSpace
+	}
+
+	return
+}
+
+func (b *minioBackend) ListBuckets() (bucketNames []string, err error) {
+	buckets, err := b.client.ListBuckets(ctx)
+	if err != nil { return bucketNames, util.ProcessErr(err) }
+
+	for _, bucket := range buckets { bucketNames = append(bucketNames, bucket.Name) }
+
+	return
+}
+
+func (b *minioBackend) BucketExists(bucketName string) (exists bool, err error) {
+	exists, err = b.client.BucketExists(ctx, bucketName)
+	return exists, util.ProcessErr(err)
+}
+
+func (b *minioBackend) CreateBucket(bucketName string) (err error) {
+	err = b.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
+	return util.ProcessErr(err)
+}
+
+func (b *minioBackend) DeleteBucket(bucketName string) (err error) {
+	err = b.client.RemoveBucketWithOptions(ctx, bucketName, minio.BucketOptions{ForceDelete: true})
+	return util.ProcessErr(err)
+}
+
+func (b *minioBackend) ListObjects(bucketName string) (objects []ObjectInfo, err error) {
+	for o := range b.client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true}) {
+		if o.Err != nil { return objects, util.ProcessErr(o.Err) }
+		objects = append(objects, toObjectInfo(o))
+	}
+
+	return
+}
+
+func (b *minioBackend) StatObject(bucketName, key string) (object ObjectInfo, err error) {
+	info, err := b.client.StatObject(ctx, bucketName, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" { return object, ErrObjectNotFound }
+		return object, util.ProcessErr(err)
+	}
+
+	return toObjectInfo(info), nil
+}
+
+func (b *minioBackend) GetObject(bucketName, key string) (object Object, err error) {
+	object, err = b.client.GetObject(ctx, bucketName, key, minio.GetObjectOptions{})
+	return object, util.ProcessErr(err)
+}
+
+func (b *minioBackend) PutObject(bucketName, key string, reader io.Reader, size int64, opts PutOptions) (object ObjectInfo, err error) {
+	info, err := b.client.PutObject(ctx, bucketName, key, reader, size, minio.PutObjectOptions{
+		ContentType: opts.ContentType,
+		UserMetadata: opts.UserMetadata,
+	})
+	if err != nil { return object, util.ProcessErr(err) }
+
+	return ObjectInfo{Key: key, ETag: trimETag(info.ETag), Size: info.Size, ContentType: opts.ContentType, LastModified: info.LastModified, UserMetadata: opts.UserMetadata}, nil
+}
+
+// Only the object itself is removed, force deleting would also remove the
+// objects under its key as a prefix.
+func (b *minioBackend) DeleteObject(bucketName, key string) (err error) {
+	err = b.client.RemoveObject(ctx, bucketName, key, minio.RemoveObjectOptions{})
+	return util.ProcessErr(err)
+}
+
+func (b *minioBackend) Subscribe(bucketName string) (err error) {
+	// Deployments whose notification target is not active are polled.
+	if b.sd.SqsArn == "" { return ErrNotSupported }
+
+	arnTokens := strings.Split(b.sd.SqsArn, ":")
+	if len(arnTokens) < 6 {
+		return util.ProcessErr(fmt.Errorf("MinIO deployment %v has no notification target.", b.sd.Alias))
+	}
+	queueArn := notification.NewArn(arnTokens[1], arnTokens[2], arnTokens[3], arnTokens[4], arnTokens[5])
+	queueConfig := notification.NewConfig(queueArn)
+	queueConfig.AddEvents(notification.ObjectCreatedAll, notification.ObjectRemovedAll)
+
+	config := notification.Configuration{}
+	config.AddQueue(queueConfig)
+
+	err = b.client.SetBucketNotification(ctx, bucketName, config)
+	return util.ProcessErr(err)
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/minio/madmin-go"
+)
+
+func TestIsConfigNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"target never set", madmin.ErrorResponse{Code: "XMinioConfigError", Message: "notify_webhook:fado not found"}, true},
+		{"other config error", madmin.ErrorResponse{Code: "XMinioConfigError", Message: "invalid value"}, false},
+		{"access denied", madmin.ErrorResponse{Code: "XMinioAdminAccessDenied", Message: "Access Denied."}, false},
+		{"network error", errors.New("dial tcp: connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConfigNotFound(tt.err); got != tt.want { t.Errorf("isConfigNotFound(%v) = %v, want %v", tt.err, got, tt.want) }
+		})
+	}
+}
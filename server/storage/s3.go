@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Any S3-compatible endpoint, used through the standard S3 API only. No admin
+// access is needed, the service is never reconfigured or restarted, and since
+// it cannot notify FaDO of changes its buckets are polled instead.
+type s3Backend struct {
+	*minioBackend
+}
+
+func newS3Backend(sd database.StorageDeploymentRecord) (b *s3Backend, err error) {
+	mb, err := newMinioBackend(sd)
+	if err != nil { return nil, util.ProcessErr(err) }
+
+	return &s3Backend{mb}, nil
+}
+
+// Only checks that the credentials work. The endpoint stands in for the
+// deployment ID, which the S3 API does not expose. Storage deployments are
+// told apart by endpoint throughout, so an endpoint serves a single account.
+func (b *s3Backend) Register(sd *database.StorageDeploymentRecord) (err error) {
+	if _, err = b.ListBuckets(); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	sd.MinioDeploymentID = fmt.Sprintf("%v:%v", KindS3, sd.Endpoint)
+	sd.SqsArn = ""
+	b.sd = *sd
+
+	return
+}
+
+func (b *s3Backend) Health() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	_, err = b.client.ListBuckets(ctx)
+	return util.ProcessErr(err)
+}
+
+// The S3 API has no notion of capacity.
+func (b *s3Backend) Capacity() (c Capacity, err error) {
+	return c, ErrNotSupported
+}
+
+func (b *s3Backend) Subscribe(bucketName string) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Storage deployment kinds
+
+const (
+	KindMinio = "minio"
+	KindS3 = "s3"
+	KindFilesystem = "filesystem"
+)
+
+// Returned as is, never wrapped, so callers can compare against them.
+var ErrNotSupported = errors.New("Operation not supported by this storage backend.")
+var ErrObjectNotFound = errors.New("Object not found.")
+
+type ObjectInfo struct {
+	Key string `json:"key"`
+	ETag string `json:"etag"`
+	Size int64 `json:"size"`
+	ContentType string `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+	UserMetadata map[string]string `json:"user_metadata"`
+}
+
+type PutOptions struct {
+	ContentType string
+	UserMetadata map[string]string
+}
+
+type Object interface {
+	io.ReadSeekCloser
+}
+
+// Operations FaDO needs from a storage deployment. ETags are returned without
+// surrounding quotes.
+type Backend interface {
+	// Prepares the deployment for use by FaDO and fills in the identity and
+	// notification details of the record.
+	Register(sd *database.StorageDeploymentRecord) error
+	Health() error
+
+	ListBuckets() ([]string, error)
+	BucketExists(bucketName string) (bool, error)
+	CreateBucket(bucketName string) error
+	// Deletes the bucket along with any objects left in it.
+	DeleteBucket(bucketName string) error
+
+	ListObjects(bucketName string) ([]ObjectInfo, error)
+	StatObject(bucketName, key string) (ObjectInfo, error)
+	GetObject(bucketName, key string) (Object, error)
+	PutObject(bucketName, key string, reader io.Reader, size int64, opts PutOptions) (ObjectInfo, error)
+	DeleteObject(bucketName, key string) error
+
+	// Has changes to the bucket's objects reported to FaDO's notify endpoint.
+	// Returns ErrNotSupported if the backend cannot push notifications.
+	Subscribe(bucketName string) error
+}
+
+type Capacity struct {
+	Total uint64 `json:"total"`
+	Free uint64 `json:"free"`
+}
+
+// Implemented by backends able to report the space available to them. Returns
+// ErrNotSupported if the deployment does not expose it.
+type CapacityReporter interface {
+	Capacity() (Capacity, error)
+}
+
+func New(sd database.StorageDeploymentRecord) (Backend, error) {
+	switch sd.Kind {
+	case KindMinio, "":
+		return newMinioBackend(sd)
+	case KindS3:
+		return newS3Backend(sd)
+	case KindFilesystem:
+		return newFilesystemBackend(sd)
+	default:
+		return nil, util.ProcessErr(fmt.Errorf("Unknown storage deployment kind '%v'.", sd.Kind))
+	}
+}
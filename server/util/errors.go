@@ -7,8 +7,11 @@ import (
 	"strings"
 )
 
+// Keeps the original error as its cause, so callers can still tell what went
+// wrong with errors.Is and errors.As once it has been processed.
 type ServerError struct {
 	Lines []string
+	Cause error
 }
 
 func (se *ServerError) Error() string {
@@ -19,6 +22,10 @@ func (se *ServerError) Warning() string {
 	return fmt.Sprintf("Warning: %v", strings.Join(se.Lines, "\n          "))
 }
 
+func (se *ServerError) Unwrap() error {
+	return se.Cause
+}
+
 func PrintWarning(err error) error {
 	if err == nil { return nil }
 
@@ -30,7 +37,7 @@ func PrintWarning(err error) error {
 		log.Println(v.Warning())
 		return v
 	default:
-		se := &ServerError{Lines: []string{err.Error(), msg}}
+		se := &ServerError{Lines: []string{err.Error(), msg}, Cause: err}
 		log.Println(se.Warning())
 		return se
 	}
@@ -48,7 +55,7 @@ func ProcessErr(err error, skips ...int) error {
 		v.Lines = append(v.Lines, msg)
 		return v
 	default:
-		return &ServerError{Lines: []string{err.Error(), msg}}
+		return &ServerError{Lines: []string{err.Error(), msg}, Cause: err}
 	}
 }
 
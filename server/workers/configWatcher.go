@@ -0,0 +1,48 @@
+package workers
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/smithyworks/FaDO/config"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Editors and GitOps agents replace the file rather than signal FaDO, so its
+// modification time is checked at this interval.
+const configPollInterval = 10 * time.Second
+
+// Starts applying the configuration file again whenever it changes or FaDO
+// receives SIGHUP.
+func StartConfigWatcher(configFilePath string, prune bool) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		modTime := configModTime(configFilePath)
+		for {
+			select {
+			case <-hup:
+			case <-time.After(configPollInterval):
+				if t := configModTime(configFilePath); t.IsZero() || t.Equal(modTime) { continue }
+			}
+
+			modTime = configModTime(configFilePath)
+			reconcileConfig(configFilePath, prune)
+		}
+	}()
+}
+
+func configModTime(configFilePath string) time.Time {
+	info, err := os.Stat(configFilePath)
+	if err != nil { return time.Time{} }
+	return info.ModTime()
+}
+
+func reconcileConfig(configFilePath string, prune bool) {
+	summary, err := config.ReconcileConfigFile(configFilePath, prune)
+	if err != nil { util.PrintErr(err); return }
+	summary.Log()
+}
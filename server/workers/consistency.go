@@ -0,0 +1,49 @@
+package workers
+
+import (
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+const defaultVerifyInterval = 15 * time.Minute
+
+// Starts periodically comparing every replica against its master bucket, at
+// the interval set by the replica_verify_interval global policy (in seconds).
+func StartReplicaVerifier() {
+	go func() {
+		for {
+			time.Sleep(verifyReplicas())
+		}
+	}()
+}
+
+func verifyReplicas() (interval time.Duration) {
+	interval = defaultVerifyInterval
+
+	conn, err := database.Acquire()
+	if err != nil { util.PrintErr(err); return }
+	defer conn.Release()
+
+	var seconds int
+	if err = database.GetGlobalPolicy(conn, "replica_verify_interval", &seconds); err != nil {
+		util.PrintErr(err)
+	} else if seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	rows, err := database.Query(conn, "SELECT * FROM bucket_replications")
+	if err != nil { util.PrintErr(err); return }
+	bucketReplications, err := database.ScanBucketReplicationRows(rows)
+	if err != nil { util.PrintErr(err); return }
+
+	for _, br := range bucketReplications {
+		if err = mutations.VerifyReplica(conn, br); err != nil {
+			util.PrintWarning(err)
+		}
+	}
+
+	return
+}
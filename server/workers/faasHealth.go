@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// FaaS deployments are probed once their faas_health_interval has passed since
+// their last check, which is looked at this often.
+const faasHealthTick = 5 * time.Second
+
+// Starts probing the health endpoint of every FaaS deployment, withdrawing the
+// unhealthy ones from the load balancer routes until they recover.
+func StartFaaSHealthMonitor() {
+	go func() {
+		for {
+			time.Sleep(faasHealthTick)
+			monitorFaaSHealth()
+		}
+	}()
+}
+
+type faasProbe struct {
+	faasDeployment database.FaaSDeploymentRecord
+	settings mutations.FaaSProbeSettings
+}
+
+func monitorFaaSHealth() {
+	probes, err := dueFaaSProbes()
+	if err != nil { util.PrintErr(err); return }
+
+	// Probes run side by side, so one slow deployment does not delay the
+	// others.
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func(p faasProbe) {
+			defer wg.Done()
+			result := mutations.ProbeFaaSDeployment(p.faasDeployment, p.settings)
+			if err := recordFaaSProbe(p, result); err != nil { util.PrintWarning(err) }
+		}(p)
+	}
+	wg.Wait()
+
+	conn, err := database.Acquire()
+	if err != nil { util.PrintErr(err); return }
+	defer conn.Release()
+	if err = mutations.PruneFaaSHealthChecks(conn); err != nil { util.PrintWarning(err) }
+}
+
+// Deployments without a health path are not probed, and lose any health they
+// had so they are routed to again.
+func dueFaaSProbes() (probes []faasProbe, err error) {
+	tx, err := database.Begin()
+	if err != nil { return probes, util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	faasDeployments, err := database.QueryFaaSDeployments(tx, "SELECT * FROM faas_deployments ORDER BY faas_id")
+	if err != nil { return probes, util.ProcessErr(err) }
+	states, err := database.QueryFaaSHealthStates(tx, "SELECT * FROM faas_health_states")
+	if err != nil { return probes, util.ProcessErr(err) }
+	lastChecked := make(map[int64]time.Time)
+	for _, s := range states {
+		if s.LastCheckedAt != nil { lastChecked[s.FaaSID] = *s.LastCheckedAt }
+	}
+
+	cleared := false
+	for _, fd := range faasDeployments {
+		settings, err := mutations.ResolveFaaSProbeSettings(tx, fd)
+		if err != nil { return probes, util.ProcessErr(err) }
+
+		if settings.Path == "" {
+			if changed, err := mutations.ClearFaaSHealth(tx, fd); err != nil {
+				return probes, util.ProcessErr(err)
+			} else if changed { cleared = true }
+			continue
+		}
+
+		if checkedAt, ok := lastChecked[fd.FaaSID]; ok && time.Since(checkedAt) < settings.Interval { continue }
+		probes = append(probes, faasProbe{fd, settings})
+	}
+
+	if cleared {
+		if _, err = mutations.ReconcileLoadBalancer(tx); err != nil { return probes, util.ProcessErr(err) }
+	}
+
+	return probes, util.ProcessErr(tx.Commit(context.Background()))
+}
+
+// Each probe is recorded in its own transaction, the routes are only
+// regenerated when a deployment is withdrawn or restored.
+func recordFaaSProbe(p faasProbe, result mutations.FaaSProbeResult) (err error) {
+	tx, err := database.Begin()
+	if err != nil { return util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	changed, err := mutations.RecordFaaSHealthCheck(tx, p.faasDeployment, p.settings, result)
+	if err != nil { return util.ProcessErr(err) }
+
+	if changed {
+		if _, err = mutations.ReconcileLoadBalancer(tx); err != nil { return util.ProcessErr(err) }
+		log.Printf("INFO: Updated load balancer routes following the health of FaaS deployment %v.", p.faasDeployment.URL)
+	}
+
+	return util.ProcessErr(tx.Commit(context.Background()))
+}
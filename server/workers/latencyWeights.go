@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/gateway"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Invocation stats are flushed this often, and latency weights refreshed once
+// their lb_latency_refresh_interval has passed.
+const latencyWeightsTick = 5 * time.Second
+
+// Starts weighing the FaaS deployments by their latency and error rate,
+// reconfiguring the routes under the fado_latency policy as the weights change.
+func StartLatencyWeightRefresher() {
+	go func() {
+		var refreshedAt time.Time
+		for {
+			time.Sleep(latencyWeightsTick)
+			if err := gateway.FlushInvocationStats(); err != nil { util.PrintWarning(err) }
+			if refreshed, err := refreshLatencyWeights(refreshedAt); err != nil {
+				util.PrintWarning(err)
+			} else if refreshed { refreshedAt = time.Now() }
+		}
+	}()
+}
+
+func refreshLatencyWeights(refreshedAt time.Time) (refreshed bool, err error) {
+	tx, err := database.Begin()
+	if err != nil { return refreshed, util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	var interval float64
+	if err = database.GetGlobalPolicy(tx, "lb_latency_refresh_interval", &interval); err != nil {
+		return refreshed, util.ProcessErr(err)
+	}
+	if time.Since(refreshedAt) < time.Duration(interval * float64(time.Second)) { return }
+
+	changed, err := mutations.RefreshLatencyWeights(tx)
+	if err != nil { return refreshed, util.ProcessErr(err) }
+
+	if changed {
+		if err = mutations.ConfigureLoadBalancer(tx); err != nil { return refreshed, util.ProcessErr(err) }
+		log.Printf("INFO: Updated load balancer routes following the latency weights of the FaaS deployments.")
+	}
+
+	return true, util.ProcessErr(tx.Commit(context.Background()))
+}
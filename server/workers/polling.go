@@ -0,0 +1,63 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+const defaultPollInterval = 30 * time.Second
+
+// Starts polling the buckets whose master storage deployment has no
+// notification target, at the interval set by the storage_poll_interval global
+// policy (in seconds).
+func StartStoragePoller() {
+	go func() {
+		for {
+			time.Sleep(pollStorage())
+		}
+	}()
+}
+
+func pollStorage() (interval time.Duration) {
+	interval = defaultPollInterval
+
+	conn, err := database.Acquire()
+	if err != nil { util.PrintErr(err); return }
+	defer conn.Release()
+
+	var seconds int
+	if err = database.GetGlobalPolicy(conn, "storage_poll_interval", &seconds); err != nil {
+		util.PrintErr(err)
+	} else if seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	buckets, err := database.QueryBuckets(conn, `SELECT b.* FROM buckets b
+		INNER JOIN storage_deployments sd ON sd.storage_id = b.storage_id
+		WHERE sd.sqs_arn = ''`)
+	if err != nil { util.PrintErr(err); return }
+
+	for _, b := range buckets {
+		if err = pollBucket(b); err != nil { util.PrintWarning(err) }
+	}
+
+	return
+}
+
+// Each bucket is polled in its own transaction, so one unreachable deployment
+// does not hold back the others.
+func pollBucket(bucket database.BucketRecord) (err error) {
+	tx, err := database.Begin()
+	if err != nil { return util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	if err = mutations.PollBucketChanges(tx, bucket); err != nil {
+		return util.ProcessErr(err)
+	}
+
+	return util.ProcessErr(tx.Commit(context.Background()))
+}
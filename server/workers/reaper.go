@@ -0,0 +1,55 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+const replicaReapInterval = time.Minute
+
+// Starts deleting the data of removed replicas once their grace period is
+// over.
+func StartReplicaReaper() {
+	go func() {
+		for {
+			time.Sleep(replicaReapInterval)
+			reapReplicas()
+		}
+	}()
+}
+
+func reapReplicas() {
+	conn, err := database.Acquire()
+	if err != nil { util.PrintErr(err); return }
+	defer conn.Release()
+
+	pendingDeletions, err := database.QueryPendingReplicaDeletions(conn, "SELECT * FROM pending_replica_deletions WHERE delete_after <= now() ORDER BY delete_after")
+	if err != nil { util.PrintErr(err); return }
+
+	for _, prd := range pendingDeletions {
+		if reaped, err := reapReplica(prd); err != nil {
+			util.PrintWarning(err)
+		} else if reaped {
+			log.Printf("INFO: Reaped replica of bucket %v on storage deployment %v.", prd.BucketName, prd.StorageID)
+		}
+	}
+}
+
+// Each replica is reaped in its own transaction, so a failed deletion stays
+// pending and is retried on the next pass.
+func reapReplica(prd database.PendingReplicaDeletionRecord) (reaped bool, err error) {
+	tx, err := database.Begin()
+	if err != nil { return reaped, util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	if reaped, err = mutations.ReapReplicaDeletion(tx, prd.DeletionID); err != nil {
+		return reaped, util.ProcessErr(err)
+	}
+
+	return reaped, util.ProcessErr(tx.Commit(context.Background()))
+}
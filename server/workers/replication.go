@@ -0,0 +1,116 @@
+package workers
+
+import (
+	"log"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Idle workers look for due jobs at this interval, in addition to being woken
+// up whenever new jobs are committed.
+const replicationPollInterval = 5 * time.Second
+
+const replicationPruneInterval = time.Hour
+
+var wakeReplicationWorkers chan struct{}
+
+// Starts the pool of workers draining the replication job queue.
+func StartReplicationWorkers(count int) {
+	if conn, err := database.Acquire(); err != nil {
+		util.PrintErr(err)
+	} else {
+		if err = mutations.RecoverReplicationJobs(conn); err != nil {
+			util.PrintErr(err)
+		}
+		conn.Release()
+	}
+
+	wakeReplicationWorkers = make(chan struct{}, count)
+	go database.Listen(mutations.ReplicationJobsChannel, wakeReplicationWorkers)
+
+	log.Printf("INFO: Starting %v replication workers.", count)
+	for i := 0; i < count; i++ {
+		go runReplicationWorker()
+	}
+
+	go func() {
+		for {
+			if conn, err := database.Acquire(); err != nil {
+				util.PrintErr(err)
+			} else {
+				if err = mutations.PruneReplicationJobs(conn); err != nil {
+					util.PrintErr(err)
+				}
+				conn.Release()
+			}
+			time.Sleep(replicationPruneInterval)
+		}
+	}()
+}
+
+func runReplicationWorker() {
+	for {
+		if !processReplicationJob() {
+			select {
+			case <-wakeReplicationWorkers:
+			case <-time.After(replicationPollInterval):
+			}
+		}
+	}
+}
+
+// Claims and runs a single job, returning whether there was one.
+func processReplicationJob() bool {
+	conn, err := database.Acquire()
+	if err != nil { util.PrintErr(err); return false }
+	defer conn.Release()
+
+	job, claimed, err := mutations.ClaimReplicationJob(conn)
+	if err != nil { util.PrintErr(err); return false }
+	if !claimed { return false }
+
+	stopRenewing := renewReplicationJobLease(job)
+	defer stopRenewing()
+
+	if jobErr := mutations.RunReplicationJob(conn, job); jobErr != nil {
+		util.PrintWarning(jobErr)
+		log.Printf("INFO: Replication job %v failed (attempt %v of %v).", job.JobID, job.Attempts, job.MaxAttempts)
+		err = mutations.FailReplicationJob(conn, job, jobErr)
+	} else {
+		err = mutations.CompleteReplicationJob(conn, job)
+	}
+	if err != nil { util.PrintErr(err) }
+
+	return true
+}
+
+// Keeps the job leased while it runs, on a connection of its own as the
+// worker's is busy running the job.
+func renewReplicationJobLease(job database.ReplicationJobRecord) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(mutations.ReplicationJobLease / 4):
+			}
+
+			conn, err := database.Acquire()
+			if err != nil { util.PrintErr(err); continue }
+			held, err := mutations.RenewReplicationJobLease(conn, job)
+			conn.Release()
+			if err != nil {
+				util.PrintErr(err)
+			} else if !held {
+				log.Printf("INFO: Replication job %v was taken over by another worker.", job.JobID)
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
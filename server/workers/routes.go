@@ -0,0 +1,39 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Replicas cross their staleness threshold without any event, so routes are
+// re-evaluated at this interval.
+const routeReconcileInterval = 10 * time.Second
+
+// Starts keeping load balancer routes in line with replica freshness, removing
+// FaaS deployments whose replica is stale and re-adding them once it catches up.
+func StartRouteReconciler() {
+	go func() {
+		for {
+			time.Sleep(routeReconcileInterval)
+			reconcileRoutes()
+		}
+	}()
+}
+
+func reconcileRoutes() {
+	tx, err := database.Begin()
+	if err != nil { util.PrintErr(err); return }
+	defer tx.Rollback(context.Background())
+
+	changed, err := mutations.ReconcileLoadBalancer(tx)
+	if err != nil { util.PrintErr(err); return }
+	if !changed { return }
+
+	if err = tx.Commit(context.Background()); err != nil { util.PrintErr(err); return }
+	log.Printf("INFO: Updated load balancer routes following replica sync changes.")
+}
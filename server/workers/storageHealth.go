@@ -0,0 +1,92 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/smithyworks/FaDO/database"
+	"github.com/smithyworks/FaDO/mutations"
+	"github.com/smithyworks/FaDO/util"
+)
+
+// Storage deployments are probed once their storage_health_interval has passed
+// since their last check, which is looked at this often.
+const storageHealthTick = 5 * time.Second
+
+// Starts probing the health of every storage deployment, failing the master
+// buckets of the unhealthy ones over to their replicas, and back once they
+// recover.
+func StartStorageHealthMonitor() {
+	go func() {
+		for {
+			time.Sleep(storageHealthTick)
+			monitorStorageHealth()
+		}
+	}()
+}
+
+func monitorStorageHealth() {
+	storageDeployments, settings, err := dueStorageProbes()
+	if err != nil { util.PrintErr(err); return }
+
+	var wg sync.WaitGroup
+	for _, sd := range storageDeployments {
+		wg.Add(1)
+		go func(sd database.StorageDeploymentRecord) {
+			defer wg.Done()
+			result := mutations.ProbeStorageDeployment(sd)
+			if err := recordStorageProbe(sd, settings, result); err != nil { util.PrintWarning(err) }
+		}(sd)
+	}
+	wg.Wait()
+
+	if err = failBackBuckets(); err != nil { util.PrintWarning(err) }
+}
+
+func dueStorageProbes() (storageDeployments []database.StorageDeploymentRecord, settings mutations.StorageProbeSettings, err error) {
+	conn, err := database.Acquire()
+	if err != nil { return storageDeployments, settings, util.ProcessErr(err) }
+	defer conn.Release()
+
+	settings, err = mutations.ResolveStorageProbeSettings(conn)
+	if err != nil { return storageDeployments, settings, util.ProcessErr(err) }
+
+	storageDeployments, err = database.QueryStorageDeployments(conn, `SELECT sd.* FROM storage_deployments sd
+		LEFT JOIN storage_health_states shs ON shs.storage_id = sd.storage_id
+		WHERE shs.last_checked_at IS NULL OR shs.last_checked_at <= now() - make_interval(secs => $1)
+		ORDER BY sd.storage_id`, settings.Interval.Seconds())
+	if err != nil { return storageDeployments, settings, util.ProcessErr(err) }
+
+	return
+}
+
+// Each probe is recorded in its own transaction, together with the failover
+// or recovery it triggers.
+func recordStorageProbe(sd database.StorageDeploymentRecord, settings mutations.StorageProbeSettings, result mutations.StorageProbeResult) (err error) {
+	tx, err := database.Begin()
+	if err != nil { return util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	previous, status, err := mutations.RecordStorageHealthCheck(tx, sd, settings, result)
+	if err != nil { return util.ProcessErr(err) }
+
+	if status == database.HealthUnhealthy && previous != database.HealthUnhealthy {
+		err = mutations.FailOverStorageDeployment(tx, sd)
+	} else if status == database.HealthHealthy && previous == database.HealthUnhealthy {
+		err = mutations.RecoverStorageDeployment(tx, sd)
+	}
+	if err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(tx.Commit(context.Background()))
+}
+
+func failBackBuckets() (err error) {
+	tx, err := database.Begin()
+	if err != nil { return util.ProcessErr(err) }
+	defer tx.Rollback(context.Background())
+
+	if err = mutations.FailBackBuckets(tx); err != nil { return util.ProcessErr(err) }
+
+	return util.ProcessErr(tx.Commit(context.Background()))
+}